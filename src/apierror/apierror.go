@@ -0,0 +1,68 @@
+package apierror
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	Code    string `json:"code"`              // Stable, machine-readable code derived from the HTTP status, such as "not_found"
+	Message string `json:"message"`           // Human-readable description
+	Details any    `json:"details,omitempty"` // Extra data about the error, depending on the endpoint
+}
+
+// Code returns the error code of an HTTP status: its status text in snake case.
+func Code(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}), "_"))
+}
+
+// JSON answers a request with an error.
+func JSON(c echo.Context, status int, message string) error {
+	return c.JSON(status, ErrorResponse{Code: Code(status), Message: message})
+}
+
+// JSONWithDetails answers a request with an error carrying extra data.
+func JSONWithDetails(c echo.Context, status int, message string, details any) error {
+	return c.JSON(status, ErrorResponse{Code: Code(status), Message: message, Details: details})
+}
+
+// HTTPErrorHandler renders errors returned by handlers and middleware as an ErrorResponse.
+// An *echo.HTTPError keeps its status; any other error is a 500 that does not reveal it.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	status := http.StatusInternalServerError
+	message := http.StatusText(status)
+	if he, ok := err.(*echo.HTTPError); ok {
+		status = he.Code
+		switch m := he.Message.(type) {
+		case string:
+			message = m
+		case error:
+			message = m.Error()
+		default:
+			message = fmt.Sprint(m)
+		}
+	}
+
+	var renderErr error
+	if c.Request().Method == http.MethodHead {
+		renderErr = c.NoContent(status)
+	} else {
+		renderErr = JSON(c, status, message)
+	}
+	if renderErr != nil {
+		c.Logger().Error(renderErr)
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Scopes of an API key.
+const (
+	APIKeyScopeReadWrite = "rw" // Reads and writes, the default
+	APIKeyScopeReadOnly  = "ro" // Reads only, for dashboards and monitoring
+)
+
+// APIKey is an accepted API key, limited to Namespaces unless empty and to reads if its
+// Scope is "ro". It is also the format of the entries of API_KEYS_FILE.
+type APIKey struct {
+	Key        string   `json:"key"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Scope      string   `json:"scope,omitempty"` // "ro" or "rw", defaults to "rw"
+}
+
+// LoadAPIKeys returns the keys of API_KEYS followed by those of API_KEYS_FILE, with scopes
+// defaulted. API_KEYS entries have the form "key", "key:ns1|ns2" or "key:ns1|ns2:ro", where
+// "key::ro" is a read-only key for every namespace.
+func (c *Config) LoadAPIKeys() ([]APIKey, error) {
+	keys := make([]APIKey, 0, len(c.APIKeys))
+	for i, entry := range c.APIKeys {
+		parts := strings.SplitN(entry, ":", 3)
+		key := APIKey{Key: parts[0]}
+		if len(parts) > 1 {
+			for _, namespace := range strings.Split(parts[1], "|") {
+				if namespace = strings.TrimSpace(namespace); namespace != "" {
+					key.Namespaces = append(key.Namespaces, namespace)
+				}
+			}
+			if len(key.Namespaces) == 0 && len(parts) == 2 {
+				return nil, fmt.Errorf("API_KEYS entry %d: namespace list must not be empty", i+1)
+			}
+		}
+		if len(parts) > 2 {
+			key.Scope = parts[2]
+		}
+		keys = append(keys, key)
+	}
+
+	if c.APIKeysFile != "" {
+		data, err := os.ReadFile(c.APIKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("API_KEYS_FILE: %w", err)
+		}
+		var fileKeys []APIKey
+		if err := json.Unmarshal(data, &fileKeys); err != nil {
+			return nil, fmt.Errorf("API_KEYS_FILE: %w", err)
+		}
+		keys = append(keys, fileKeys...)
+	}
+
+	// Keys are numbered across both sources, so errors can point at one without quoting it
+	for i := range keys {
+		if keys[i].Key == "" {
+			return nil, fmt.Errorf("API key %d: key must not be empty", i+1)
+		}
+		switch keys[i].Scope {
+		case "":
+			keys[i].Scope = APIKeyScopeReadWrite
+		case APIKeyScopeReadWrite, APIKeyScopeReadOnly:
+		default:
+			return nil, fmt.Errorf("API key %d: scope must be ro or rw, got %q", i+1, keys[i].Scope)
+		}
+	}
+	return keys, nil
+}
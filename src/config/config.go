@@ -3,15 +3,52 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	Port string
 
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+
+	IdentitySource             string // header or cert
+	IdentityCertNamespaceField string // Certificate field holding the namespace (CN, O, OU, DNS, EMAIL, URI)
+	IdentityCertAppNameField   string // Certificate field holding the app name, empty to keep using the header
+
+	APIKeys      []string // Accepted API keys, each "key", "key:ns1|ns2" or "key:ns1|ns2:ro", see LoadAPIKeys; empty disables auth
+	APIKeysFile  string   // JSON file of further API keys, see APIKey
+	AdminAPIKeys []string // API keys allowed on the admin routes, which cross namespaces; empty disables them
+
+	RateLimitRPS   int // Requests per second allowed per API key or namespace/app, 0 for no limit
+	RateLimitBurst int // Requests allowed in a burst above RateLimitRPS, 0 to use RateLimitRPS
+
+	CORSAllowedOrigins   []string // Origins browsers may call the API from, "*" for any; empty disables CORS
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string // Request headers browsers may send, the namespace and app headers are always allowed
+	CORSAllowCredentials bool     // Let browsers send cookies and client certificates cross-origin
+	CORSMaxAgeSeconds    int      // How long browsers may cache a preflight response
+
+	RequestLog      bool   // Log requests as JSON lines and tag them with an X-Request-ID
+	RequestLogLevel string // Lowest level logged: "info" (all), "warn" (4xx and 5xx) or "error" (5xx)
+
+	OTelEndpoint    string // OTLP/HTTP endpoint traces are exported to, empty to not export traces
+	OTelServiceName string // Service name reported in traces
+
 	ETCDEndpoints []string
 	ETCDCAFile    string
 	ETCDCertFile  string
 	ETCDKeyFile   string
+	ETCDUsername  string // User for etcd authentication, empty to not authenticate
+	ETCDPassword  string
+
+	ETCDDialTimeoutSeconds      int // Max time to establish the etcd connection
+	ETCDKeepAliveTimeSeconds    int // Idle time before the client pings etcd, 0 to not ping
+	ETCDKeepAliveTimeoutSeconds int // Time to wait for a ping response before closing the connection
+
+	EnableWriteLocks bool // Serialize writes to the same key with a distributed lock
 
 	BaseKeyPrefix    string
 	HeaderNamespace  string
@@ -23,17 +60,110 @@ type Config struct {
 	MaxAppNameLen    int
 	MaxKeyLen        int
 	MaxValueSize     int
+	CompressMinSize  int // Values of at least this many bytes are stored gzip-compressed, 0 to never compress
 	MaxTTLSeconds    int
+	MaxListResults   int
+	TTLJitterPercent int
+
+	MaxNamespaces       int // Max distinct namespaces, 0 for no limit
+	MaxAppsPerNamespace int // Max distinct apps in one namespace, 0 for no limit
+
+	RedactKeyPatterns []string // Key globs whose values are kept out of logs and error messages
+	RedactNamespaces  []string // Namespaces whose values are always redacted
+
+	RejectEmptyValues bool // Reject writes with an empty value
+
+	VerifyChecksumOnRead bool // Re-verify stored checksums when reading keys
+
+	CacheMaxAgePercent        int // Share of the remaining TTL used as Cache-Control max-age
+	CacheDefaultMaxAge        int // max-age for keys without TTL, 0 means no-cache
+	CacheStaleWhileRevalidate int // stale-while-revalidate in seconds, 0 to omit
+
+	WebhookPatternByID bool   // Treat GET /webhooks/{pattern}* as a pattern query (legacy behavior)
+	WebhookSourceAddr  string // Local IP outbound webhook requests are sent from
+
+	WebhookAllowedNetworks []string // Internal networks webhooks may deliver to, see WebhookAllowedNets
+
+	WebhookDefaultHeaders map[string]string // Headers sent with every webhook, overridden by per-webhook headers
+
+	WebhookSecretsDir string // Directory of files that can be referenced as webhook secrets
+
+	WebhookClientCertFile string // Client certificate presented to webhook receivers
+	WebhookClientKeyFile  string
+	WebhookCAFile         string // CA used to verify webhook receivers
+
+	WebhookResponseMaxBytes int // Max bytes of a blocking webhook response returned to the writer
+
+	WebhookTimeoutSeconds int // Timeout of a webhook request, unless the webhook sets its own
+
+	WebhookDrainTimeoutSeconds int // Max time to wait for in-flight deliveries on shutdown
+
+	WebhookWorkers         int    // Workers sending asynchronous webhook deliveries
+	WebhookQueueSize       int    // Deliveries waiting for a worker before the queue is full
+	WebhookQueueFullPolicy string // block or drop, what to do with a delivery when the queue is full
+
+	WebhookPersistentQueue bool // Persist deliveries in etcd until they succeed, instead of in memory
+	WebhookQueuePollMs     int  // How often the persistent queue is checked for due deliveries
+
+	WebhookMaxAttempts int // Delivery attempts of a webhook event, including the first one
+	WebhookRetryBaseMs int // Delay before the first delivery retry, doubled for each further retry
+
+	WebhookDeliveryLogTTLSeconds int    // How long delivery attempts are kept, 0 to not record them
+	WebhookDeliveryLogMax        int    // Max delivery attempts kept per webhook
+	WebhookLogLevel              string // Lowest level of delivery outcomes logged: "info" (all), "warn" (failures), "error" (final failures) or "off"
+
+	WatcherRetryBaseMs int // Base delay between watcher lock attempts
+	WatcherRetryMaxMs  int // Max delay between watcher lock attempts
+
+	WatcherCheckpointSeconds int // How often the watcher saves the last revision it processed
+
+	WatcherSessionTTLSeconds  int // TTL of the watcher lock session, how long a dead watcher holds the lock
+	WatcherLockTimeoutSeconds int // Max time to wait for the watcher lock per attempt
 }
 
 func NewConfig() *Config {
 	return &Config{
 		Port: getEnv("PORT", "8080"),
 
-		ETCDEndpoints: []string{getEnv("ETCD_ENDPOINTS", "localhost:2379")},
+		TLSCertFile:     getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:      getEnv("TLS_KEY_FILE", ""),
+		TLSClientCAFile: getEnv("TLS_CLIENT_CA_FILE", ""),
+
+		IdentitySource:             getEnv("IDENTITY_SOURCE", "header"),
+		IdentityCertNamespaceField: getEnv("IDENTITY_CERT_NAMESPACE_FIELD", "OU"),
+		IdentityCertAppNameField:   getEnvOrEmpty("IDENTITY_CERT_APPNAME_FIELD", "CN"),
+
+		APIKeys:      getEnvList("API_KEYS", ""),
+		APIKeysFile:  getEnv("API_KEYS_FILE", ""),
+		AdminAPIKeys: getEnvList("ADMIN_API_KEYS", ""),
+
+		RateLimitRPS:   getEnvInt("RATE_LIMIT_RPS", 0),
+		RateLimitBurst: getEnvInt("RATE_LIMIT_BURST", 0),
+
+		CORSAllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS", ""),
+		CORSAllowedMethods:   getEnvList("CORS_ALLOWED_METHODS", "GET,HEAD,POST,PUT,PATCH,DELETE"),
+		CORSAllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-API-Key,If-Match,If-None-Match,X-Request-ID"),
+		CORSAllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAgeSeconds:    getEnvInt("CORS_MAX_AGE_SECONDS", 600),
+
+		RequestLog:      getEnvBool("REQUEST_LOG", false),
+		RequestLogLevel: getEnv("REQUEST_LOG_LEVEL", "info"),
+
+		OTelEndpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		OTelServiceName: getEnv("OTEL_SERVICE_NAME", "simple-golang-kv"),
+
+		ETCDEndpoints: getEnvList("ETCD_ENDPOINTS", "localhost:2379"),
 		ETCDCAFile:    getEnv("ETCD_CA_FILE", ""),
 		ETCDCertFile:  getEnv("ETCD_CERT_FILE", ""),
 		ETCDKeyFile:   getEnv("ETCD_KEY_FILE", ""),
+		ETCDUsername:  getEnv("ETCD_USERNAME", ""),
+		ETCDPassword:  getEnv("ETCD_PASSWORD", ""),
+
+		ETCDDialTimeoutSeconds:      getEnvInt("ETCD_DIAL_TIMEOUT", 5),
+		ETCDKeepAliveTimeSeconds:    getEnvInt("ETCD_KEEPALIVE_TIME", 0),
+		ETCDKeepAliveTimeoutSeconds: getEnvInt("ETCD_KEEPALIVE_TIMEOUT", 0),
+
+		EnableWriteLocks: getEnvBool("ENABLE_WRITE_LOCKS", true),
 
 		BaseKeyPrefix:    getEnv("BASE_KEY_PREFIX", "kvstore"),
 		HeaderNamespace:  getEnv("HEADER_NAMESPACE", "KV-Namespace"),
@@ -44,11 +174,99 @@ func NewConfig() *Config {
 		MaxNamespaceLen:  getEnvInt("MAX_NAMESPACE_LEN", 25),
 		MaxAppNameLen:    getEnvInt("MAX_APPNAME_LEN", 25),
 		MaxKeyLen:        getEnvInt("MAX_KEY_LEN", 100),
-		MaxValueSize:     getEnvInt("MAX_VALUE_SIZE", 1*1024*1024),   // 1 MB
+		MaxValueSize:     getEnvInt("MAX_VALUE_SIZE", 1*1024*1024), // 1 MB
+		CompressMinSize:  getEnvInt("COMPRESS_MIN_SIZE", 0),
 		MaxTTLSeconds:    getEnvInt("MAX_TTL_SECONDS", 365*24*60*60), // 1 year
+		MaxListResults:   getEnvInt("MAX_LIST_RESULTS", 1000),
+		TTLJitterPercent: getEnvInt("TTL_JITTER_PERCENT", 0),
+
+		MaxNamespaces:       getEnvInt("MAX_NAMESPACES", 0),
+		MaxAppsPerNamespace: getEnvInt("MAX_APPS_PER_NAMESPACE", 0),
+
+		RedactKeyPatterns: getEnvList("REDACT_KEY_PATTERNS", "*password*,*secret*,*token*"),
+		RedactNamespaces:  getEnvList("REDACT_NAMESPACES", ""),
+
+		RejectEmptyValues: getEnvBool("REJECT_EMPTY_VALUES", false),
+
+		VerifyChecksumOnRead: getEnvBool("VERIFY_CHECKSUM_ON_READ", false),
+
+		CacheMaxAgePercent:        getEnvInt("CACHE_MAX_AGE_PERCENT", 100),
+		CacheDefaultMaxAge:        getEnvInt("CACHE_DEFAULT_MAX_AGE_SECONDS", 0),
+		CacheStaleWhileRevalidate: getEnvInt("CACHE_STALE_WHILE_REVALIDATE_SECONDS", 0),
+
+		WebhookPatternByID: getEnvBool("WEBHOOK_PATTERN_BY_ID", false),
+		WebhookSourceAddr:  getEnv("WEBHOOK_SOURCE_ADDR", ""),
+
+		WebhookAllowedNetworks: getEnvList("WEBHOOK_ALLOWED_NETWORKS", ""),
+
+		WebhookDefaultHeaders: getEnvMap("WEBHOOK_DEFAULT_HEADERS"),
+
+		WebhookSecretsDir: getEnv("WEBHOOK_SECRETS_DIR", ""),
+
+		WebhookClientCertFile: getEnv("WEBHOOK_CLIENT_CERT_FILE", ""),
+		WebhookClientKeyFile:  getEnv("WEBHOOK_CLIENT_KEY_FILE", ""),
+		WebhookCAFile:         getEnv("WEBHOOK_CA_FILE", ""),
+
+		WebhookResponseMaxBytes: getEnvInt("WEBHOOK_RESPONSE_MAX_BYTES", 64*1024), // 64 KB
+
+		WebhookTimeoutSeconds: getEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+
+		WebhookDrainTimeoutSeconds: getEnvInt("WEBHOOK_DRAIN_TIMEOUT_SECONDS", 10),
+
+		WebhookWorkers:         getEnvInt("WEBHOOK_WORKERS", 16),
+		WebhookQueueSize:       getEnvInt("WEBHOOK_QUEUE_SIZE", 1000),
+		WebhookQueueFullPolicy: getEnv("WEBHOOK_QUEUE_FULL_POLICY", "block"),
+
+		WebhookPersistentQueue: getEnvBool("WEBHOOK_PERSISTENT_QUEUE", false),
+		WebhookQueuePollMs:     getEnvInt("WEBHOOK_QUEUE_POLL_MS", 1000),
+
+		WebhookMaxAttempts: getEnvInt("WEBHOOK_MAX_ATTEMPTS", 3),
+		WebhookRetryBaseMs: getEnvInt("WEBHOOK_RETRY_BASE_MS", 1000),
+
+		WebhookDeliveryLogTTLSeconds: getEnvInt("WEBHOOK_DELIVERY_LOG_TTL_SECONDS", 24*60*60), // 1 day
+		WebhookDeliveryLogMax:        getEnvInt("WEBHOOK_DELIVERY_LOG_MAX", 100),
+		WebhookLogLevel:              getEnv("WEBHOOK_LOG_LEVEL", "info"),
+
+		WatcherRetryBaseMs: getEnvInt("WATCHER_RETRY_BASE_MS", 2000),
+		WatcherRetryMaxMs:  getEnvInt("WATCHER_RETRY_MAX_MS", 30000),
+
+		WatcherCheckpointSeconds: getEnvInt("WATCHER_CHECKPOINT_SECONDS", 5),
+
+		WatcherSessionTTLSeconds:  getEnvInt("WATCHER_SESSION_TTL_SECONDS", 10),
+		WatcherLockTimeoutSeconds: getEnvInt("WATCHER_LOCK_TIMEOUT_SECONDS", 5),
 	}
 }
 
+// WebhookDrainTimeout returns the max time to wait for in-flight deliveries on shutdown.
+func (c *Config) WebhookDrainTimeout() time.Duration {
+	return time.Duration(c.WebhookDrainTimeoutSeconds) * time.Second
+}
+
+// WebhookQueuePoll returns how often the persistent webhook queue is checked for due deliveries.
+func (c *Config) WebhookQueuePoll() time.Duration {
+	return time.Duration(max(c.WebhookQueuePollMs, 1)) * time.Millisecond
+}
+
+// WatcherRetryBase returns the base delay between watcher lock attempts.
+func (c *Config) WatcherRetryBase() time.Duration {
+	return time.Duration(c.WatcherRetryBaseMs) * time.Millisecond
+}
+
+// WatcherRetryMax returns the max delay between watcher lock attempts.
+func (c *Config) WatcherRetryMax() time.Duration {
+	return time.Duration(c.WatcherRetryMaxMs) * time.Millisecond
+}
+
+// WatcherCheckpoint returns how often the watcher saves the last revision it processed.
+func (c *Config) WatcherCheckpoint() time.Duration {
+	return time.Duration(max(c.WatcherCheckpointSeconds, 1)) * time.Second
+}
+
+// WatcherLockTimeout returns the max time to wait for the watcher lock per attempt.
+func (c *Config) WatcherLockTimeout() time.Duration {
+	return time.Duration(c.WatcherLockTimeoutSeconds) * time.Second
+}
+
 func getEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -56,6 +274,15 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvOrEmpty is like getEnv, but a variable set to "" is returned as "" instead of the
+// fallback, for settings where empty has a meaning of its own.
+func getEnvOrEmpty(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
 func getEnvInt(key string, fallback int) int {
 	if val := os.Getenv(key); val != "" {
 		if n, err := strconv.Atoi(val); err == nil {
@@ -65,6 +292,40 @@ func getEnvInt(key string, fallback int) int {
 	return fallback
 }
 
+func getEnvBool(key string, fallback bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+// getEnvList parses a comma-separated list, skipping empty entries.
+func getEnvList(key, fallback string) []string {
+	var result []string
+	for _, item := range strings.Split(getEnv(key, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvMap parses a comma-separated list of Name=Value pairs. Malformed pairs are skipped.
+func getEnvMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		result[name] = strings.TrimSpace(value)
+	}
+	return result
+}
+
 // AppConfig is the exported configuration instance
 var AppConfig = NewConfig()
 
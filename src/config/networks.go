@@ -0,0 +1,28 @@
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+// WebhookAllowedNets parses WEBHOOK_ALLOWED_NETWORKS, the internal networks webhooks may
+// deliver to. A bare IP address is accepted as a single-address network.
+func (c *Config) WebhookAllowedNets() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(c.WebhookAllowedNetworks))
+	for _, entry := range c.WebhookAllowedNetworks {
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("WEBHOOK_ALLOWED_NETWORKS: %q is not a CIDR or IP address", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
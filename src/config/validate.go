@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// certFields are the client certificate fields the namespace and app name can be read from.
+var certFields = []string{"CN", "O", "OU", "DNS", "EMAIL", "URI"}
+
+// isCertField reports whether field names a certificate field, in any case.
+func isCertField(field string) bool {
+	return slices.Contains(certFields, strings.ToUpper(field))
+}
+
+// Validate checks that the configuration is usable, reporting every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port <= 65535, "PORT must be a port number between 1 and 65535, got %q", c.Port)
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	check(c.IdentitySource == "header" || c.IdentitySource == "cert", "IDENTITY_SOURCE must be header or cert, got %q", c.IdentitySource)
+	if c.IdentitySource == "cert" {
+		check(c.TLSCertFile != "" && c.TLSClientCAFile != "", "IDENTITY_SOURCE=cert requires TLS_CERT_FILE and TLS_CLIENT_CA_FILE")
+		check(isCertField(c.IdentityCertNamespaceField), "IDENTITY_CERT_NAMESPACE_FIELD must be one of %s, got %q", strings.Join(certFields, ", "), c.IdentityCertNamespaceField)
+		check(c.IdentityCertAppNameField == "" || isCertField(c.IdentityCertAppNameField), "IDENTITY_CERT_APPNAME_FIELD must be empty or one of %s, got %q", strings.Join(certFields, ", "), c.IdentityCertAppNameField)
+	}
+
+	if _, err := c.LoadAPIKeys(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.RateLimitRPS >= 0, "RATE_LIMIT_RPS must not be negative, got %d", c.RateLimitRPS)
+	check(c.RateLimitBurst >= 0, "RATE_LIMIT_BURST must not be negative, got %d", c.RateLimitBurst)
+	check(!c.CORSAllowCredentials || !slices.Contains(c.CORSAllowedOrigins, "*"), "CORS_ALLOW_CREDENTIALS cannot be used with CORS_ALLOWED_ORIGINS=*")
+	check(c.CORSMaxAgeSeconds >= 0, "CORS_MAX_AGE_SECONDS must not be negative, got %d", c.CORSMaxAgeSeconds)
+	check(c.RequestLogLevel == "info" || c.RequestLogLevel == "warn" || c.RequestLogLevel == "error", "REQUEST_LOG_LEVEL must be info, warn or error, got %q", c.RequestLogLevel)
+	check(c.WebhookLogLevel == "info" || c.WebhookLogLevel == "warn" || c.WebhookLogLevel == "error" || c.WebhookLogLevel == "off", "WEBHOOK_LOG_LEVEL must be info, warn, error or off, got %q", c.WebhookLogLevel)
+
+	check(len(c.ETCDEndpoints) > 0, "ETCD_ENDPOINTS must list at least one endpoint")
+	check(c.ETCDPassword == "" || c.ETCDUsername != "", "ETCD_PASSWORD requires ETCD_USERNAME")
+	check(c.ETCDDialTimeoutSeconds > 0, "ETCD_DIAL_TIMEOUT must be positive, got %d", c.ETCDDialTimeoutSeconds)
+	check(c.ETCDKeepAliveTimeSeconds >= 0, "ETCD_KEEPALIVE_TIME must not be negative, got %d", c.ETCDKeepAliveTimeSeconds)
+	check(c.ETCDKeepAliveTimeoutSeconds >= 0, "ETCD_KEEPALIVE_TIMEOUT must not be negative, got %d", c.ETCDKeepAliveTimeoutSeconds)
+	check(c.BaseKeyPrefix != "", "BASE_KEY_PREFIX must not be empty")
+	check(c.DefaultNamespace != "", "DEFAULT_NAMESPACE must not be empty")
+	check(c.DefaultAppName != "", "DEFAULT_APPNAME must not be empty")
+
+	check(c.MaxNamespaceLen > 0, "MAX_NAMESPACE_LEN must be positive, got %d", c.MaxNamespaceLen)
+	check(c.MaxAppNameLen > 0, "MAX_APPNAME_LEN must be positive, got %d", c.MaxAppNameLen)
+	check(c.MaxKeyLen > 0, "MAX_KEY_LEN must be positive, got %d", c.MaxKeyLen)
+	check(c.MaxValueSize > 0, "MAX_VALUE_SIZE must be positive, got %d", c.MaxValueSize)
+	check(c.CompressMinSize >= 0, "COMPRESS_MIN_SIZE must not be negative, got %d", c.CompressMinSize)
+	check(c.MaxListResults > 0, "MAX_LIST_RESULTS must be positive, got %d", c.MaxListResults)
+	check(c.MaxTTLSeconds > 0, "MAX_TTL_SECONDS must be positive, got %d", c.MaxTTLSeconds)
+	check(c.DefaultTTL >= 0 && c.DefaultTTL <= c.MaxTTLSeconds, "DEFAULT_TTL_SECONDS must be between 0 and MAX_TTL_SECONDS (%d), got %d", c.MaxTTLSeconds, c.DefaultTTL)
+	check(c.TTLJitterPercent >= 0 && c.TTLJitterPercent <= 100, "TTL_JITTER_PERCENT must be between 0 and 100, got %d", c.TTLJitterPercent)
+	check(c.MaxNamespaces >= 0, "MAX_NAMESPACES must not be negative, got %d", c.MaxNamespaces)
+	check(c.MaxAppsPerNamespace >= 0, "MAX_APPS_PER_NAMESPACE must not be negative, got %d", c.MaxAppsPerNamespace)
+
+	check(c.CacheMaxAgePercent >= 0 && c.CacheMaxAgePercent <= 100, "CACHE_MAX_AGE_PERCENT must be between 0 and 100, got %d", c.CacheMaxAgePercent)
+	check(c.CacheDefaultMaxAge >= 0, "CACHE_DEFAULT_MAX_AGE_SECONDS must not be negative, got %d", c.CacheDefaultMaxAge)
+	check(c.CacheStaleWhileRevalidate >= 0, "CACHE_STALE_WHILE_REVALIDATE_SECONDS must not be negative, got %d", c.CacheStaleWhileRevalidate)
+
+	if _, err := c.WebhookAllowedNets(); err != nil {
+		errs = append(errs, err)
+	}
+	check((c.WebhookClientCertFile == "") == (c.WebhookClientKeyFile == ""), "WEBHOOK_CLIENT_CERT_FILE and WEBHOOK_CLIENT_KEY_FILE must be set together")
+	check(c.WebhookResponseMaxBytes >= 0, "WEBHOOK_RESPONSE_MAX_BYTES must not be negative, got %d", c.WebhookResponseMaxBytes)
+	check(c.WebhookTimeoutSeconds > 0, "WEBHOOK_TIMEOUT_SECONDS must be positive, got %d", c.WebhookTimeoutSeconds)
+	check(c.WebhookDrainTimeoutSeconds >= 0, "WEBHOOK_DRAIN_TIMEOUT_SECONDS must not be negative, got %d", c.WebhookDrainTimeoutSeconds)
+	check(c.WebhookWorkers > 0, "WEBHOOK_WORKERS must be positive, got %d", c.WebhookWorkers)
+	check(c.WebhookQueueSize >= 0, "WEBHOOK_QUEUE_SIZE must not be negative, got %d", c.WebhookQueueSize)
+	check(c.WebhookQueueFullPolicy == "block" || c.WebhookQueueFullPolicy == "drop", "WEBHOOK_QUEUE_FULL_POLICY must be block or drop, got %q", c.WebhookQueueFullPolicy)
+	check(c.WebhookQueuePollMs > 0, "WEBHOOK_QUEUE_POLL_MS must be positive, got %d", c.WebhookQueuePollMs)
+	check(c.WebhookMaxAttempts > 0, "WEBHOOK_MAX_ATTEMPTS must be positive, got %d", c.WebhookMaxAttempts)
+	check(c.WebhookRetryBaseMs >= 0, "WEBHOOK_RETRY_BASE_MS must not be negative, got %d", c.WebhookRetryBaseMs)
+	check(c.WebhookDeliveryLogTTLSeconds >= 0, "WEBHOOK_DELIVERY_LOG_TTL_SECONDS must not be negative, got %d", c.WebhookDeliveryLogTTLSeconds)
+	check(c.WebhookDeliveryLogMax >= 0, "WEBHOOK_DELIVERY_LOG_MAX must not be negative, got %d", c.WebhookDeliveryLogMax)
+
+	check(c.WatcherRetryBaseMs > 0, "WATCHER_RETRY_BASE_MS must be positive, got %d", c.WatcherRetryBaseMs)
+	check(c.WatcherRetryMaxMs >= c.WatcherRetryBaseMs, "WATCHER_RETRY_MAX_MS must be at least WATCHER_RETRY_BASE_MS (%d), got %d", c.WatcherRetryBaseMs, c.WatcherRetryMaxMs)
+	check(c.WatcherCheckpointSeconds > 0, "WATCHER_CHECKPOINT_SECONDS must be positive, got %d", c.WatcherCheckpointSeconds)
+	check(c.WatcherSessionTTLSeconds > 0, "WATCHER_SESSION_TTL_SECONDS must be positive, got %d", c.WatcherSessionTTLSeconds)
+	check(c.WatcherLockTimeoutSeconds > 0 && c.WatcherLockTimeoutSeconds < c.WatcherSessionTTLSeconds, "WATCHER_LOCK_TIMEOUT_SECONDS must be positive and less than WATCHER_SESSION_TTL_SECONDS (%d), got %d", c.WatcherSessionTTLSeconds, c.WatcherLockTimeoutSeconds)
+
+	return errors.Join(errs...)
+}
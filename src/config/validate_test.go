@@ -0,0 +1,69 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCertIdentity(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			env: map[string]string{
+				"TLS_CERT_FILE": "server.crt", "TLS_KEY_FILE": "server.key", "TLS_CLIENT_CA_FILE": "ca.crt",
+				"IDENTITY_CERT_NAMESPACE_FIELD": "ou", "IDENTITY_CERT_APPNAME_FIELD": "",
+			},
+		},
+		{
+			name:    "missing client CA",
+			env:     map[string]string{"TLS_CERT_FILE": "server.crt", "TLS_KEY_FILE": "server.key"},
+			wantErr: "requires TLS_CERT_FILE and TLS_CLIENT_CA_FILE",
+		},
+		{
+			name: "unknown namespace field",
+			env: map[string]string{
+				"TLS_CERT_FILE": "server.crt", "TLS_KEY_FILE": "server.key", "TLS_CLIENT_CA_FILE": "ca.crt",
+				"IDENTITY_CERT_NAMESPACE_FIELD": "SERIAL",
+			},
+			wantErr: "IDENTITY_CERT_NAMESPACE_FIELD must be one of",
+		},
+		{
+			name: "unknown app name field",
+			env: map[string]string{
+				"TLS_CERT_FILE": "server.crt", "TLS_KEY_FILE": "server.key", "TLS_CLIENT_CA_FILE": "ca.crt",
+				"IDENTITY_CERT_APPNAME_FIELD": "CNAME",
+			},
+			wantErr: "IDENTITY_CERT_APPNAME_FIELD must be empty or one of",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("IDENTITY_SOURCE", "cert")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			cfg := NewConfig()
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmptyAppNameFieldKeepsHeader(t *testing.T) {
+	t.Setenv("IDENTITY_CERT_APPNAME_FIELD", "")
+	if got := NewConfig().IdentityCertAppNameField; got != "" {
+		t.Fatalf("IdentityCertAppNameField = %q, want empty", got)
+	}
+}
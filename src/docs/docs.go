@@ -0,0 +1,31 @@
+package docs
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+// openAPISpec is the OpenAPI 3 description of the API, with the default header names.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// SwaggerUI is a page rendering the spec served at /openapi.json with Swagger UI.
+//
+//go:embed swagger.html
+var SwaggerUI []byte
+
+// OpenAPISpec returns the OpenAPI spec with the namespace and app header parameters renamed
+// to the configured headers.
+func OpenAPISpec(namespaceHeader, appNameHeader string) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		return nil, fmt.Errorf("parsing OpenAPI spec: %w", err)
+	}
+	// The spec is embedded, so its shape is known
+	parameters := doc["components"].(map[string]any)["parameters"].(map[string]any)
+	parameters["Namespace"].(map[string]any)["name"] = namespaceHeader
+	parameters["AppName"].(map[string]any)["name"] = appNameHeader
+	return json.Marshal(doc)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// NamespaceInfo lists the apps of a namespace and their key counts.
+type NamespaceInfo struct {
+	Namespace string    `json:"namespace"`
+	Keys      int64     `json:"keys"`
+	Apps      []AppInfo `json:"apps"`
+}
+
+// AppInfo is an app of a namespace and the number of keys it holds.
+type AppInfo struct {
+	App  string `json:"app"`
+	Keys int64  `json:"keys"`
+}
+
+// ListNamespaces returns every namespace and app holding keys, with key counts. It reads no
+// values: it jumps from app to app, fetching the first key of the next app and counting the
+// keys of each, so its cost grows with the number of apps rather than keys.
+func (h *Handler) ListNamespaces(c echo.Context) error {
+	ctx := c.Request().Context()
+	kvPrefix := "/" + h.Config.BaseKeyPrefix + "/kv/"
+	end := clientv3.GetPrefixRangeEnd(kvPrefix)
+
+	namespaces := []NamespaceInfo{}
+	from := kvPrefix
+	for {
+		key, found, err := h.Store.FirstKey(ctx, from, end)
+		if err != nil {
+			return storeError(c, err, "Failed to list namespaces")
+		}
+		if !found {
+			break
+		}
+		namespace, rest, ok := strings.Cut(strings.TrimPrefix(key, kvPrefix), "/")
+		appName, _, appOK := strings.Cut(rest, "/")
+		if !ok || !appOK {
+			from = key + "\x00" // Not a namespace/app key, skip it
+			continue
+		}
+		appPrefix := h.getKVPrefix(namespace, appName)
+		count, err := h.Store.Count(ctx, appPrefix)
+		if err != nil {
+			return storeError(c, err, "Failed to list namespaces")
+		}
+
+		// Keys come in order, so the apps of a namespace are next to each other
+		if len(namespaces) == 0 || namespaces[len(namespaces)-1].Namespace != namespace {
+			namespaces = append(namespaces, NamespaceInfo{Namespace: namespace})
+		}
+		info := &namespaces[len(namespaces)-1]
+		info.Apps = append(info.Apps, AppInfo{App: appName, Keys: count})
+		info.Keys += count
+		from = clientv3.GetPrefixRangeEnd(appPrefix)
+	}
+	return c.JSON(http.StatusOK, namespaces)
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// BatchGetRequest represents a request to read several keys at once.
+type BatchGetRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// BatchGetResult is one key of a batch read. Missing keys only have key and found set.
+type BatchGetResult struct {
+	Found bool `json:"found"`
+	KVResponse
+}
+
+// missingKeyResult is the result of a key that does not exist.
+type missingKeyResult struct {
+	Key   string `json:"key"`
+	Found bool   `json:"found"`
+}
+
+// BatchGetKeyValues reads several keys in one request and one etcd transaction. Results are
+// returned in the order of the requested keys, with found: false for keys that do not exist.
+func (h *Handler) BatchGetKeyValues(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req BatchGetRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if len(req.Keys) == 0 {
+		return apierror.JSON(c, http.StatusBadRequest, "Keys must not be empty")
+	}
+	if len(req.Keys) > maxTxnOps {
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("Too many keys (max %d)", maxTxnOps))
+	}
+	prefixedKeys := make([]string, len(req.Keys))
+	for i, key := range req.Keys {
+		if key == "" {
+			return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
+		}
+		prefixedKey, err := h.getKVPrefixedKey(c, key)
+		if err != nil {
+			return err
+		}
+		prefixedKeys[i] = prefixedKey
+	}
+
+	items, err := h.Store.GetMany(ctx, prefixedKeys)
+	if err != nil {
+		return storeError(c, err, "Could not get keys")
+	}
+
+	results := make([]any, 0, len(items))
+	for i, kv := range items {
+		if kv == nil {
+			results = append(results, missingKeyResult{Key: req.Keys[i], Found: false})
+			continue
+		}
+		results = append(results, BatchGetResult{Found: true, KVResponse: h.buildKVResponse(c, kv)})
+	}
+	return c.JSON(http.StatusOK, results)
+}
+
+// BatchOperation is one set or delete of a batch write.
+type BatchOperation struct {
+	Op          string   `json:"op"` // "set" or "delete"
+	Key         string   `json:"key"`
+	Value       string   `json:"value,omitempty"`
+	TTL         int64    `json:"ttl,omitempty"`
+	LeaseID     int64    `json:"lease_id,omitempty"`
+	Checksum    string   `json:"checksum,omitempty"`
+	ContentType string   `json:"content_type,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Encoding    string   `json:"encoding,omitempty"`
+}
+
+// BatchRequest represents a batch of writes applied atomically.
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperationError reports an operation of a batch that failed validation.
+type BatchOperationError struct {
+	Index int    `json:"index"`
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// BatchKeyValues applies several sets and deletes in one etcd transaction. Every operation is
+// validated first, and if any is invalid nothing is written.
+func (h *Handler) BatchKeyValues(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req BatchRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if len(req.Operations) == 0 {
+		return apierror.JSON(c, http.StatusBadRequest, "Operations must not be empty")
+	}
+	if len(req.Operations) > maxTxnOps {
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("Too many operations (max %d)", maxTxnOps))
+	}
+
+	kvs := make([]KeyValue, len(req.Operations))
+	prefixedKeys := make([]string, len(req.Operations))
+	seen := make(map[string]bool, len(req.Operations))
+	var invalid []BatchOperationError
+	for i, op := range req.Operations {
+		if msg := h.validateBatchOperation(c, &op, seen, &kvs[i], &prefixedKeys[i]); msg != "" {
+			invalid = append(invalid, BatchOperationError{Index: i, Key: op.Key, Error: msg})
+		}
+	}
+	if len(invalid) > 0 {
+		return apierror.JSONWithDetails(c, http.StatusBadRequest, "Invalid operations", map[string]any{"failed": invalid})
+	}
+	if err := h.checkSiloLimits(ctx, h.getNamespace(c), h.getAppName(c)); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return storeError(c, err, "Could not apply batch")
+	}
+
+	ops := make([]store.BatchOp, 0, len(req.Operations))
+	var grantedLeases []int64
+	revokeGranted := func() {
+		for _, leaseID := range grantedLeases {
+			h.Store.Revoke(context.WithoutCancel(ctx), leaseID)
+		}
+	}
+	for i, op := range req.Operations {
+		if op.Op == "delete" {
+			ops = append(ops, store.BatchOp{Item: &store.KVItem{Key: prefixedKeys[i]}, Delete: true})
+			continue
+		}
+		granted := kvs[i].LeaseID == 0 && kvs[i].TTL > 0
+		kvItem, err := h.prepareKVItem(ctx, prefixedKeys[i], &kvs[i])
+		if err != nil {
+			revokeGranted()
+			if he, ok := err.(*echo.HTTPError); ok {
+				return he
+			}
+			return storeError(c, err, "Could not apply batch")
+		}
+		if granted {
+			grantedLeases = append(grantedLeases, kvItem.LeaseID)
+		}
+		ops = append(ops, store.BatchOp{Item: kvItem})
+	}
+
+	revision, prev, err := h.Store.Batch(ctx, ops)
+	if err != nil {
+		revokeGranted()
+		return storeError(c, err, "Could not apply batch")
+	}
+
+	// Blocking webhooks fire per key, as if each operation had been applied on its own
+	var webhookResponses []WebhookResponse
+	for i, op := range ops {
+		switch {
+		case op.Delete && prev[i] != nil:
+			webhookResponses = append(webhookResponses, h.deliverBlockingWebhooks(ctx, prefixedKeys[i], EventDelete, prev[i], prev[i])...)
+		case op.Delete:
+		case prev[i] != nil:
+			webhookResponses = append(webhookResponses, h.deliverBlockingWebhooks(ctx, prefixedKeys[i], EventUpdate, op.Item, prev[i])...)
+		default:
+			webhookResponses = append(webhookResponses, h.deliverBlockingWebhooks(ctx, prefixedKeys[i], EventCreate, op.Item, nil)...)
+		}
+	}
+	response := map[string]any{
+		"revision": revision,
+		"applied":  len(ops),
+	}
+	if len(webhookResponses) > 0 {
+		response["webhook_responses"] = webhookResponses
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// validateBatchOperation checks one operation of a batch, filling in kv and prefixedKey for it.
+// It returns an error message, or an empty string if the operation is valid.
+func (h *Handler) validateBatchOperation(c echo.Context, op *BatchOperation, seen map[string]bool, kv *KeyValue, prefixedKey *string) string {
+	if op.Op != "set" && op.Op != "delete" {
+		return "Op must be set or delete"
+	}
+	if op.Key == "" {
+		return errKeyEmpty
+	}
+	// etcd rejects a transaction that touches the same key twice
+	if seen[op.Key] {
+		return "Duplicate key"
+	}
+	seen[op.Key] = true
+	key, err := h.getKVPrefixedKey(c, op.Key)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return fmt.Sprint(he.Message)
+		}
+		return err.Error()
+	}
+	*prefixedKey = key
+	if op.Op == "delete" {
+		return ""
+	}
+
+	*kv = KeyValue{
+		Key:         op.Key,
+		Value:       op.Value,
+		TTL:         op.TTL,
+		LeaseID:     op.LeaseID,
+		Checksum:    op.Checksum,
+		ContentType: op.ContentType,
+		Tags:        op.Tags,
+		Encoding:    op.Encoding,
+	}
+	if msg := h.validateKeyValue(kv); msg != "" {
+		return msg
+	}
+	// If TTL is not set, use default TTL
+	if kv.TTL == 0 && kv.LeaseID == 0 {
+		kv.TTL = int64(h.Config.DefaultTTL)
+	}
+	if err := h.applyTTLJitter(c, kv); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return fmt.Sprint(he.Message)
+		}
+		return err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// maxTxnOps keeps a batch within etcd's default limit of operations per transaction.
+const maxTxnOps = 128
+
+// BulkCASItem is one conditional write of a bulk compare-and-swap.
+type BulkCASItem struct {
+	Key              string   `json:"key"`
+	Value            string   `json:"value"`
+	ExpectedRevision int64    `json:"expected_revision"` // Revision the key must have, 0 if it must not exist
+	TTL              int64    `json:"ttl,omitempty"`
+	LeaseID          int64    `json:"lease_id,omitempty"`
+	Checksum         string   `json:"checksum,omitempty"`
+	ContentType      string   `json:"content_type,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	Encoding         string   `json:"encoding,omitempty"`
+}
+
+// BulkCASRequest represents a bulk compare-and-swap request.
+type BulkCASRequest struct {
+	Items []BulkCASItem `json:"items"`
+}
+
+// BulkCASFailure reports a key whose revision precondition did not hold.
+type BulkCASFailure struct {
+	Key              string `json:"key"`
+	ExpectedRevision int64  `json:"expected_revision"`
+	CurrentRevision  int64  `json:"current_revision"` // 0 if the key does not exist
+}
+
+// BulkCompareAndSwap writes several keys in one etcd transaction, only if every key still has
+// its expected revision. Either all keys are written or none is.
+func (h *Handler) BulkCompareAndSwap(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req BulkCASRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if len(req.Items) == 0 {
+		return apierror.JSON(c, http.StatusBadRequest, "Items must not be empty")
+	}
+	if len(req.Items) > maxTxnOps {
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("Too many items (max %d)", maxTxnOps))
+	}
+
+	kvs := make([]KeyValue, len(req.Items))
+	prefixedKeys := make([]string, len(req.Items))
+	seen := make(map[string]bool, len(req.Items))
+	for i, item := range req.Items {
+		if item.Key == "" {
+			return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
+		}
+		if seen[item.Key] {
+			return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("Duplicate key %q", item.Key))
+		}
+		seen[item.Key] = true
+		if item.ExpectedRevision < 0 {
+			return apierror.JSON(c, http.StatusBadRequest, "expected_revision must not be negative")
+		}
+		kvs[i] = KeyValue{
+			Key:         item.Key,
+			Value:       item.Value,
+			TTL:         item.TTL,
+			LeaseID:     item.LeaseID,
+			Checksum:    item.Checksum,
+			ContentType: item.ContentType,
+			Tags:        item.Tags,
+			Encoding:    item.Encoding,
+		}
+		if msg := h.validateKeyValue(&kvs[i]); msg != "" {
+			return apierror.JSON(c, http.StatusBadRequest, item.Key+": "+msg)
+		}
+		if kvs[i].TTL == 0 && kvs[i].LeaseID == 0 {
+			kvs[i].TTL = int64(h.Config.DefaultTTL)
+		}
+		if err := h.applyTTLJitter(c, &kvs[i]); err != nil {
+			return err
+		}
+		prefixedKey, err := h.getKVPrefixedKey(c, item.Key)
+		if err != nil {
+			return err
+		}
+		prefixedKeys[i] = prefixedKey
+	}
+	if err := h.checkSiloLimits(ctx, h.getNamespace(c), h.getAppName(c)); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return storeError(c, err, "Could not update key-value pairs")
+	}
+
+	casItems := make([]store.CASItem, 0, len(req.Items))
+	var grantedLeases []int64
+	revokeGranted := func() {
+		for _, leaseID := range grantedLeases {
+			h.Store.Revoke(context.WithoutCancel(ctx), leaseID)
+		}
+	}
+	for i := range kvs {
+		granted := kvs[i].LeaseID == 0 && kvs[i].TTL > 0
+		kvItem, err := h.prepareKVItem(ctx, prefixedKeys[i], &kvs[i])
+		if err != nil {
+			revokeGranted()
+			if he, ok := err.(*echo.HTTPError); ok {
+				return he
+			}
+			return storeError(c, err, "Could not update key-value pairs")
+		}
+		if granted {
+			grantedLeases = append(grantedLeases, kvItem.LeaseID)
+		}
+		casItems = append(casItems, store.CASItem{Item: kvItem, ExpectedRevision: req.Items[i].ExpectedRevision})
+	}
+
+	revision, prev, failures, err := h.Store.BulkCAS(ctx, casItems)
+	if err != nil {
+		revokeGranted()
+		return storeError(c, err, "Could not update key-value pairs")
+	}
+	if len(failures) > 0 {
+		revokeGranted()
+		failed := make([]BulkCASFailure, 0, len(failures))
+		for _, failure := range failures {
+			key, _ := h.getOriginalKVKey(c, failure.Key)
+			failed = append(failed, BulkCASFailure{
+				Key:              key,
+				ExpectedRevision: failure.ExpectedRevision,
+				CurrentRevision:  failure.CurrentRevision,
+			})
+		}
+		return apierror.JSONWithDetails(c, http.StatusConflict, "Revision precondition failed", map[string]any{"failed": failed})
+	}
+
+	// Blocking webhooks fire per key, as if each key had been written on its own
+	var webhookResponses []WebhookResponse
+	for i, cas := range casItems {
+		event := EventUpdate
+		if prev[i] == nil {
+			event = EventCreate
+		}
+		webhookResponses = append(webhookResponses, h.deliverBlockingWebhooks(ctx, prefixedKeys[i], event, cas.Item, prev[i])...)
+	}
+	response := map[string]any{
+		"revision": revision,
+		"updated":  len(casItems),
+	}
+	if len(webhookResponses) > 0 {
+		response["webhook_responses"] = webhookResponses
+	}
+	return c.JSON(http.StatusOK, response)
+}
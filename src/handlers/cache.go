@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// setCacheHeaders sets a Cache-Control header derived from the remaining TTL of the returned items.
+// A list is only cacheable as long as its shortest-lived item.
+// Responses depend on the caller's namespace, app and credentials, so they are private to the
+// caller and vary by the headers carrying them; a shared cache must never serve one tenant's
+// values to another.
+func (h *Handler) setCacheHeaders(c echo.Context, items []*store.KVItem) {
+	header := c.Response().Header()
+	header.Add("Vary", h.Config.HeaderNamespace+", "+h.Config.HeaderAppName+", Authorization, X-API-Key")
+
+	maxAge := int64(-1)
+	for _, kv := range items {
+		age := int64(h.Config.CacheDefaultMaxAge)
+		if kv.TTL != nil {
+			age = *kv.TTL * int64(h.Config.CacheMaxAgePercent) / 100
+		}
+		if maxAge < 0 || age < maxAge {
+			maxAge = age
+		}
+	}
+
+	if maxAge <= 0 {
+		header.Set("Cache-Control", "private, no-cache")
+		return
+	}
+	value := "private, max-age=" + strconv.FormatInt(maxAge, 10)
+	if h.Config.CacheStaleWhileRevalidate > 0 {
+		value += ", stale-while-revalidate=" + strconv.Itoa(h.Config.CacheStaleWhileRevalidate)
+	}
+	header.Set("Cache-Control", value)
+}
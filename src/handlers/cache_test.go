@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/config"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+func TestSetCacheHeaders(t *testing.T) {
+	ttl := func(seconds int64) *int64 { return &seconds }
+	h := &Handler{Config: &config.Config{
+		HeaderNamespace:           "KV-Namespace",
+		HeaderAppName:             "KV-App-Name",
+		CacheMaxAgePercent:        50,
+		CacheStaleWhileRevalidate: 30,
+	}}
+
+	tests := []struct {
+		name  string
+		items []*store.KVItem
+		want  string
+	}{
+		{"no TTL", []*store.KVItem{{}}, "private, no-cache"},
+		{"TTL", []*store.KVItem{{TTL: ttl(100)}}, "private, max-age=50, stale-while-revalidate=30"},
+		{"shortest TTL", []*store.KVItem{{TTL: ttl(100)}, {TTL: ttl(20)}}, "private, max-age=10, stale-while-revalidate=30"},
+		{"expired", []*store.KVItem{{TTL: ttl(0)}}, "private, no-cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/kv/k", nil), rec)
+			h.setCacheHeaders(c, tt.items)
+			if got := rec.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+			}
+			if got, want := rec.Header().Get("Vary"), "KV-Namespace, KV-App-Name, Authorization, X-API-Key"; got != want {
+				t.Errorf("Vary = %q, want %q", got, want)
+			}
+		})
+	}
+}
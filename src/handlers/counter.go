@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/middleware"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// IncrementRequest represents a counter increment request.
+type IncrementRequest struct {
+	Delta *int64 `json:"delta,omitempty"` // Amount to add, may be negative, defaults to 1
+	Min   *int64 `json:"min,omitempty"`   // Lowest value the counter may reach, optional
+	Max   *int64 `json:"max,omitempty"`   // Highest value the counter may reach, optional
+	TTL   int64  `json:"ttl,omitempty"`   // New TTL in seconds, optional, keeps the current lease if unset
+}
+
+// IncrementKeyValue atomically adds delta to an integer key, creating it from 0 if missing.
+func (h *Handler) IncrementKeyValue(c echo.Context) error {
+	key := c.Param("key")
+	if key == "" {
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
+	}
+	var req IncrementRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	delta := int64(1)
+	if req.Delta != nil {
+		delta = *req.Delta
+	}
+	return h.incrementKeyValue(c, key, delta, &req)
+}
+
+// DecrementKeyValue atomically subtracts delta from an integer key, creating it from 0 if missing.
+func (h *Handler) DecrementKeyValue(c echo.Context) error {
+	key := c.Param("key")
+	if key == "" {
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
+	}
+	var req IncrementRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	delta := int64(1)
+	if req.Delta != nil {
+		if *req.Delta == math.MinInt64 {
+			return apierror.JSON(c, http.StatusBadRequest, "Delta out of range")
+		}
+		delta = *req.Delta
+	}
+	return h.incrementKeyValue(c, key, -delta, &req)
+}
+
+// incrementKeyValue applies an increment of delta to key and writes the response.
+func (h *Handler) incrementKeyValue(c echo.Context, key string, delta int64, req *IncrementRequest) error {
+	ctx := c.Request().Context()
+	if req.Min != nil && req.Max != nil && *req.Min > *req.Max {
+		return apierror.JSON(c, http.StatusBadRequest, "min must not be greater than max")
+	}
+	if req.TTL < 0 || req.TTL > int64(h.Config.MaxTTLSeconds) {
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("TTL must be between 0 and %d seconds", h.Config.MaxTTLSeconds))
+	}
+	prefixedKey, err := h.getKVPrefixedKey(c, key)
+	if err != nil {
+		return err
+	}
+	if err := h.checkSiloLimits(ctx, h.getNamespace(c), h.getAppName(c)); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return storeError(c, err, "Could not increment key")
+	}
+
+	value, created, err := h.Store.IncrementWithBounds(ctx, prefixedKey, delta, store.CounterBounds{Min: req.Min, Max: req.Max}, req.TTL, middleware.RequestIDFromContext(ctx))
+	var boundErr *store.CounterBoundError
+	switch {
+	case errors.As(err, &boundErr):
+		return apierror.JSONWithDetails(c, http.StatusConflict, "Counter would pass its "+boundErr.Bound, map[string]any{
+			"key":   key,
+			"value": boundErr.Current,
+			"bound": boundErr.Bound,
+		})
+	case errors.Is(err, store.ErrNotInteger):
+		return apierror.JSON(c, http.StatusConflict, "Value is not an integer")
+	case errors.Is(err, store.ErrIncrementConflict):
+		return apierror.JSON(c, http.StatusConflict, "Key changed concurrently, retry")
+	case errors.Is(err, store.ErrValueTooLarge):
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("Value too large (max %d bytes)", h.Config.MaxValueSize))
+	case err != nil:
+		return storeError(c, err, "Could not increment key")
+	}
+
+	event := EventUpdate
+	var oldItem *store.KVItem
+	if created {
+		event = EventCreate
+	} else {
+		oldItem = &store.KVItem{Key: prefixedKey, Value: strconv.FormatInt(value-delta, 10)}
+	}
+	kvItem := &store.KVItem{Key: prefixedKey, Value: strconv.FormatInt(value, 10)}
+	response := map[string]any{
+		"key":   key,
+		"value": value,
+	}
+	if responses := h.deliverBlockingWebhooks(ctx, prefixedKey, event, kvItem, oldItem); len(responses) > 0 {
+		response["webhook_responses"] = responses
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/docs"
+)
+
+// GetOpenAPISpec returns the OpenAPI 3 description of the API, using the configured namespace
+// and app headers.
+func (h *Handler) GetOpenAPISpec(c echo.Context) error {
+	h.openAPIOnce.Do(func() {
+		h.openAPISpec, h.openAPIErr = docs.OpenAPISpec(h.Config.HeaderNamespace, h.Config.HeaderAppName)
+	})
+	if h.openAPIErr != nil {
+		return h.openAPIErr
+	}
+	return c.JSONBlob(http.StatusOK, h.openAPISpec)
+}
+
+// GetDocs returns a Swagger UI page for the OpenAPI spec.
+func (h *Handler) GetDocs(c echo.Context) error {
+	return c.HTMLBlob(http.StatusOK, docs.SwaggerUI)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// parseDryRun parses the ?dry_run= query parameter of a write.
+func parseDryRun(c echo.Context) (bool, error) {
+	switch c.QueryParam("dry_run") {
+	case "", "false":
+		return false, nil
+	case "true":
+		return true, nil
+	default:
+		return false, echo.NewHTTPError(http.StatusBadRequest, "Dry_run must be true or false")
+	}
+}
+
+// checkDryRun runs the checks of a write that need etcd, without writing anything: kv.LeaseID
+// must be a live lease of the namespace/app and, if mustNotExist, prefixedKey must not exist yet.
+// Validation that needs no etcd access has already run by then.
+func (h *Handler) checkDryRun(ctx context.Context, prefixedKey string, kv *KeyValue, mustNotExist bool) error {
+	if kv.LeaseID != 0 {
+		ttl, err := h.writeLeaseTTL(ctx, prefixedKey, kv.LeaseID)
+		if err != nil {
+			return err
+		}
+		kv.TTL = ttl
+	}
+	if mustNotExist {
+		_, found, err := h.Store.Stat(ctx, prefixedKey)
+		if err != nil {
+			return err
+		}
+		if found {
+			return echo.NewHTTPError(http.StatusConflict, "Key already exists")
+		}
+	}
+	return nil
+}
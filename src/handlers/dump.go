@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// DumpItem is one key in an export, in the format accepted back by import.
+type DumpItem struct {
+	Key         string   `json:"key"`
+	Value       string   `json:"value"`
+	TTL         int64    `json:"ttl,omitempty"` // Remaining TTL in seconds, 0 for none
+	ContentType string   `json:"content_type,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Encoding    string   `json:"encoding,omitempty"`
+}
+
+// newDumpItem builds the export entry of kv, stored under namespacePrefix.
+func newDumpItem(namespacePrefix string, kv *store.KVItem) DumpItem {
+	item := DumpItem{
+		Key:         strings.TrimPrefix(kv.Key, namespacePrefix),
+		Value:       encodedValue(kv),
+		ContentType: kv.ContentType,
+		Tags:        kv.Tags,
+		Encoding:    kv.Encoding,
+	}
+	if kv.TTL != nil && *kv.TTL > 0 {
+		item.TTL = *kv.TTL
+	}
+	return item
+}
+
+// DumpKeyValues streams every key of the caller's namespace/app, optionally narrowed by
+// ?prefix=, for backups and migrations. Keys are read page by page at a single revision, so
+// the export is a consistent point-in-time copy without holding it all in memory.
+func (h *Handler) DumpKeyValues(c echo.Context) error {
+	ctx := c.Request().Context()
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	if format != "ndjson" && format != "json" {
+		return apierror.JSON(c, http.StatusBadRequest, "Format must be one of: json, ndjson")
+	}
+	namespacePrefix, err := h.getKVPrefixedKey(c, "")
+	if err != nil {
+		return err
+	}
+	prefix := namespacePrefix + c.QueryParam("prefix")
+
+	// Read the first page before answering, so etcd errors can still get a proper status
+	items, next, rev, err := h.Store.PageAtRevision(ctx, prefix, scanBatchSize, "", 0)
+	if err != nil {
+		return storeError(c, err, "Could not export keys")
+	}
+
+	res := c.Response()
+	if format == "json" {
+		res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	} else {
+		res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	}
+	res.Header().Set("X-KV-Revision", strconv.FormatInt(rev, 10))
+	res.WriteHeader(http.StatusOK)
+
+	count := 0
+	write := func(kv *store.KVItem) error {
+		data, err := json.Marshal(newDumpItem(namespacePrefix, kv))
+		if err != nil {
+			return err
+		}
+		switch {
+		case format == "ndjson":
+			data = append(data, '\n')
+		case count == 0:
+			data = append([]byte("["), data...)
+		default:
+			data = append([]byte(","), data...)
+		}
+		count++
+		_, err = res.Write(data)
+		return err
+	}
+
+	for {
+		for _, kv := range items {
+			if err := write(kv); err != nil {
+				return nil // Client went away
+			}
+		}
+		res.Flush()
+		if next == "" {
+			break
+		}
+		items, next, _, err = h.Store.PageAtRevision(ctx, prefix, scanBatchSize, next, rev)
+		if err != nil {
+			// Headers are already sent, the client sees a truncated body
+			if errors.Is(err, store.ErrCompacted) {
+				log.Printf("Export of %s stopped: revision %d was compacted", prefix, rev)
+			} else {
+				log.Printf("Error exporting prefix %s: %v", prefix, err)
+			}
+			return nil
+		}
+	}
+	if format == "json" {
+		if count == 0 {
+			res.Write([]byte("["))
+		}
+		res.Write([]byte("]\n"))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// encodingBase64 marks a value sent and returned as standard base64, so binary data survives JSON.
+const encodingBase64 = "base64"
+
+var (
+	errUnknownEncoding = errors.New("Encoding must be base64")
+	errInvalidBase64   = errors.New("Value is not valid base64")
+)
+
+// decodeValue returns the raw bytes of a value sent with the given encoding.
+func decodeValue(value, encoding string) (string, error) {
+	switch encoding {
+	case "":
+		return value, nil
+	case encodingBase64:
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", errInvalidBase64
+		}
+		return string(raw), nil
+	default:
+		return "", errUnknownEncoding
+	}
+}
+
+// encodedValue returns the value of kv as the client sent it, re-encoding binary values.
+func encodedValue(kv *store.KVItem) string {
+	if kv.Encoding == encodingBase64 {
+		return base64.StdEncoding.EncodeToString([]byte(kv.Value))
+	}
+	return kv.Value
+}
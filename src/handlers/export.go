@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+)
+
+// exportFormat describes how a namespace/app is rendered as a config file.
+type exportFormat struct {
+	contentType string
+	extension   string
+	// render writes the sorted key-value pairs, or returns an error message.
+	render func(keys []string, values map[string]string) ([]byte, string)
+}
+
+var exportFormats = map[string]exportFormat{
+	"json":       {echo.MIMEApplicationJSONCharsetUTF8, "json", renderJSON},
+	"dotenv":     {echo.MIMETextPlainCharsetUTF8, "env", renderDotenv},
+	"properties": {"text/x-java-properties; charset=ISO-8859-1", "properties", renderProperties},
+	"yaml":       {"application/yaml; charset=UTF-8", "yaml", renderYAML},
+}
+
+// ExportKeyValues renders the keys of the caller's namespace/app, optionally narrowed
+// by ?prefix=, as a downloadable config file in the ?format= requested.
+func (h *Handler) ExportKeyValues(c echo.Context) error {
+	ctx := c.Request().Context()
+	formatName := c.QueryParam("format")
+	if formatName == "" {
+		formatName = "json"
+	}
+	format, ok := exportFormats[formatName]
+	if !ok {
+		names := make([]string, 0, len(exportFormats))
+		for name := range exportFormats {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return apierror.JSON(c, http.StatusBadRequest, "Format must be one of: "+strings.Join(names, ", "))
+	}
+	prefixedKey, err := h.getKVPrefixedKey(c, c.QueryParam("prefix"))
+	if err != nil {
+		return err
+	}
+
+	items, err := h.Store.All(ctx, prefixedKey)
+	if err != nil {
+		return storeError(c, err, "Could not list keys")
+	}
+	keys := make([]string, 0, len(items))
+	values := make(map[string]string, len(items))
+	for _, kv := range items {
+		key, err := h.getOriginalKVKey(c, kv.Key)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+		// Binary values stay base64, raw bytes would corrupt the file
+		values[key] = encodedValue(kv)
+	}
+	slices.Sort(keys)
+
+	body, msg := format.render(keys, values)
+	if msg != "" {
+		return apierror.JSON(c, http.StatusConflict, msg)
+	}
+	filename := h.getAppName(c) + "." + format.extension
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.Blob(http.StatusOK, format.contentType, body)
+}
+
+// renderJSON renders the pairs as a flat JSON object.
+func renderJSON(keys []string, values map[string]string) ([]byte, string) {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return nil, err.Error()
+	}
+	return append(data, '\n'), ""
+}
+
+// dotenvName turns a key into a valid environment variable name by replacing every
+// character outside [A-Za-z0-9_] with an underscore, and prefixing a leading digit.
+func dotenvName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// renderDotenv renders the pairs as KEY="value" lines. Values are double-quoted with
+// backslashes, quotes, dollar signs and line breaks escaped. Two keys that map to the
+// same variable name are reported instead of silently overwriting each other.
+func renderDotenv(keys []string, values map[string]string) ([]byte, string) {
+	valueEscaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`)
+	seen := make(map[string]string, len(keys))
+	var b strings.Builder
+	for _, key := range keys {
+		name := dotenvName(key)
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Sprintf("Keys %q and %q both map to variable %s", other, key, name)
+		}
+		seen[name] = key
+		b.WriteString(name + `="` + valueEscaper.Replace(values[key]) + "\"\n")
+	}
+	return []byte(b.String()), ""
+}
+
+// escapeProperty escapes s for a .properties file. Keys additionally escape the
+// separators and every space; values only escape a leading space. Characters outside
+// printable ASCII are written as \uXXXX escapes, since the format is ISO-8859-1.
+func escapeProperty(s string, isKey bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == ' ' && (isKey || i == 0):
+			b.WriteString(`\ `)
+		case (r == '=' || r == ':' || r == '#' || r == '!') && (isKey || i == 0):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			if r == utf8.RuneError {
+				r = 0xfffd
+			}
+			if r > 0xffff {
+				// Characters outside the BMP are written as a UTF-16 surrogate pair
+				r -= 0x10000
+				fmt.Fprintf(&b, `\u%04x\u%04x`, 0xd800+(r>>10), 0xdc00+(r&0x3ff))
+			} else {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// renderProperties renders the pairs as key=value lines of a Java .properties file.
+func renderProperties(keys []string, values map[string]string) ([]byte, string) {
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(escapeProperty(key, true) + "=" + escapeProperty(values[key], false) + "\n")
+	}
+	return []byte(b.String()), ""
+}
+
+// renderYAML renders the pairs as a flat YAML mapping. Keys and values are written as
+// double-quoted scalars, whose escaping rules are a superset of JSON strings.
+func renderYAML(keys []string, values map[string]string) ([]byte, string) {
+	var b strings.Builder
+	for _, key := range keys {
+		quotedKey, _ := json.Marshal(key)
+		quotedValue, _ := json.Marshal(values[key])
+		b.WriteString(string(quotedKey) + ": " + string(quotedValue) + "\n")
+	}
+	if len(keys) == 0 {
+		b.WriteString("{}\n")
+	}
+	return []byte(b.String()), ""
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExportKeyValuesKeepsBinaryValuesEncoded(t *testing.T) {
+	h := newTestHandler(t, nil)
+	c, rec := newTestContext(http.MethodPost, "/kv", `{"key":"bin","value":"AP8K","encoding":"base64"}`)
+	if status := serve(c, rec, h.CreateKeyValue); status != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", status, rec.Body)
+	}
+
+	for format, want := range map[string]string{
+		"json":       `"bin": "AP8K"`,
+		"dotenv":     `bin="AP8K"`,
+		"properties": `bin=AP8K`,
+		"yaml":       `"bin": "AP8K"`,
+	} {
+		c, rec := newTestContext(http.MethodGet, "/kv?format="+format, "")
+		if status := serve(c, rec, h.ExportKeyValues); status != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", format, status, rec.Body)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, want) {
+			t.Errorf("%s: body %q does not contain %q", format, body, want)
+		}
+	}
+}
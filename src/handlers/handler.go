@@ -1,23 +1,61 @@
 package handlers
 
 import (
+	"net/http"
+	"sync"
+
 	"github.com/labstack/echo/v4"
 	"github.com/mrofi/simple-golang-kv/src/config"
+	"github.com/mrofi/simple-golang-kv/src/redact"
 	"github.com/mrofi/simple-golang-kv/src/store"
 )
 
 // Handler wraps the etcd-backed store.
 type Handler struct {
-	Config *config.Config
-	Store  *store.Store
+	Config   *config.Config
+	Store    *store.Store
+	Redactor *redact.Redactor
+
+	webhookTransport     *http.Transport
+	webhookAddresses     webhookAddressPolicy // Addresses webhooks may be delivered to, see validateWebhookEndpoint
+	webhookIndex         *webhookIndex        // namespace/apps with webhooks, maintained by the watcher
+	deliveries           *deliveryTracker
+	watcher              watcherState // State of this pod's watcher, see GetWatcherStatus
+	webhookTLSTransports sync.Map     // Transports of webhooks with their own TLS settings, see getWebhookTransport
+	knownSilos           sync.Map     // namespace/app pairs already registered, see checkSiloLimits
+	keyPatterns          sync.Map     // Compiled regex key patterns of webhooks, see keyRegexp
+	valueFilters         sync.Map     // Parsed value filters of webhooks, see parsedValueFilter
+
+	openAPIOnce sync.Once // Renders openAPISpec on first use, see GetOpenAPISpec
+	openAPISpec []byte
+	openAPIErr  error
 }
 
-func NewHandler(Store *store.Store) *Handler {
+func NewHandler(Store *store.Store) (*Handler, error) {
 	return NewHandlerWithConfig(Store, config.AppConfig)
 }
 
-func NewHandlerWithConfig(Store *store.Store, cfg *config.Config) *Handler {
-	return &Handler{Store: Store, Config: cfg}
+func NewHandlerWithConfig(Store *store.Store, cfg *config.Config) (*Handler, error) {
+	allowedNets, err := cfg.WebhookAllowedNets()
+	if err != nil {
+		return nil, err
+	}
+	webhookAddresses := webhookAddressPolicy{allowed: allowedNets}
+	webhookTransport, err := newWebhookTransport(cfg, webhookAddresses)
+	if err != nil {
+		return nil, err
+	}
+	h := &Handler{
+		Store:            Store,
+		Config:           cfg,
+		Redactor:         redact.NewFromConfig(cfg),
+		webhookTransport: webhookTransport,
+		webhookAddresses: webhookAddresses,
+		webhookIndex:     newWebhookIndex(),
+		deliveries:       newDeliveryTracker(cfg.WebhookQueueSize),
+	}
+	h.startDeliveryWorkers(cfg.WebhookWorkers)
+	return h, nil
 }
 
 // getNamespace retrieves the namespace from headers or defaults.
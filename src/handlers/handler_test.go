@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/config"
+	"github.com/mrofi/simple-golang-kv/src/store"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// newTestHandler returns a handler on the etcd cluster listed in ETCD_TEST_ENDPOINTS, skipping
+// the test if it is not set. The handler uses a base key prefix of its own, deleted after the
+// test. configure, if not nil, adjusts the configuration first.
+func newTestHandler(t testing.TB, configure func(*config.Config)) *Handler {
+	t.Helper()
+	endpoints := os.Getenv("ETCD_TEST_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("ETCD_TEST_ENDPOINTS not set, skipping test against etcd")
+	}
+	cfg := config.NewConfig()
+	cfg.ETCDEndpoints = strings.Split(endpoints, ",")
+	cfg.BaseKeyPrefix = fmt.Sprintf("kvtest-%d", time.Now().UnixNano())
+	if configure != nil {
+		configure(cfg)
+	}
+
+	s, err := store.NewStoreWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("connecting to etcd: %v", err)
+	}
+	t.Cleanup(func() {
+		s.Client().Delete(context.Background(), "/"+cfg.BaseKeyPrefix+"/", clientv3.WithPrefix())
+		s.Close()
+	})
+	h, err := NewHandlerWithConfig(s, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// newTestContext returns a context for a request to the default namespace/app, with the given
+// path parameters as name, value pairs.
+func newTestContext(method, target, body string, params ...string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	e := echo.New()
+	e.GET("/:a/:b/:c", nil) // Contexts only have room for as many parameters as a route has
+	c := e.NewContext(req, rec)
+	var names, values []string
+	for i := 0; i+1 < len(params); i += 2 {
+		names = append(names, params[i])
+		values = append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	return c, rec
+}
+
+// serve runs handler like the server does, rendering an error it returns, and returns the
+// response status.
+func serve(c echo.Context, rec *httptest.ResponseRecorder, handler echo.HandlerFunc) int {
+	if err := handler(c); err != nil {
+		apierror.HTTPErrorHandler(err, c)
+	}
+	return rec.Code
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+)
+
+// readyzTimeout bounds how long a readiness check waits for etcd.
+const readyzTimeout = 2 * time.Second
+
+// Healthz is a cheap liveness check: it only reports that the process is serving requests.
+func (h *Handler) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz reports whether etcd is reachable, returning 503 if it is not, so traffic is only
+// routed to pods that can serve it.
+func (h *Handler) Readyz(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), readyzTimeout)
+	defer cancel()
+
+	status, err := h.Store.Status(ctx)
+	if err != nil {
+		return apierror.JSONWithDetails(c, http.StatusServiceUnavailable, "etcd is unreachable", map[string]string{"status": "unavailable"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"status":        "ok",
+		"etcd_endpoint": status.Endpoint,
+		"etcd_version":  status.Version,
+	})
+}
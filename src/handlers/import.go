@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// maxImportErrors caps the per-key errors reported by an import; the failed count is exact.
+const maxImportErrors = 100
+
+// Import modes
+const (
+	importOverwrite    = "overwrite"     // Write every key, replacing existing ones
+	importSkipExisting = "skip-existing" // Only create keys that do not exist yet
+)
+
+// ImportSummary reports the outcome of an import.
+type ImportSummary struct {
+	Written int                   `json:"written"`
+	Skipped int                   `json:"skipped"` // Keys that already existed, in skip-existing mode
+	Failed  int                   `json:"failed"`
+	Errors  []BatchOperationError `json:"errors,omitempty"` // First failures, Index is the item's position
+}
+
+// fail records a failed item.
+func (s *ImportSummary) fail(index int, key, msg string) {
+	s.Failed++
+	if len(s.Errors) < maxImportErrors {
+		s.Errors = append(s.Errors, BatchOperationError{Index: index, Key: key, Error: msg})
+	}
+}
+
+// ImportKeyValues writes the keys of an export, a JSON array or NDJSON of DumpItem, into the
+// caller's namespace/app. Each key is validated and written on its own, so one bad key does
+// not stop the others, and delivered to blocking webhooks before the next is written.
+func (h *Handler) ImportKeyValues(c echo.Context) error {
+	ctx := c.Request().Context()
+	mode := c.QueryParam("mode")
+	if mode == "" {
+		mode = importOverwrite
+	}
+	if mode != importOverwrite && mode != importSkipExisting {
+		return apierror.JSON(c, http.StatusBadRequest, "Mode must be overwrite or skip-existing")
+	}
+	if err := h.checkSiloLimits(ctx, h.getNamespace(c), h.getAppName(c)); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return storeError(c, err, "Could not import keys")
+	}
+
+	summary := ImportSummary{}
+	err := decodeDumpItems(c.Request().Body, func(index int, item DumpItem) {
+		kv := KeyValue{
+			Key:         item.Key,
+			Value:       item.Value,
+			TTL:         item.TTL,
+			ContentType: item.ContentType,
+			Tags:        item.Tags,
+			Encoding:    item.Encoding,
+		}
+		if kv.Key == "" {
+			summary.fail(index, kv.Key, errKeyEmpty)
+			return
+		}
+		if msg := h.validateKeyValue(&kv); msg != "" {
+			summary.fail(index, kv.Key, msg)
+			return
+		}
+		if kv.TTL == 0 {
+			kv.TTL = int64(h.Config.DefaultTTL)
+		}
+		prefixedKey, err := h.getKVPrefixedKey(c, kv.Key)
+		if err != nil {
+			summary.fail(index, kv.Key, fmt.Sprint(err.(*echo.HTTPError).Message))
+			return
+		}
+
+		var kvItem, prev *store.KVItem
+		if mode == importOverwrite {
+			kvItem, prev, err = h.putKeyValue(ctx, prefixedKey, &kv)
+		} else {
+			kvItem, err = h.createKeyValue(ctx, prefixedKey, &kv)
+			if he, ok := err.(*echo.HTTPError); ok && he.Code == http.StatusConflict {
+				summary.Skipped++
+				return
+			}
+		}
+		if err != nil {
+			if he, ok := err.(*echo.HTTPError); ok {
+				summary.fail(index, kv.Key, fmt.Sprint(he.Message))
+			} else {
+				summary.fail(index, kv.Key, "Could not write key")
+			}
+			return
+		}
+		summary.Written++
+		// Like single writes, each key waits for its blocking webhooks; their responses are not
+		// part of the summary
+		h.deliverBlockingWebhooks(ctx, prefixedKey, writeEvent(prev), kvItem, prev)
+	})
+	if err != nil {
+		// Items before the unreadable part were imported, the summary says which
+		return apierror.JSONWithDetails(c, http.StatusBadRequest, "Invalid input: "+err.Error(), summary)
+	}
+	return c.JSON(http.StatusOK, summary)
+}
+
+// decodeDumpItems calls fn for each item of r, read as a JSON array if it starts with '['
+// and as NDJSON otherwise, without reading the whole body into memory.
+func decodeDumpItems(r io.Reader, fn func(index int, item DumpItem)) error {
+	br := bufio.NewReader(r)
+	array := false
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return nil // Empty body
+		}
+		if err != nil {
+			return err
+		}
+		if b == ' ' || b == '\t' || b == '\n' || b == '\r' {
+			continue
+		}
+		array = b == '['
+		br.UnreadByte()
+		break
+	}
+
+	dec := json.NewDecoder(br)
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+	for index := 0; ; index++ {
+		if array && !dec.More() {
+			_, err := dec.Token() // Closing bracket
+			return err
+		}
+		var item DumpItem
+		if err := dec.Decode(&item); err == io.EOF && !array {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("item %d: %w", index, err)
+		}
+		fn(index, item)
+	}
+}
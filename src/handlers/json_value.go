@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"mime"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// validateJSON is the ?validate= value requiring a write's value to be JSON.
+const validateJSON = "json"
+
+// isJSONContentType reports whether contentType is application/json or a +json type.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// jsonValueError returns why value is not valid JSON, or an empty string if it is.
+func jsonValueError(value string) string {
+	var raw json.RawMessage
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return "Value is not valid JSON: " + err.Error()
+	}
+	return ""
+}
+
+// checkValueFormat applies the ?validate= query parameter of a write to kv, whose value has
+// already passed validateKeyValue. It returns an error message, or an empty string if kv is valid.
+func checkValueFormat(c echo.Context, kv *KeyValue) string {
+	switch c.QueryParam("validate") {
+	case "":
+		return ""
+	case validateJSON:
+		value, err := decodeValue(kv.Value, kv.Encoding)
+		if err != nil {
+			return err.Error()
+		}
+		return jsonValueError(value)
+	default:
+		return "Validate must be json"
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListKeys returns the names of the keys of the caller's namespace and app, without their
+// values, optionally limited to keys starting with ?prefix=. Webhook and lock keys live
+// outside the KV prefix and are never listed.
+func (h *Handler) ListKeys(c echo.Context) error {
+	ctx := c.Request().Context()
+	prefixedKey, err := h.getKVPrefixedKey(c, c.QueryParam("prefix"))
+	if err != nil {
+		return err
+	}
+	keys, err := h.Store.Keys(ctx, prefixedKey)
+	if err != nil {
+		return storeError(c, err, "Could not list keys")
+	}
+
+	prefix := h.getKVPrefix(h.getNamespace(c), h.getAppName(c))
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, strings.TrimPrefix(key, prefix))
+	}
+	return c.JSON(http.StatusOK, map[string]any{"keys": names})
+}
+
+// CountKeys returns how many keys the caller's namespace and app have, optionally only those
+// starting with ?prefix=, without fetching them.
+func (h *Handler) CountKeys(c echo.Context) error {
+	ctx := c.Request().Context()
+	prefixedKey, err := h.getKVPrefixedKey(c, c.QueryParam("prefix"))
+	if err != nil {
+		return err
+	}
+	count, err := h.Store.Count(ctx, prefixedKey)
+	if err != nil {
+		return storeError(c, err, "Could not count keys")
+	}
+	return c.JSON(http.StatusOK, map[string]int64{"count": count})
+}
@@ -1,26 +1,68 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/middleware"
 	"github.com/mrofi/simple-golang-kv/src/store"
 )
 
 const (
-	errKeyEmpty    = "Key must not be empty"
-	errKeyNotFound = "Key not found"
+	errKeyEmpty         = "Key must not be empty"
+	errKeyNotFound      = "Key not found"
+	errValueEmpty       = "Value must not be empty"
+	errTTLWithLease     = "TTL and lease_id must not both be set"
+	errChecksumMismatch = "Checksum does not match value"
 )
 
+const maxTags = 20
+
 // KeyValue represents a key-value pair for JSON binding.
 type KeyValue struct {
 	Key      string `json:"key"`
 	Value    string `json:"value"`
 	TTL      int64  `json:"ttl,omitempty"`       // TTL in seconds, optional
 	ExpireAt int64  `json:"expire_at,omitempty"` // Unix timestamp, optional
+	LeaseID  int64  `json:"lease_id,omitempty"`  // Existing lease to attach the key to, optional
+	Checksum string `json:"checksum,omitempty"`  // sha256 hex of the value, optional
+
+	ContentType string   `json:"content_type,omitempty"` // MIME type of the value, optional
+	Tags        []string `json:"tags,omitempty"`         // Free-form labels, optional
+	Encoding    string   `json:"encoding,omitempty"`     // "base64" if value is base64-encoded binary, optional
+
+	WebhookResponses []WebhookResponse `json:"webhook_responses,omitempty"` // Responses of blocking webhooks, output only
+	DryRun           bool              `json:"dry_run,omitempty"`           // Set when nothing was written because of ?dry_run=true, output only
+}
+
+// KVResponse represents a key-value pair returned to the client.
+type KVResponse struct {
+	Key           string `json:"key"`
+	Value         string `json:"value"`
+	TTL           *int64 `json:"ttl"`
+	ExpireAt      *int64 `json:"expire_at"`
+	LeaseID       int64  `json:"lease_id,omitempty"`
+	Revision      int64  `json:"revision,omitempty"` // etcd mod revision, usable as expected_revision
+	Checksum      string `json:"checksum,omitempty"`
+	ChecksumValid *bool  `json:"checksum_valid,omitempty"` // Set when VERIFY_CHECKSUM_ON_READ is enabled
+
+	CreateRevision int64 `json:"create_revision,omitempty"` // etcd create revision, with ?metadata=true
+	Version        int64 `json:"version,omitempty"`         // Writes since the key was created, with ?metadata=true
+	StoredSize     int64 `json:"stored_size,omitempty"`     // Bytes stored in etcd after compression, with ?metadata=true
+
+	ContentType string   `json:"content_type,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Encoding    string   `json:"encoding,omitempty"`
 }
 
 // getKVPrefix(baseKeyPrefix, namespace, appName) string
@@ -30,14 +72,9 @@ func (h *Handler) getKVPrefix(namespace, appName string) string {
 
 // getKVPrefixedKey builds a key with namespace and app-name to prevent collision.
 func (h *Handler) getKVPrefixedKey(c echo.Context, key string) (string, error) {
+	// Namespace and app name were validated by middleware.ValidateIdentity
 	namespace := h.getNamespace(c)
 	appName := h.getAppName(c)
-	if len(namespace) > h.Config.MaxNamespaceLen {
-		return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Namespace too long (max %d characters)", h.Config.MaxNamespaceLen))
-	}
-	if len(appName) > h.Config.MaxAppNameLen {
-		return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("App name too long (max %d characters)", h.Config.MaxAppNameLen))
-	}
 	if len(key) > h.Config.MaxKeyLen {
 		return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Key too long (max %d characters)", h.Config.MaxKeyLen))
 	}
@@ -57,40 +94,281 @@ func (h *Handler) getOriginalKVKey(c echo.Context, prefixedKey string) (string,
 
 // CreateKeyValue handles the creation of a new key-value pair.
 func (h *Handler) CreateKeyValue(c echo.Context) error {
+	ctx := c.Request().Context()
 	var kv KeyValue
 	if err := c.Bind(&kv); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
 	}
 	if kv.Key == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": errKeyEmpty})
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
 	}
-	if len(kv.Value) > h.Config.MaxValueSize {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Value too large (max %d bytes)", h.Config.MaxValueSize)})
+	if msg := h.validateKeyValue(&kv); msg != "" {
+		return apierror.JSON(c, http.StatusBadRequest, msg)
 	}
-	if kv.TTL < 0 || kv.TTL > int64(h.Config.MaxTTLSeconds) {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("TTL must be between 0 and %d seconds", h.Config.MaxTTLSeconds)})
+	if msg := checkValueFormat(c, &kv); msg != "" {
+		return apierror.JSON(c, http.StatusBadRequest, msg)
+	}
+	overwrite := false
+	switch c.QueryParam("overwrite") {
+	case "", "false":
+	case "true":
+		overwrite = true
+	default:
+		return apierror.JSON(c, http.StatusBadRequest, "Overwrite must be true or false")
+	}
+	dryRun, err := parseDryRun(c)
+	if err != nil {
+		return err
 	}
 	// If TTL is not set, use default TTL
-	if kv.TTL == 0 {
+	if kv.TTL == 0 && kv.LeaseID == 0 {
 		kv.TTL = int64(h.Config.DefaultTTL)
 	}
+	if err := h.applyTTLJitter(c, &kv); err != nil {
+		return err
+	}
 	prefixedKey, err := h.getKVPrefixedKey(c, kv.Key)
 	if err != nil {
 		return err
 	}
-	if err := h.Store.Set(prefixedKey, kv.Value, kv.TTL); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create key-value pair"})
+	if err := h.enforceSiloLimits(ctx, h.getNamespace(c), h.getAppName(c), !dryRun); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return storeError(c, err, "Could not create key-value pair")
+	}
+	if dryRun {
+		if err := h.checkDryRun(ctx, prefixedKey, &kv, !overwrite); err != nil {
+			if he, ok := err.(*echo.HTTPError); ok {
+				return he
+			}
+			return storeError(c, err, "Could not create key-value pair")
+		}
+		kv.DryRun = true
+		return c.JSON(http.StatusCreated, kv)
+	}
+	var kvItem, prev *store.KVItem
+	if overwrite {
+		kvItem, prev, err = h.putKeyValue(ctx, prefixedKey, &kv)
+	} else {
+		kvItem, err = h.createKeyValue(ctx, prefixedKey, &kv)
+	}
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return storeError(c, err, "Could not create key-value pair")
 	}
+	kv.WebhookResponses = h.deliverBlockingWebhooks(ctx, prefixedKey, writeEvent(prev), kvItem, prev)
 	return c.JSON(http.StatusCreated, kv)
 }
 
+// validateKeyValue checks the value, checksum and TTL of a write. A value whose content_type
+// is JSON must parse as JSON. An expire_at is turned into the TTL left until then, which must
+// agree with ttl if both are set.
+// It returns an error message, or an empty string if kv is valid.
+func (h *Handler) validateKeyValue(kv *KeyValue) string {
+	if kv.Value == "" && h.Config.RejectEmptyValues {
+		return errValueEmpty
+	}
+	value, err := decodeValue(kv.Value, kv.Encoding)
+	if err != nil {
+		return err.Error()
+	}
+	if len(value) > h.Config.MaxValueSize {
+		return fmt.Sprintf("Value too large (max %d bytes)", h.Config.MaxValueSize)
+	}
+	if kv.Checksum != "" && !checksumMatches(value, kv.Checksum) {
+		return errChecksumMismatch
+	}
+	if kv.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(kv.ContentType); err != nil {
+			return "Invalid content_type"
+		}
+		if isJSONContentType(kv.ContentType) {
+			if msg := jsonValueError(value); msg != "" {
+				return msg
+			}
+		}
+	}
+	if len(kv.Tags) > maxTags {
+		return fmt.Sprintf("Too many tags (max %d)", maxTags)
+	}
+	if kv.ExpireAt != 0 {
+		ttl := kv.ExpireAt - time.Now().Unix()
+		if ttl <= 0 {
+			return "expire_at must be in the future"
+		}
+		if ttl > int64(h.Config.MaxTTLSeconds) {
+			return fmt.Sprintf("expire_at must be at most %d seconds from now", h.Config.MaxTTLSeconds)
+		}
+		// Allow a second either way, the client computed expire_at from its own clock
+		if kv.TTL != 0 && (kv.TTL < ttl-1 || kv.TTL > ttl+1) {
+			return "ttl and expire_at disagree, set only one of them"
+		}
+		kv.TTL = ttl
+	}
+	if kv.TTL < 0 || kv.TTL > int64(h.Config.MaxTTLSeconds) {
+		return fmt.Sprintf("TTL must be between 0 and %d seconds", h.Config.MaxTTLSeconds)
+	}
+	if kv.TTL != 0 && kv.LeaseID != 0 {
+		return errTTLWithLease
+	}
+	return ""
+}
+
+// putKeyValue stores kv under prefixedKey, attaching it to kv.LeaseID or to a new
+// lease granted for kv.TTL. kv.TTL and kv.LeaseID are updated to reflect the lease used.
+// It returns the stored item and the one it replaced, nil if the key did not exist.
+func (h *Handler) putKeyValue(ctx context.Context, prefixedKey string, kv *KeyValue) (kvItem, prev *store.KVItem, err error) {
+	granted := kv.LeaseID == 0 && kv.TTL > 0
+	kvItem, err = h.prepareKVItem(ctx, prefixedKey, kv)
+	if err != nil {
+		return nil, nil, err
+	}
+	prev, err = h.Store.SetItem(ctx, kvItem)
+	if err != nil {
+		if granted {
+			h.Store.Revoke(context.WithoutCancel(ctx), kvItem.LeaseID)
+		}
+		return nil, nil, err
+	}
+	return kvItem, prev, nil
+}
+
+// createKeyValue stores kv under prefixedKey like putKeyValue, but only if the key does not exist.
+// It returns a 409 error if the key already exists.
+func (h *Handler) createKeyValue(ctx context.Context, prefixedKey string, kv *KeyValue) (*store.KVItem, error) {
+	granted := kv.LeaseID == 0 && kv.TTL > 0
+	kvItem, err := h.prepareKVItem(ctx, prefixedKey, kv)
+	if err != nil {
+		return nil, err
+	}
+	created, err := h.Store.CreateItem(ctx, kvItem)
+	if err == nil && created {
+		return kvItem, nil
+	}
+	if granted {
+		h.Store.Revoke(context.WithoutCancel(ctx), kvItem.LeaseID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, echo.NewHTTPError(http.StatusConflict, "Key already exists")
+}
+
+// prepareKVItem builds the item to store for kv under prefixedKey, checking kv.LeaseID belongs to
+// the key's namespace/app or granting a new lease for kv.TTL. kv.TTL and kv.LeaseID are updated to
+// reflect the lease used.
+func (h *Handler) prepareKVItem(ctx context.Context, prefixedKey string, kv *KeyValue) (*store.KVItem, error) {
+	// Decode first, so a bad value does not leave a granted lease behind
+	value, err := decodeValue(kv.Value, kv.Encoding)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if kv.LeaseID != 0 {
+		ttl, err := h.writeLeaseTTL(ctx, prefixedKey, kv.LeaseID)
+		if err != nil {
+			return nil, err
+		}
+		kv.TTL = ttl
+	} else if kv.TTL > 0 {
+		leaseID, err := h.Store.Grant(ctx, kv.TTL)
+		if err != nil {
+			return nil, err
+		}
+		kv.LeaseID = leaseID
+	}
+	kvItem := &store.KVItem{
+		Key:      prefixedKey,
+		Value:    value,
+		LeaseID:  kv.LeaseID,
+		Checksum: strings.ToLower(kv.Checksum),
+
+		ContentType: kv.ContentType,
+		Tags:        kv.Tags,
+		Encoding:    kv.Encoding,
+		RequestID:   middleware.RequestIDFromContext(ctx),
+	}
+	if kv.TTL > 0 {
+		kvItem.TTL = &kv.TTL
+	}
+	return kvItem, nil
+}
+
+// compareAndSwapKeyValue stores kv under prefixedKey like putKeyValue, but only if the key
+// matches expected, the If-Match header: an ETag as returned by GET is compared with the key's
+// revision, anything else with its current value. It returns the stored item and the one it
+// replaced, or a 412 error if the key is missing or does not match.
+func (h *Handler) compareAndSwapKeyValue(ctx context.Context, prefixedKey string, kv *KeyValue, expected string) (kvItem, prev *store.KVItem, err error) {
+	granted := kv.LeaseID == 0 && kv.TTL > 0
+	kvItem, err = h.prepareKVItem(ctx, prefixedKey, kv)
+	if err != nil {
+		return nil, nil, err
+	}
+	var swapped bool
+	rev, byRevision := parseRevisionETag(expected)
+	if byRevision {
+		prev, swapped, err = h.Store.CompareAndSwapRevision(ctx, kvItem, rev)
+	} else {
+		prev, swapped, err = h.Store.CompareAndSwapItem(ctx, kvItem, expected)
+	}
+	if err == nil && swapped {
+		return kvItem, prev, nil
+	}
+	if granted {
+		h.Store.Revoke(context.WithoutCancel(ctx), kvItem.LeaseID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if byRevision {
+		return nil, nil, echo.NewHTTPError(http.StatusPreconditionFailed, "Current revision does not match If-Match")
+	}
+	return nil, nil, echo.NewHTTPError(http.StatusPreconditionFailed, "Current value does not match If-Match")
+}
+
+// revisionETag returns the ETag of a key at the given mod revision.
+func revisionETag(rev int64) string {
+	return `"` + strconv.FormatInt(rev, 10) + `"`
+}
+
+// parseRevisionETag returns the revision of an ETag built by revisionETag. Unquoted values
+// are not ETags and are reported as false.
+func parseRevisionETag(etag string) (int64, bool) {
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, false
+	}
+	rev, err := strconv.ParseInt(etag[1:len(etag)-1], 10, 64)
+	return rev, err == nil && rev > 0
+}
+
+// setRevisionETag sets the ETag of kv and reports whether it matches If-None-Match, in which
+// case the client's copy is current and the caller answers 304.
+func setRevisionETag(c echo.Context, kv *store.KVItem) bool {
+	etag := revisionETag(kv.Revision)
+	c.Response().Header().Set("ETag", etag)
+	for _, candidate := range strings.Split(c.Request().Header.Get("If-None-Match"), ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// checksumMatches reports whether checksum is the sha256 hex digest of value.
+func checksumMatches(value, checksum string) bool {
+	sum := sha256.Sum256([]byte(value))
+	return strings.EqualFold(hex.EncodeToString(sum[:]), checksum)
+}
+
 // fetchKVItems retrieves KV items based on prefixedKey (handles wildcard).
-func (h *Handler) fetchKVItems(prefixedKey string) ([]*store.KVItem, error) {
+func (h *Handler) fetchKVItems(ctx context.Context, prefixedKey string) ([]*store.KVItem, error) {
 	if strings.HasSuffix(prefixedKey, "*") {
 		prefix := strings.TrimSuffix(prefixedKey, "*")
-		return h.Store.All(prefix)
+		return h.Store.All(ctx, prefix)
 	}
-	kvItem, found, err := h.Store.Get(prefixedKey)
+	kvItem, found, err := h.Store.Get(ctx, prefixedKey)
 	if err != nil || !found {
 		return nil, err
 	}
@@ -98,15 +376,14 @@ func (h *Handler) fetchKVItems(prefixedKey string) ([]*store.KVItem, error) {
 }
 
 // buildKVResponse builds a response item from a KVItem.
-func (h *Handler) buildKVResponse(c echo.Context, kv *store.KVItem) any {
+func (h *Handler) buildKVResponse(c echo.Context, kv *store.KVItem) KVResponse {
+	// A key without a lease never expires and has neither; a key with one expires TTL seconds
+	// from now, which is now for a key whose lease has just run out
 	var ttl *int64
 	var expireAt *int64
 	if kv.TTL != nil {
 		ttl = kv.TTL
 		exp := time.Now().Unix() + *kv.TTL
-		if *kv.TTL == 0 {
-			exp = time.Now().Unix()
-		}
 		expireAt = &exp
 	}
 
@@ -115,92 +392,471 @@ func (h *Handler) buildKVResponse(c echo.Context, kv *store.KVItem) any {
 		key = originalKey
 	}
 
-	return struct {
-		Key      string `json:"key"`
-		Value    string `json:"value"`
-		TTL      *int64 `json:"ttl"`
-		ExpireAt *int64 `json:"expire_at"`
-	}{
+	response := KVResponse{
 		Key:      key,
-		Value:    kv.Value,
+		Value:    encodedValue(kv),
 		TTL:      ttl,
 		ExpireAt: expireAt,
+		LeaseID:  kv.LeaseID,
+		Revision: kv.Revision,
+		Checksum: kv.Checksum,
+
+		ContentType: kv.ContentType,
+		Tags:        kv.Tags,
+		Encoding:    kv.Encoding,
 	}
+	if h.Config.VerifyChecksumOnRead && kv.Checksum != "" {
+		valid := checksumMatches(kv.Value, kv.Checksum)
+		response.ChecksumValid = &valid
+	}
+	if c.QueryParam("metadata") == "true" {
+		response.CreateRevision = kv.Created
+		response.Version = kv.Version
+		response.StoredSize = kv.StoredSize
+	}
+	return response
 }
 
 // GetKeyValue handles the retrieval of a key-value pair by key.
 func (h *Handler) GetKeyValue(c echo.Context) error {
+	ctx := c.Request().Context()
 	key := c.Param("key")
 	if key == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": errKeyEmpty})
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
 	}
 	prefixedKey, err := h.getKVPrefixedKey(c, key)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err)
+		return err
 	}
 
-	result, err := h.fetchKVItems(prefixedKey)
+	filter, err := parseTTLFilter(c)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": errKeyNotFound})
+		return err
+	}
+
+	if c.QueryParam("rev") != "" {
+		return h.getKeyValueAtRevision(c, prefixedKey)
+	}
+	if strings.HasSuffix(prefixedKey, "*") && (c.QueryParam("limit") != "" || c.QueryParam("cursor") != "") {
+		return h.getKeyValuePage(c, strings.TrimSuffix(prefixedKey, "*"), filter)
 	}
 
-	responses := make([]any, 0, len(result))
-	for _, kv := range result {
+	items, err := h.fetchKVItems(ctx, prefixedKey)
+	if err != nil {
+		if _, msg := mapStoreError(err); msg != "" {
+			return storeError(c, err, msg)
+		}
+		return apierror.JSON(c, http.StatusNotFound, errKeyNotFound)
+	}
+
+	result := make([]*store.KVItem, 0, len(items))
+	responses := make([]KVResponse, 0, len(items))
+	for _, kv := range items {
+		if !filter.matches(kv) {
+			continue
+		}
+		result = append(result, kv)
 		responses = append(responses, h.buildKVResponse(c, kv))
 	}
 
 	if len(responses) == 0 {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": errKeyNotFound})
+		return apierror.JSON(c, http.StatusNotFound, errKeyNotFound)
 	}
 
+	h.setCacheHeaders(c, result)
 	if strings.HasSuffix(prefixedKey, "*") {
 		return c.JSON(http.StatusOK, responses)
 	}
+	if setRevisionETag(c, result[0]) {
+		return c.NoContent(http.StatusNotModified)
+	}
 	return c.JSON(http.StatusOK, responses[0])
 }
 
+// getKeyValueAtRevision returns a single key as it was at the request's ?rev=, from the history
+// etcd keeps until it is compacted. The response is not cached, and TTL filters do not apply.
+func (h *Handler) getKeyValueAtRevision(c echo.Context, prefixedKey string) error {
+	if strings.HasSuffix(prefixedKey, "*") {
+		return apierror.JSON(c, http.StatusBadRequest, "Revision cannot be combined with a wildcard")
+	}
+	rev, err := parseRevision(c)
+	if err != nil {
+		return err
+	}
+	kvItem, found, err := h.Store.GetAtRevision(c.Request().Context(), prefixedKey, rev)
+	switch {
+	case errors.Is(err, store.ErrCompacted):
+		return apierror.JSON(c, http.StatusGone, "Revision has been compacted")
+	case errors.Is(err, store.ErrFutureRevision):
+		return apierror.JSON(c, http.StatusBadRequest, errFutureRevision)
+	case err != nil:
+		return storeError(c, err, "Could not read key-value pair")
+	case !found:
+		return apierror.JSON(c, http.StatusNotFound, errKeyNotFound)
+	}
+	return c.JSON(http.StatusOK, h.buildKVResponse(c, kvItem))
+}
+
+// KVPage is one page of a paginated wildcard get.
+type KVPage struct {
+	Items      []KVResponse `json:"items"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// getKeyValuePage returns one page of the keys under prefix, starting at the request's ?cursor=.
+// Unlike a plain wildcard get, an empty page is not an error.
+func (h *Handler) getKeyValuePage(c echo.Context, prefix string, filter *ttlFilter) error {
+	ctx := c.Request().Context()
+	limit, err := parsePageLimit(c)
+	if err != nil {
+		return err
+	}
+	namespacePrefix := h.getKVPrefix(h.getNamespace(c), h.getAppName(c))
+	fromKey, err := decodeCursor(namespacePrefix, c.QueryParam("cursor"))
+	if err != nil {
+		return err
+	}
+	if fromKey != "" && !strings.HasPrefix(fromKey, prefix) {
+		return apierror.JSON(c, http.StatusBadRequest, errInvalidCursor)
+	}
+
+	items, nextKey, err := h.Store.Page(ctx, prefix, limit, fromKey)
+	if err != nil {
+		return storeError(c, err, "Could not list keys")
+	}
+
+	page := KVPage{
+		Items:      make([]KVResponse, 0, len(items)),
+		NextCursor: encodeCursor(namespacePrefix, nextKey),
+	}
+	for _, kv := range items {
+		if filter.matches(kv) {
+			page.Items = append(page.Items, h.buildKVResponse(c, kv))
+		}
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// HeadKeyValue reports whether a key exists without returning its value. The remaining TTL
+// and expiry of the key are returned in the X-KV-TTL and X-KV-Expire-At headers.
+func (h *Handler) HeadKeyValue(c echo.Context) error {
+	ctx := c.Request().Context()
+	key := c.Param("key")
+	if key == "" {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	prefixedKey, err := h.getKVPrefixedKey(c, key)
+	if err != nil {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	kvItem, found, err := h.Store.Stat(ctx, prefixedKey)
+	if err != nil {
+		status, _ := mapStoreError(err)
+		return c.NoContent(status)
+	}
+	if !found {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if kvItem.TTL != nil {
+		c.Response().Header().Set("X-KV-TTL", strconv.FormatInt(*kvItem.TTL, 10))
+		c.Response().Header().Set("X-KV-Expire-At", strconv.FormatInt(time.Now().Unix()+*kvItem.TTL, 10))
+	}
+	h.setCacheHeaders(c, []*store.KVItem{kvItem})
+	if setRevisionETag(c, kvItem) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
 // UpdateKeyValue handles the updating of an existing key-value pair.
 func (h *Handler) UpdateKeyValue(c echo.Context) error {
+	ctx := c.Request().Context()
 	key := c.Param("key")
 	if key == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": errKeyEmpty})
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
 	}
 	var kv KeyValue
 	if err := c.Bind(&kv); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
 	}
-	if len(kv.Value) > h.Config.MaxValueSize {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Value too large (max %d bytes)", h.Config.MaxValueSize)})
+	if msg := h.validateKeyValue(&kv); msg != "" {
+		return apierror.JSON(c, http.StatusBadRequest, msg)
 	}
-	if kv.TTL < 0 || kv.TTL > int64(h.Config.MaxTTLSeconds) {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("TTL must be between 0 and %d seconds", h.Config.MaxTTLSeconds)})
+	if msg := checkValueFormat(c, &kv); msg != "" {
+		return apierror.JSON(c, http.StatusBadRequest, msg)
+	}
+	dryRun, err := parseDryRun(c)
+	if err != nil {
+		return err
 	}
 	// If TTL is not set, use default TTL
-	if kv.TTL == 0 {
+	if kv.TTL == 0 && kv.LeaseID == 0 {
 		kv.TTL = int64(h.Config.DefaultTTL)
 	}
+	if err := h.applyTTLJitter(c, &kv); err != nil {
+		return err
+	}
+	prefixedKey, err := h.getKVPrefixedKey(c, key)
+	if err != nil {
+		return err
+	}
+	if err := h.enforceSiloLimits(ctx, h.getNamespace(c), h.getAppName(c), !dryRun); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return storeError(c, err, "Could not update key-value pair")
+	}
+	if dryRun {
+		if err := h.checkDryRun(ctx, prefixedKey, &kv, false); err != nil {
+			if he, ok := err.(*echo.HTTPError); ok {
+				return he
+			}
+			return storeError(c, err, "Could not update key-value pair")
+		}
+		kv.Key = key
+		kv.DryRun = true
+		return c.JSON(http.StatusOK, kv)
+	}
+	var kvItem, prev *store.KVItem
+	if expected := c.Request().Header.Values("If-Match"); len(expected) > 0 {
+		kvItem, prev, err = h.compareAndSwapKeyValue(ctx, prefixedKey, &kv, expected[0])
+	} else {
+		kvItem, prev, err = h.putKeyValue(ctx, prefixedKey, &kv)
+	}
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return storeError(c, err, "Could not update key-value pair")
+	}
+	return c.JSON(http.StatusOK, KeyValue{
+		Key:              key,
+		Value:            kv.Value,
+		TTL:              kv.TTL,
+		LeaseID:          kv.LeaseID,
+		Checksum:         kvItem.Checksum,
+		ContentType:      kv.ContentType,
+		Tags:             kv.Tags,
+		Encoding:         kv.Encoding,
+		WebhookResponses: h.deliverBlockingWebhooks(ctx, prefixedKey, writeEvent(prev), kvItem, prev),
+	})
+}
+
+// TTLRequest represents a TTL change request.
+type TTLRequest struct {
+	TTL int64 `json:"ttl"` // New TTL in seconds
+}
+
+// RefreshTTLForPrefix sets a new TTL on every key under the ?prefix= query parameter.
+func (h *Handler) RefreshTTLForPrefix(c echo.Context) error {
+	ctx := c.Request().Context()
+	prefix := c.QueryParam("prefix")
+	if prefix == "" {
+		return apierror.JSON(c, http.StatusBadRequest, "Prefix must not be empty")
+	}
+	var req TTLRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if req.TTL <= 0 || req.TTL > int64(h.Config.MaxTTLSeconds) {
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("TTL must be between 1 and %d seconds", h.Config.MaxTTLSeconds))
+	}
+	prefixedKey, err := h.getKVPrefixedKey(c, prefix)
+	if err != nil {
+		return err
+	}
+
+	updated, err := h.Store.RefreshTTL(ctx, prefixedKey, req.TTL)
+	if err != nil {
+		return storeError(c, err, "Could not refresh TTL")
+	}
+	return c.JSON(http.StatusOK, map[string]int64{"updated": updated, "ttl": req.TTL})
+}
+
+// SetKeyTTL replaces the TTL of a single key without rewriting its value. A TTL of 0 removes
+// the key's expiration.
+func (h *Handler) SetKeyTTL(c echo.Context) error {
+	ctx := c.Request().Context()
+	key := c.Param("key")
+	if key == "" {
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
+	}
+	var req TTLRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if req.TTL < 0 || req.TTL > int64(h.Config.MaxTTLSeconds) {
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("TTL must be between 0 and %d seconds", h.Config.MaxTTLSeconds))
+	}
 	prefixedKey, err := h.getKVPrefixedKey(c, key)
 	if err != nil {
 		return err
 	}
-	if err := h.Store.Set(prefixedKey, kv.Value, kv.TTL); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update key-value pair"})
+
+	err = h.Store.SetTTL(ctx, prefixedKey, req.TTL)
+	if errors.Is(err, store.ErrKeyNotFound) {
+		return apierror.JSON(c, http.StatusNotFound, errKeyNotFound)
+	}
+	if err != nil {
+		return storeError(c, err, "Could not set TTL")
+	}
+
+	response := map[string]any{"key": key, "ttl": nil, "expire_at": nil}
+	if req.TTL > 0 {
+		response["ttl"] = req.TTL
+		response["expire_at"] = time.Now().Unix() + req.TTL
 	}
-	return c.JSON(http.StatusOK, KeyValue{Key: key, Value: kv.Value, TTL: kv.TTL})
+	return c.JSON(http.StatusOK, response)
+}
+
+// TouchKeyValue returns a key and extends its TTL in the same operation, so frequently read
+// keys can be kept from expiring.
+func (h *Handler) TouchKeyValue(c echo.Context) error {
+	ctx := c.Request().Context()
+	key := c.Param("key")
+	if key == "" {
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
+	}
+	var req TTLRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if req.TTL <= 0 || req.TTL > int64(h.Config.MaxTTLSeconds) {
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("TTL must be between 1 and %d seconds", h.Config.MaxTTLSeconds))
+	}
+	prefixedKey, err := h.getKVPrefixedKey(c, key)
+	if err != nil {
+		return err
+	}
+
+	kvItem, found, err := h.Store.Touch(ctx, prefixedKey, req.TTL)
+	if err != nil {
+		return storeError(c, err, "Could not touch key")
+	}
+	if !found {
+		return apierror.JSON(c, http.StatusNotFound, errKeyNotFound)
+	}
+	return c.JSON(http.StatusOK, h.buildKVResponse(c, kvItem))
 }
 
 // DeleteKeyValue handles the deletion of a key-value pair by key.
 func (h *Handler) DeleteKeyValue(c echo.Context) error {
+	ctx := c.Request().Context()
 	key := c.Param("key")
 	if key == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": errKeyEmpty})
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
 	}
 	prefixedKey, err := h.getKVPrefixedKey(c, key)
 	if err != nil {
 		return err
 	}
-	if err := h.Store.Delete(prefixedKey); err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": errKeyNotFound})
+	expected := c.Request().Header.Get("If-Match")
+	switch c.QueryParam("return") {
+	case "":
+	case "body":
+		if expected != "" {
+			return apierror.JSON(c, http.StatusBadRequest, "If-Match cannot be combined with return=body")
+		}
+		return h.deleteKeyValueWithBody(c, key, prefixedKey)
+	default:
+		return apierror.JSON(c, http.StatusBadRequest, "Return must be body")
+	}
+	var prev *store.KVItem
+	if expected != "" {
+		if prev, err = h.deleteKeyValueIfMatch(ctx, prefixedKey, expected); err != nil {
+			if he, ok := err.(*echo.HTTPError); ok {
+				return he
+			}
+			return storeError(c, err, "Could not delete key-value pair")
+		}
+	} else if prev, _, err = h.Store.GetAndDelete(ctx, prefixedKey); err != nil {
+		if _, msg := mapStoreError(err); msg != "" {
+			return storeError(c, err, msg)
+		}
+		return apierror.JSON(c, http.StatusNotFound, errKeyNotFound)
+	}
+	// Like batches, deleting a key that did not exist fires no webhooks
+	if prev == nil {
+		return c.NoContent(http.StatusNoContent)
+	}
+	if responses := h.deliverBlockingWebhooks(ctx, prefixedKey, EventDelete, prev, prev); len(responses) > 0 {
+		return c.JSON(http.StatusOK, map[string]any{"webhook_responses": responses})
 	}
 	return c.NoContent(http.StatusNoContent)
 }
+
+// deleteKeyValueIfMatch deletes prefixedKey only if it matches expected, the If-Match header,
+// compared like in compareAndSwapKeyValue. It returns the value deleted, or a 404 error if the
+// key is missing and a 412 error if it does not match.
+func (h *Handler) deleteKeyValueIfMatch(ctx context.Context, prefixedKey, expected string) (*store.KVItem, error) {
+	var prev *store.KVItem
+	var deleted bool
+	var err error
+	rev, byRevision := parseRevisionETag(expected)
+	if byRevision {
+		prev, deleted, err = h.Store.DeleteIfRevision(ctx, prefixedKey, rev)
+	} else {
+		prev, deleted, err = h.Store.DeleteIfMatch(ctx, prefixedKey, expected)
+	}
+	if err != nil || deleted {
+		return prev, err
+	}
+	if _, found, err := h.Store.Stat(ctx, prefixedKey); err != nil {
+		return nil, err
+	} else if !found {
+		return nil, echo.NewHTTPError(http.StatusNotFound, errKeyNotFound)
+	}
+	if byRevision {
+		return nil, echo.NewHTTPError(http.StatusPreconditionFailed, "Current revision does not match If-Match")
+	}
+	return nil, echo.NewHTTPError(http.StatusPreconditionFailed, "Current value does not match If-Match")
+}
+
+// DeleteKeyValuesByPrefix deletes every key of the caller's namespace/app starting with ?prefix=.
+// Deleting the whole namespace/app, with no prefix, requires ?confirm=true.
+// Blocking delete webhooks are delivered for each deleted key after the delete.
+func (h *Handler) DeleteKeyValuesByPrefix(c echo.Context) error {
+	ctx := c.Request().Context()
+	prefix := c.QueryParam("prefix")
+	if prefix == "" && c.QueryParam("confirm") != "true" {
+		return apierror.JSON(c, http.StatusBadRequest, "Prefix must not be empty, pass confirm=true to delete every key")
+	}
+	prefixedKey, err := h.getKVPrefixedKey(c, prefix)
+	if err != nil {
+		return err
+	}
+	deleted, err := h.Store.DeletePrefix(ctx, prefixedKey)
+	if err != nil {
+		return storeError(c, err, "Could not delete keys")
+	}
+	response := map[string]any{"deleted": len(deleted)}
+	var webhookResponses []WebhookResponse
+	for _, kvItem := range deleted {
+		webhookResponses = append(webhookResponses, h.deliverBlockingWebhooks(ctx, kvItem.Key, EventDelete, kvItem, kvItem)...)
+	}
+	if len(webhookResponses) > 0 {
+		response["webhook_responses"] = webhookResponses
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// deleteKeyValueWithBody deletes a key and returns 200 with the value it held.
+func (h *Handler) deleteKeyValueWithBody(c echo.Context, key, prefixedKey string) error {
+	ctx := c.Request().Context()
+	kvItem, found, err := h.Store.GetAndDelete(ctx, prefixedKey)
+	if err != nil {
+		return storeError(c, err, "Could not delete key-value pair")
+	}
+	if !found {
+		return apierror.JSON(c, http.StatusNotFound, errKeyNotFound)
+	}
+	response := map[string]any{
+		"deleted": true,
+		"key":     key,
+		"value":   encodedValue(kvItem),
+	}
+	if responses := h.deliverBlockingWebhooks(ctx, prefixedKey, EventDelete, kvItem, kvItem); len(responses) > 0 {
+		response["webhook_responses"] = responses
+	}
+	return c.JSON(http.StatusOK, response)
+}
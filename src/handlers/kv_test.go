@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mrofi/simple-golang-kv/src/config"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+func TestValidateKeyValueEmptyValue(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		cfg := config.NewConfig()
+		cfg.RejectEmptyValues = reject
+		h := &Handler{Config: cfg}
+
+		msg := h.validateKeyValue(&KeyValue{Key: "k", Value: ""})
+		if (msg != "") != reject {
+			t.Errorf("REJECT_EMPTY_VALUES=%v: empty value message = %q", reject, msg)
+		}
+		if msg := h.validateKeyValue(&KeyValue{Key: "k", Value: "v"}); msg != "" {
+			t.Errorf("REJECT_EMPTY_VALUES=%v: non-empty value rejected: %q", reject, msg)
+		}
+	}
+}
+
+func TestEmptyValueCreateAndGet(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		h := newTestHandler(t, func(cfg *config.Config) { cfg.RejectEmptyValues = reject })
+
+		c, rec := newTestContext(http.MethodPost, "/kv", `{"key":"empty","value":""}`)
+		wantCreate := http.StatusCreated
+		if reject {
+			wantCreate = http.StatusBadRequest
+		}
+		if status := serve(c, rec, h.CreateKeyValue); status != wantCreate {
+			t.Fatalf("REJECT_EMPTY_VALUES=%v: create status = %d, want %d: %s", reject, status, wantCreate, rec.Body)
+		}
+
+		c, rec = newTestContext(http.MethodGet, "/kv/empty", "", "key", "empty")
+		status := serve(c, rec, h.GetKeyValue)
+		if reject {
+			if status != http.StatusNotFound {
+				t.Errorf("GET of a rejected key: status = %d, want 404", status)
+			}
+			continue
+		}
+		if status != http.StatusOK {
+			t.Fatalf("GET of an empty value: status = %d, want 200: %s", status, rec.Body)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if value, ok := got["value"]; !ok || value != "" {
+			t.Errorf("GET of an empty value: value = %v (present %v), want \"\"", value, ok)
+		}
+
+		c, rec = newTestContext(http.MethodGet, "/kv/absent", "", "key", "absent")
+		if status := serve(c, rec, h.GetKeyValue); status != http.StatusNotFound {
+			t.Errorf("GET of an absent key: status = %d, want 404", status)
+		}
+	}
+}
+
+func TestBuildKVResponseTTL(t *testing.T) {
+	h := &Handler{Config: config.NewConfig()}
+	c, _ := newTestContext(http.MethodGet, "/kv/k", "")
+	key, err := h.getKVPrefixedKey(c, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttl := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name string
+		ttl  *int64
+	}{
+		{"no lease", nil},
+		{"about to expire", ttl(0)},
+		{"freshly set", ttl(60)},
+	}
+	for _, tt := range tests {
+		before := time.Now().Unix()
+		resp := h.buildKVResponse(c, &store.KVItem{Key: key, Value: "v", TTL: tt.ttl})
+		after := time.Now().Unix()
+
+		if resp.Key != "k" {
+			t.Errorf("%s: key = %q, want k", tt.name, resp.Key)
+		}
+		if tt.ttl == nil {
+			if resp.TTL != nil || resp.ExpireAt != nil {
+				t.Errorf("%s: ttl = %v, expire_at = %v, want both null", tt.name, resp.TTL, resp.ExpireAt)
+			}
+			continue
+		}
+		if resp.TTL == nil || *resp.TTL != *tt.ttl {
+			t.Errorf("%s: ttl = %v, want %d", tt.name, resp.TTL, *tt.ttl)
+		}
+		if resp.ExpireAt == nil || *resp.ExpireAt < before+*tt.ttl || *resp.ExpireAt > after+*tt.ttl {
+			t.Errorf("%s: expire_at = %v, want now + %d", tt.name, resp.ExpireAt, *tt.ttl)
+		}
+	}
+}
+
+func TestValidateKeyValueExpireAt(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.MaxTTLSeconds = 3600
+	h := &Handler{Config: cfg}
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name     string
+		expireAt int64
+		ttl      int64
+		valid    bool
+	}{
+		{"past", now - 10, 0, false},
+		{"now", now, 0, false},
+		{"future", now + 600, 0, true},
+		{"at max ttl", now + 3600, 0, true},
+		{"past max ttl", now + 3700, 0, false},
+		{"matching ttl", now + 600, 600, true},
+		{"ttl a second off", now + 600, 601, true},
+		{"disagreeing ttl", now + 600, 300, false},
+	}
+	for _, tt := range tests {
+		kv := &KeyValue{Key: "k", Value: "v", ExpireAt: tt.expireAt, TTL: tt.ttl}
+		msg := h.validateKeyValue(kv)
+		if (msg == "") != tt.valid {
+			t.Errorf("%s: message = %q, want valid %v", tt.name, msg, tt.valid)
+			continue
+		}
+		// The lease is granted for the time left until expire_at
+		if tt.valid && (kv.TTL < tt.expireAt-now-1 || kv.TTL > tt.expireAt-now) {
+			t.Errorf("%s: ttl = %d, want %d", tt.name, kv.TTL, tt.expireAt-now)
+		}
+	}
+}
+
+func TestCreateKeyValuePastExpireAt(t *testing.T) {
+	h := &Handler{Config: config.NewConfig()}
+	body := fmt.Sprintf(`{"key":"k","value":"v","expire_at":%d}`, time.Now().Unix()-60)
+	c, rec := newTestContext(http.MethodPost, "/kv", body)
+	if status := serve(c, rec, h.CreateKeyValue); status != http.StatusBadRequest {
+		t.Errorf("create with a past expire_at: status = %d, want 400: %s", status, rec.Body)
+	}
+}
+
+func TestPutKeyValueRevokesGrantedLeaseOnFailure(t *testing.T) {
+	h := newTestHandler(t, nil)
+	ctx := context.Background()
+	// Random bytes, hex-encoded so they stay large, exceed etcd's request size limit
+	raw := make([]byte, 2<<20)
+	rand.Read(raw)
+	kv := &KeyValue{Value: hex.EncodeToString(raw), TTL: 60}
+	if _, _, err := h.putKeyValue(ctx, h.getKVPrefix("ns", "app")+"big", kv); err == nil {
+		t.Fatal("putKeyValue of an oversized value succeeded")
+	}
+	if kv.LeaseID == 0 {
+		t.Fatal("no lease was granted")
+	}
+	if _, err := h.Store.Lease(ctx, kv.LeaseID); !errors.Is(err, store.ErrLeaseNotFound) {
+		t.Errorf("lease %d granted for the failed write still exists: %v", kv.LeaseID, err)
+	}
+}
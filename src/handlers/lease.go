@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+const (
+	errLeaseIDInvalid = "Lease ID must be a number"
+	errLeaseNotFound  = "Lease not found or expired"
+)
+
+// LeaseRequest represents a lease grant request.
+type LeaseRequest struct {
+	TTL int64 `json:"ttl"` // Lease TTL in seconds
+}
+
+// LeaseResponse represents a lease returned to the client.
+type LeaseResponse struct {
+	ID         int64    `json:"id"`
+	TTL        int64    `json:"ttl"`
+	GrantedTTL int64    `json:"granted_ttl,omitempty"`
+	Keys       []string `json:"keys,omitempty"` // Attached keys within the caller's namespace/app
+}
+
+// getLeaseOwnerKey returns the key recording the namespace/app a lease was granted to by
+// GrantLease. It is attached to the lease, so it goes away with it.
+func (h *Handler) getLeaseOwnerKey(leaseID int64) string {
+	return "/" + h.Config.BaseKeyPrefix + "/lease-owners/" + strconv.FormatInt(leaseID, 10)
+}
+
+// ownedLease returns a lease if it belongs to the namespace/app: it was granted to it by
+// GrantLease, or only keys of the namespace/app are attached to it. Any other lease, such as
+// one holding keys of another app or the session of a lock or of the watcher, is reported as
+// ErrLeaseNotFound so lease IDs cannot be probed.
+func (h *Handler) ownedLease(ctx context.Context, namespace, appName string, leaseID int64) (*store.LeaseInfo, error) {
+	info, err := h.Store.Lease(ctx, leaseID)
+	if err != nil {
+		return nil, err
+	}
+	ownerKey := h.getLeaseOwnerKey(leaseID)
+	prefix := h.getKVPrefix(namespace, appName)
+	owned, hasOwner := false, false
+	for _, key := range info.Keys {
+		switch {
+		case key == ownerKey:
+			hasOwner = true
+		case strings.HasPrefix(key, prefix):
+			owned = true
+		default:
+			return nil, store.ErrLeaseNotFound
+		}
+	}
+	if hasOwner {
+		owner, found, err := h.Store.Get(ctx, ownerKey)
+		if err != nil {
+			return nil, err
+		}
+		owned = found && owner.Value == namespace+"/"+appName
+	}
+	if !owned {
+		return nil, store.ErrLeaseNotFound
+	}
+	return info, nil
+}
+
+// writeLeaseTTL returns the remaining TTL of the lease a write to prefixedKey attaches the key
+// to, with a 400 error if the lease is expired or belongs to another namespace/app.
+func (h *Handler) writeLeaseTTL(ctx context.Context, prefixedKey string, leaseID int64) (int64, error) {
+	namespace, appName, _ := h.slicePrefixedKey(prefixedKey)
+	info, err := h.ownedLease(ctx, namespace, appName, leaseID)
+	if errors.Is(err, store.ErrLeaseNotFound) {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, errLeaseNotFound)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.TTL, nil
+}
+
+// getLeaseID parses the lease ID route parameter.
+func getLeaseID(c echo.Context) (int64, error) {
+	leaseID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || leaseID == 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, errLeaseIDInvalid)
+	}
+	return leaseID, nil
+}
+
+// GrantLease creates a new lease that keys can be attached to via lease_id.
+func (h *Handler) GrantLease(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req LeaseRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if req.TTL <= 0 || req.TTL > int64(h.Config.MaxTTLSeconds) {
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("TTL must be between 1 and %d seconds", h.Config.MaxTTLSeconds))
+	}
+
+	leaseID, err := h.Store.Grant(ctx, req.TTL)
+	if err != nil {
+		return storeError(c, err, "Could not grant lease")
+	}
+	owner := store.KVItem{Key: h.getLeaseOwnerKey(leaseID), Value: h.getNamespace(c) + "/" + h.getAppName(c), LeaseID: leaseID}
+	if err := h.Store.SetMany(ctx, []store.KVItem{owner}); err != nil {
+		h.Store.Revoke(context.WithoutCancel(ctx), leaseID)
+		return storeError(c, err, "Could not grant lease")
+	}
+	return c.JSON(http.StatusCreated, LeaseResponse{ID: leaseID, TTL: req.TTL})
+}
+
+// KeepAliveLease refreshes a lease once, resetting its TTL to the granted TTL. Only leases of
+// the caller's namespace/app can be refreshed, see ownedLease.
+func (h *Handler) KeepAliveLease(c echo.Context) error {
+	ctx := c.Request().Context()
+	leaseID, err := getLeaseID(c)
+	if err != nil {
+		return err
+	}
+	if _, err := h.ownedLease(ctx, h.getNamespace(c), h.getAppName(c), leaseID); errors.Is(err, store.ErrLeaseNotFound) {
+		return apierror.JSON(c, http.StatusNotFound, errLeaseNotFound)
+	} else if err != nil {
+		return storeError(c, err, "Could not refresh lease")
+	}
+
+	ttl, err := h.Store.KeepAlive(ctx, leaseID)
+	if errors.Is(err, store.ErrLeaseNotFound) {
+		return apierror.JSON(c, http.StatusNotFound, errLeaseNotFound)
+	}
+	if err != nil {
+		return storeError(c, err, "Could not refresh lease")
+	}
+	return c.JSON(http.StatusOK, LeaseResponse{ID: leaseID, TTL: ttl})
+}
+
+// GetLease returns the remaining TTL of a lease and the caller's keys attached to it.
+func (h *Handler) GetLease(c echo.Context) error {
+	ctx := c.Request().Context()
+	leaseID, err := getLeaseID(c)
+	if err != nil {
+		return err
+	}
+
+	info, err := h.ownedLease(ctx, h.getNamespace(c), h.getAppName(c), leaseID)
+	if errors.Is(err, store.ErrLeaseNotFound) {
+		return apierror.JSON(c, http.StatusNotFound, errLeaseNotFound)
+	}
+	if err != nil {
+		return storeError(c, err, "Could not get lease")
+	}
+
+	// Leave out the owner record, keys are shown relative to the namespace/app
+	prefix := h.getKVPrefix(h.getNamespace(c), h.getAppName(c))
+	keys := make([]string, 0, len(info.Keys))
+	for _, key := range info.Keys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, strings.TrimPrefix(key, prefix))
+		}
+	}
+
+	return c.JSON(http.StatusOK, LeaseResponse{
+		ID:         leaseID,
+		TTL:        info.TTL,
+		GrantedTTL: info.GrantedTTL,
+		Keys:       keys,
+	})
+}
+
+// RevokeLease revokes a lease, deleting every key attached to it. Only leases of the caller's
+// namespace/app can be revoked, see ownedLease.
+func (h *Handler) RevokeLease(c echo.Context) error {
+	ctx := c.Request().Context()
+	leaseID, err := getLeaseID(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.ownedLease(ctx, h.getNamespace(c), h.getAppName(c), leaseID); errors.Is(err, store.ErrLeaseNotFound) {
+		return apierror.JSON(c, http.StatusNotFound, errLeaseNotFound)
+	} else if err != nil {
+		return storeError(c, err, "Could not revoke lease")
+	}
+
+	if err := h.Store.Revoke(ctx, leaseID); errors.Is(err, store.ErrLeaseNotFound) {
+		return apierror.JSON(c, http.StatusNotFound, errLeaseNotFound)
+	} else if err != nil {
+		return storeError(c, err, "Could not revoke lease")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+)
+
+// LockRequest represents a lock acquire or release request.
+type LockRequest struct {
+	Owner string `json:"owner"`           // Owner ID, required to acquire
+	TTL   int64  `json:"ttl,omitempty"`   // Lock TTL in seconds
+	Token string `json:"token,omitempty"` // Lock token, required to release
+}
+
+// AcquireLock creates the key as a lock if it is absent.
+func (h *Handler) AcquireLock(c echo.Context) error {
+	ctx := c.Request().Context()
+	key := c.Param("key")
+	if key == "" {
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
+	}
+	var req LockRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if req.Owner == "" {
+		return apierror.JSON(c, http.StatusBadRequest, "Owner must not be empty")
+	}
+	// If TTL is not set, use default TTL
+	if req.TTL == 0 {
+		req.TTL = int64(h.Config.DefaultTTL)
+	}
+	// A lock must always expire, otherwise a crashed owner holds it forever
+	if req.TTL <= 0 || req.TTL > int64(h.Config.MaxTTLSeconds) {
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("TTL must be between 1 and %d seconds", h.Config.MaxTTLSeconds))
+	}
+	prefixedKey, err := h.getKVPrefixedKey(c, key)
+	if err != nil {
+		return err
+	}
+	if err := h.checkSiloLimits(ctx, h.getNamespace(c), h.getAppName(c)); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return storeError(c, err, "Could not acquire lock")
+	}
+
+	token := uuid.New().String()
+	info, acquired, err := h.Store.Acquire(ctx, prefixedKey, req.Owner, token, req.TTL)
+	if err != nil {
+		return storeError(c, err, "Could not acquire lock")
+	}
+	if !acquired {
+		return apierror.JSONWithDetails(c, http.StatusConflict, "Lock is already held", map[string]any{
+			"key":       key,
+			"owner":     info.Owner,
+			"expire_at": info.ExpireAt,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"key":       key,
+		"owner":     info.Owner,
+		"token":     token,
+		"ttl":       req.TTL,
+		"expire_at": info.ExpireAt,
+	})
+}
+
+// ReleaseLock deletes a lock key if the given token matches the current holder.
+func (h *Handler) ReleaseLock(c echo.Context) error {
+	ctx := c.Request().Context()
+	key := c.Param("key")
+	if key == "" {
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
+	}
+	var req LockRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if req.Token == "" {
+		return apierror.JSON(c, http.StatusBadRequest, "Token must not be empty")
+	}
+	prefixedKey, err := h.getKVPrefixedKey(c, key)
+	if err != nil {
+		return err
+	}
+
+	released, err := h.Store.Release(ctx, prefixedKey, req.Token)
+	if err != nil {
+		return storeError(c, err, "Could not release lock")
+	}
+	if !released {
+		return apierror.JSON(c, http.StatusConflict, "Lock is not held with this token")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+const (
+	multiListMaxPrefixes = 50
+	multiListWorkers     = 4
+)
+
+// MultiListRequest represents a request to list the keys under several prefixes.
+type MultiListRequest struct {
+	Prefixes []string `json:"prefixes"`
+}
+
+// MultiListResponse holds the keys found under each requested prefix.
+type MultiListResponse struct {
+	Results   map[string][]KVResponse `json:"results"`
+	Truncated bool                    `json:"truncated"` // Set when MAX_LIST_RESULTS cut the results short
+}
+
+// MultiListKeyValues lists the keys under several prefixes of the caller's namespace/app in one request.
+// Prefixes are fetched concurrently by a bounded pool of workers, and the combined result is capped at
+// MAX_LIST_RESULTS keys, filled in the order the prefixes were requested.
+func (h *Handler) MultiListKeyValues(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req MultiListRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if len(req.Prefixes) == 0 {
+		return apierror.JSON(c, http.StatusBadRequest, "Prefixes must not be empty")
+	}
+	if len(req.Prefixes) > multiListMaxPrefixes {
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("Too many prefixes (max %d)", multiListMaxPrefixes))
+	}
+	prefixedKeys := make([]string, len(req.Prefixes))
+	for i, prefix := range req.Prefixes {
+		prefixedKey, err := h.getKVPrefixedKey(c, prefix)
+		if err != nil {
+			return err
+		}
+		prefixedKeys[i] = prefixedKey
+	}
+
+	// No single prefix can contribute more than the overall cap, so fetch at most that many keys each
+	limit := int64(h.Config.MaxListResults)
+	items := make([][]*store.KVItem, len(prefixedKeys))
+	truncated := make([]bool, len(prefixedKeys))
+	errs := make([]error, len(prefixedKeys))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(multiListWorkers, len(prefixedKeys)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if limit > 0 {
+					var nextKey string
+					items[i], nextKey, _, errs[i] = h.Store.PageAtRevision(ctx, prefixedKeys[i], limit, "", 0)
+					truncated[i] = nextKey != ""
+				} else {
+					items[i], errs[i] = h.Store.All(ctx, prefixedKeys[i])
+				}
+			}
+		}()
+	}
+	for i := range prefixedKeys {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	response := MultiListResponse{Results: make(map[string][]KVResponse, len(req.Prefixes))}
+	remaining := limit
+	for i, prefix := range req.Prefixes {
+		if errs[i] != nil {
+			return storeError(c, errs[i], "Could not list keys")
+		}
+		if _, seen := response.Results[prefix]; seen {
+			continue
+		}
+		group := items[i]
+		if limit > 0 {
+			if int64(len(group)) > remaining {
+				group = group[:remaining]
+				truncated[i] = true
+			}
+			remaining -= int64(len(group))
+		}
+		response.Truncated = response.Truncated || truncated[i]
+
+		responses := make([]KVResponse, 0, len(group))
+		for _, kv := range group {
+			responses = append(responses, h.buildKVResponse(c, kv))
+		}
+		response.Results[prefix] = responses
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// RollbackRequest represents a request to restore a key to a past revision.
+type RollbackRequest struct {
+	Rev int64 `json:"rev"`           // etcd revision to restore the key's value from
+	TTL int64 `json:"ttl,omitempty"` // TTL in seconds of the restored key, defaults to DEFAULT_TTL_SECONDS
+}
+
+// RollbackKeyValue writes the value a key had at a past revision back as its current value,
+// with the checksum, content type, tags and encoding it had then. The write is validated and
+// fires webhooks like an update, or a create if the key no longer exists, and honors If-Match.
+func (h *Handler) RollbackKeyValue(c echo.Context) error {
+	ctx := c.Request().Context()
+	key := c.Param("key")
+	if key == "" {
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
+	}
+	var req RollbackRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if req.Rev <= 0 {
+		return apierror.JSON(c, http.StatusBadRequest, "Revision must be a positive number")
+	}
+	prefixedKey, err := h.getKVPrefixedKey(c, key)
+	if err != nil {
+		return err
+	}
+
+	past, found, err := h.Store.GetAtRevision(ctx, prefixedKey, req.Rev)
+	switch {
+	case errors.Is(err, store.ErrCompacted):
+		return apierror.JSON(c, http.StatusGone, "Revision has been compacted, the value can no longer be restored")
+	case errors.Is(err, store.ErrFutureRevision):
+		return apierror.JSON(c, http.StatusBadRequest, errFutureRevision)
+	case err != nil:
+		return storeError(c, err, "Could not read key-value pair")
+	case !found:
+		return apierror.JSON(c, http.StatusNotFound, "Key did not exist at that revision")
+	}
+
+	kv := KeyValue{
+		Value:       encodedValue(past),
+		TTL:         req.TTL,
+		Checksum:    past.Checksum,
+		ContentType: past.ContentType,
+		Tags:        past.Tags,
+		Encoding:    past.Encoding,
+	}
+	if msg := h.validateKeyValue(&kv); msg != "" {
+		return apierror.JSON(c, http.StatusBadRequest, msg)
+	}
+	if msg := checkValueFormat(c, &kv); msg != "" {
+		return apierror.JSON(c, http.StatusBadRequest, msg)
+	}
+	if kv.TTL == 0 {
+		kv.TTL = int64(h.Config.DefaultTTL)
+	}
+	if err := h.applyTTLJitter(c, &kv); err != nil {
+		return err
+	}
+	if err := h.checkSiloLimits(ctx, h.getNamespace(c), h.getAppName(c)); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return storeError(c, err, "Could not roll back key-value pair")
+	}
+	var kvItem, prev *store.KVItem
+	if expected := c.Request().Header.Values("If-Match"); len(expected) > 0 {
+		kvItem, prev, err = h.compareAndSwapKeyValue(ctx, prefixedKey, &kv, expected[0])
+	} else {
+		kvItem, prev, err = h.putKeyValue(ctx, prefixedKey, &kv)
+	}
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return storeError(c, err, "Could not roll back key-value pair")
+	}
+	return c.JSON(http.StatusOK, KeyValue{
+		Key:              key,
+		Value:            kv.Value,
+		TTL:              kv.TTL,
+		LeaseID:          kv.LeaseID,
+		Checksum:         kvItem.Checksum,
+		ContentType:      kv.ContentType,
+		Tags:             kv.Tags,
+		Encoding:         kv.Encoding,
+		WebhookResponses: h.deliverBlockingWebhooks(ctx, prefixedKey, writeEvent(prev), kvItem, prev),
+	})
+}
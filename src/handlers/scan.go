@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+const scanBatchSize = 100
+
+// maxTreeScanKeys caps the keys of a tree scan, which is built in memory before being written.
+const maxTreeScanKeys = 10000
+
+// treeValueKey holds the value of a key that also has keys below it in a tree scan, such as
+// "a" when "a/b" exists too.
+const treeValueKey = "_value"
+
+// errTreeTooLarge is returned by treeScanWriter when a scan has more than maxTreeScanKeys keys.
+var errTreeTooLarge = errors.New("tree scan has too many keys")
+
+var (
+	scanFormats = []string{"json", "ndjson", "csv", "tree"}
+	scanFields  = []string{"all", "keys", "values"}
+)
+
+// scanOptions holds the parsed query options of a scan request.
+type scanOptions struct {
+	prefix        string
+	keyRegex      *regexp.Regexp
+	valueContains string
+	valueRegex    *regexp.Regexp
+	fields        string
+	format        string
+	ttl           *ttlFilter
+}
+
+// scanItem is a single scanned key-value pair, projected according to the fields option.
+type scanItem struct {
+	Key   *string `json:"key,omitempty"`
+	Value *string `json:"value,omitempty"`
+	TTL   *int64  `json:"ttl,omitempty"`
+}
+
+// parseScanOptions reads and validates the scan query parameters.
+func parseScanOptions(c echo.Context) (*scanOptions, error) {
+	opts := &scanOptions{
+		prefix:        c.QueryParam("prefix"),
+		valueContains: c.QueryParam("value_contains"),
+		fields:        c.QueryParam("fields"),
+		format:        c.QueryParam("format"),
+	}
+	if opts.fields == "" {
+		opts.fields = "all"
+	}
+	if opts.format == "" {
+		opts.format = "json"
+	}
+	if !slices.Contains(scanFields, opts.fields) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Fields must be one of: "+strings.Join(scanFields, ", "))
+	}
+	if !slices.Contains(scanFormats, opts.format) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Format must be one of: "+strings.Join(scanFormats, ", "))
+	}
+	if opts.format == "tree" && opts.fields == "values" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Format tree needs keys, fields=values cannot be used with it")
+	}
+	ttl, err := parseTTLFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	opts.ttl = ttl
+	if pattern := c.QueryParam("key_regex"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid key_regex: "+err.Error())
+		}
+		opts.keyRegex = re
+	}
+	if pattern := c.QueryParam("value_regex"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid value_regex: "+err.Error())
+		}
+		opts.valueRegex = re
+	}
+	return opts, nil
+}
+
+// matches reports whether a key-value pair passes every filter.
+func (o *scanOptions) matches(key, value string) bool {
+	if o.keyRegex != nil && !o.keyRegex.MatchString(key) {
+		return false
+	}
+	if o.valueContains != "" && !strings.Contains(value, o.valueContains) {
+		return false
+	}
+	if o.valueRegex != nil && !o.valueRegex.MatchString(value) {
+		return false
+	}
+	return true
+}
+
+// project builds the output item for a key-value pair according to the fields option.
+func (o *scanOptions) project(key string, kv *store.KVItem) scanItem {
+	item := scanItem{}
+	if o.fields != "values" {
+		item.Key = &key
+	}
+	if o.fields != "keys" {
+		value := encodedValue(kv)
+		item.Value = &value
+		item.TTL = kv.TTL
+	}
+	return item
+}
+
+// ScanKeyValues streams the key-value pairs under a prefix, filtered and projected server-side.
+func (h *Handler) ScanKeyValues(c echo.Context) error {
+	ctx := c.Request().Context()
+	opts, err := parseScanOptions(c)
+	if err != nil {
+		return err
+	}
+	namespacePrefix, err := h.getKVPrefixedKey(c, "")
+	if err != nil {
+		return err
+	}
+
+	var writer scanWriter
+	switch opts.format {
+	case "ndjson":
+		writer = &ndjsonScanWriter{}
+	case "csv":
+		writer = &csvScanWriter{fields: opts.fields}
+	case "tree":
+		writer = &treeScanWriter{tree: map[string]any{}}
+	default:
+		writer = &jsonScanWriter{}
+	}
+
+	// A tree is only written once complete, so its errors can still get a proper status
+	_, buffered := writer.(*treeScanWriter)
+	res := c.Response()
+	if !buffered {
+		res.Header().Set(echo.HeaderContentType, writer.contentType())
+		res.WriteHeader(http.StatusOK)
+		if err := writer.begin(res); err != nil {
+			return nil
+		}
+	}
+
+	count := 0
+	err = h.Store.Scan(ctx, namespacePrefix+opts.prefix, scanBatchSize, func(kv *store.KVItem) error {
+		key := strings.TrimPrefix(kv.Key, namespacePrefix)
+		if !opts.matches(key, kv.Value) || !opts.ttl.matches(kv) {
+			return nil
+		}
+		if err := writer.write(res, opts.project(key, kv)); err != nil {
+			return err
+		}
+		count++
+		if count%scanBatchSize == 0 {
+			res.Flush()
+		}
+		return nil
+	})
+	if err != nil && buffered {
+		if errors.Is(err, errTreeTooLarge) {
+			return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("Format tree is limited to %d keys, narrow the prefix or use ndjson", maxTreeScanKeys))
+		}
+		return storeError(c, err, "Could not scan keys")
+	}
+	if err != nil {
+		// Headers are already sent, the client sees a truncated body
+		log.Printf("Error scanning prefix %s: %v", namespacePrefix+opts.prefix, err)
+		return nil
+	}
+	if buffered {
+		res.Header().Set(echo.HeaderContentType, writer.contentType())
+		res.WriteHeader(http.StatusOK)
+	}
+	writer.end(res)
+	return nil
+}
+
+// scanWriter renders scanned items in a specific output format.
+type scanWriter interface {
+	contentType() string
+	begin(w http.ResponseWriter) error
+	write(w http.ResponseWriter, item scanItem) error
+	end(w http.ResponseWriter) error
+}
+
+// jsonScanWriter streams items as a JSON array.
+type jsonScanWriter struct {
+	count int
+}
+
+func (j *jsonScanWriter) contentType() string { return echo.MIMEApplicationJSON }
+
+func (j *jsonScanWriter) begin(w http.ResponseWriter) error {
+	_, err := w.Write([]byte("["))
+	return err
+}
+
+func (j *jsonScanWriter) write(w http.ResponseWriter, item scanItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if j.count > 0 {
+		data = append([]byte(","), data...)
+	}
+	j.count++
+	_, err = w.Write(data)
+	return err
+}
+
+func (j *jsonScanWriter) end(w http.ResponseWriter) error {
+	_, err := w.Write([]byte("]"))
+	return err
+}
+
+// ndjsonScanWriter streams items as newline-delimited JSON.
+type ndjsonScanWriter struct{}
+
+func (n *ndjsonScanWriter) contentType() string { return "application/x-ndjson" }
+
+func (n *ndjsonScanWriter) begin(w http.ResponseWriter) error { return nil }
+
+func (n *ndjsonScanWriter) write(w http.ResponseWriter, item scanItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func (n *ndjsonScanWriter) end(w http.ResponseWriter) error { return nil }
+
+// csvScanWriter streams items as CSV with a header row matching the fields option.
+type csvScanWriter struct {
+	fields string
+	csv    *csv.Writer
+}
+
+func (v *csvScanWriter) contentType() string { return "text/csv; charset=UTF-8" }
+
+func (v *csvScanWriter) begin(w http.ResponseWriter) error {
+	v.csv = csv.NewWriter(w)
+	switch v.fields {
+	case "keys":
+		return v.csv.Write([]string{"key"})
+	case "values":
+		return v.csv.Write([]string{"value", "ttl"})
+	default:
+		return v.csv.Write([]string{"key", "value", "ttl"})
+	}
+}
+
+func (v *csvScanWriter) write(w http.ResponseWriter, item scanItem) error {
+	var record []string
+	if item.Key != nil {
+		record = append(record, *item.Key)
+	}
+	if item.Value != nil {
+		ttl := ""
+		if item.TTL != nil {
+			ttl = strconv.FormatInt(*item.TTL, 10)
+		}
+		record = append(record, *item.Value, ttl)
+	}
+	if err := v.csv.Write(record); err != nil {
+		return err
+	}
+	v.csv.Flush()
+	return v.csv.Error()
+}
+
+func (v *csvScanWriter) end(w http.ResponseWriter) error {
+	v.csv.Flush()
+	return v.csv.Error()
+}
+
+// treeScanWriter renders items as a nested JSON object split on "/" in keys.
+// Unlike the other formats the tree is built in memory and written at the end, so it is
+// limited to maxTreeScanKeys keys. A key with keys below it keeps its value in treeValueKey.
+type treeScanWriter struct {
+	tree  map[string]any
+	count int
+}
+
+func (t *treeScanWriter) contentType() string { return echo.MIMEApplicationJSON }
+
+func (t *treeScanWriter) begin(w http.ResponseWriter) error { return nil }
+
+func (t *treeScanWriter) write(w http.ResponseWriter, item scanItem) error {
+	if item.Key == nil {
+		return nil // A tree needs keys, values-only items have nowhere to go
+	}
+	if t.count == maxTreeScanKeys {
+		return errTreeTooLarge
+	}
+	t.count++
+	var leaf any
+	if item.Value != nil {
+		leaf = *item.Value
+	}
+	node := t.tree
+	parts := strings.Split(*item.Key, "/")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := node[part].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			if value, isLeaf := node[part]; isLeaf {
+				child[treeValueKey] = value // "a" was written before "a/b"
+			}
+			node[part] = child
+		}
+		node = child
+	}
+	last := parts[len(parts)-1]
+	if child, ok := node[last].(map[string]any); ok {
+		child[treeValueKey] = leaf // "a/b" was written before "a"
+	} else {
+		node[last] = leaf
+	}
+	return nil
+}
+
+func (t *treeScanWriter) end(w http.ResponseWriter) error {
+	return json.NewEncoder(w).Encode(t.tree)
+}
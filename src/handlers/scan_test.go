@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+func scanContext(query string) echo.Context {
+	req := httptest.NewRequest(http.MethodGet, "/scan?"+query, nil)
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+func TestParseScanOptions(t *testing.T) {
+	tests := []struct {
+		query          string
+		valid          bool
+		fields, format string
+	}{
+		{"", true, "all", "json"},
+		{"fields=keys&format=csv", true, "keys", "csv"},
+		{"fields=values&format=ndjson", true, "values", "ndjson"},
+		{"fields=keys&format=tree", true, "keys", "tree"},
+		{"fields=values&format=tree", false, "", ""},
+		{"fields=names", false, "", ""},
+		{"format=xml", false, "", ""},
+		{"key_regex=(", false, "", ""},
+		{"value_regex=[", false, "", ""},
+	}
+	for _, tt := range tests {
+		opts, err := parseScanOptions(scanContext(tt.query))
+		if (err == nil) != tt.valid {
+			t.Errorf("parseScanOptions(%q) error = %v, want valid %v", tt.query, err, tt.valid)
+			continue
+		}
+		if tt.valid && (opts.fields != tt.fields || opts.format != tt.format) {
+			t.Errorf("parseScanOptions(%q) = fields %q, format %q, want %q, %q", tt.query, opts.fields, opts.format, tt.fields, tt.format)
+		}
+	}
+}
+
+func TestScanOptionsMatches(t *testing.T) {
+	tests := []struct {
+		query      string
+		key, value string
+		want       bool
+	}{
+		{"", "any", "thing", true},
+		{"key_regex=^config/db", "config/db/host", "x", true},
+		{"key_regex=^config/db", "config/cache", "x", false},
+		{"value_contains=prod", "k", "db.prod.local", true},
+		{"value_contains=prod", "k", "db.dev.local", false},
+		{"value_regex=^[0-9]%2B$", "k", "42", true},
+		{"value_regex=^[0-9]%2B$", "k", "4x2", false},
+		// Filters are combined, an item must pass all of them
+		{"key_regex=^a&value_contains=x", "ab", "xy", true},
+		{"key_regex=^a&value_contains=x", "ab", "yy", false},
+		{"key_regex=^a&value_contains=x", "ba", "xy", false},
+	}
+	for _, tt := range tests {
+		opts, err := parseScanOptions(scanContext(tt.query))
+		if err != nil {
+			t.Fatalf("parseScanOptions(%q): %v", tt.query, err)
+		}
+		if got := opts.matches(tt.key, tt.value); got != tt.want {
+			t.Errorf("%q: matches(%q, %q) = %v, want %v", tt.query, tt.key, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestScanOptionsProject(t *testing.T) {
+	ttl := int64(30)
+	kv := &store.KVItem{Value: "v", TTL: &ttl}
+	for _, fields := range scanFields {
+		item := (&scanOptions{fields: fields}).project("k", kv)
+		if (item.Key != nil) != (fields != "values") {
+			t.Errorf("fields=%s: key present = %v", fields, item.Key != nil)
+		}
+		if (item.Value != nil) != (fields != "keys") || (item.TTL != nil) != (fields != "keys") {
+			t.Errorf("fields=%s: value present = %v, ttl present = %v", fields, item.Value != nil, item.TTL != nil)
+		}
+	}
+}
+
+// writeScan renders items with w and returns the body.
+func writeScan(t *testing.T, w scanWriter, items ...scanItem) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	if err := w.begin(rec); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if err := w.write(rec, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.end(rec); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Body.String()
+}
+
+func keyValue(key, value string) scanItem {
+	return scanItem{Key: &key, Value: &value}
+}
+
+func keyOnly(key string) scanItem {
+	return scanItem{Key: &key}
+}
+
+func TestScanWriters(t *testing.T) {
+	items := []scanItem{keyValue("a", "1"), keyValue("b/c", "x,y")}
+	tests := []struct {
+		name   string
+		writer scanWriter
+		want   string
+	}{
+		{"json", &jsonScanWriter{}, `[{"key":"a","value":"1"},{"key":"b/c","value":"x,y"}]`},
+		{"ndjson", &ndjsonScanWriter{}, "{\"key\":\"a\",\"value\":\"1\"}\n{\"key\":\"b/c\",\"value\":\"x,y\"}\n"},
+		{"csv", &csvScanWriter{fields: "all"}, "key,value,ttl\na,1,\nb/c,\"x,y\",\n"},
+		{"tree", &treeScanWriter{tree: map[string]any{}}, "{\"a\":\"1\",\"b\":{\"c\":\"x,y\"}}\n"},
+	}
+	for _, tt := range tests {
+		if got := writeScan(t, tt.writer, items...); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTreeScanWriterCollisions(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []scanItem
+		want  map[string]any
+	}{
+		{
+			"parent first",
+			[]scanItem{keyValue("a", "1"), keyValue("a/b", "2")},
+			map[string]any{"a": map[string]any{"_value": "1", "b": "2"}},
+		},
+		{
+			"child first",
+			[]scanItem{keyValue("a/b", "2"), keyValue("a", "1")},
+			map[string]any{"a": map[string]any{"_value": "1", "b": "2"}},
+		},
+		{
+			"deep",
+			[]scanItem{keyValue("a", "1"), keyValue("a/b", "2"), keyValue("a/b/c", "3")},
+			map[string]any{"a": map[string]any{"_value": "1", "b": map[string]any{"_value": "2", "c": "3"}}},
+		},
+		{
+			"keys only",
+			[]scanItem{keyOnly("a"), keyOnly("a/b")},
+			map[string]any{"a": map[string]any{"_value": nil, "b": nil}},
+		},
+	}
+	for _, tt := range tests {
+		var got map[string]any
+		if err := json.Unmarshal([]byte(writeScan(t, &treeScanWriter{tree: map[string]any{}}, tt.items...)), &got); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTreeScanWriterLimit(t *testing.T) {
+	w := &treeScanWriter{tree: map[string]any{}}
+	rec := httptest.NewRecorder()
+	for i := 0; i < maxTreeScanKeys; i++ {
+		if err := w.write(rec, keyOnly("k")); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	if err := w.write(rec, keyOnly("k")); !errors.Is(err, errTreeTooLarge) {
+		t.Errorf("write past the limit = %v, want errTreeTooLarge", err)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("tree wrote %d bytes before the end", rec.Body.Len())
+	}
+}
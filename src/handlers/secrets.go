@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// secretRefPattern matches ${secret:name} references in webhook endpoints and headers.
+var secretRefPattern = regexp.MustCompile(`\$\{secret:([A-Za-z0-9_.-]+)\}`)
+
+// getSecretKey returns the etcd key of a namespace's named secret.
+func (h *Handler) getSecretKey(namespace, name string) string {
+	return "/" + h.Config.BaseKeyPrefix + "/secrets/" + namespace + "/" + name
+}
+
+// resolveSecrets replaces every ${secret:name} reference in s with the secret's value, and
+// returns the values used so they can be redacted from error messages.
+// It fails if any referenced secret cannot be found, rather than sending the reference as-is.
+func (h *Handler) resolveSecrets(ctx context.Context, namespace, s string) (string, []string, error) {
+	if !strings.Contains(s, "${secret:") {
+		return s, nil, nil
+	}
+	var (
+		resolveErr error
+		secrets    []string
+	)
+	resolved := secretRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := secretRefPattern.FindStringSubmatch(ref)[1]
+		value, err := h.lookupSecret(ctx, namespace, name)
+		if err != nil && resolveErr == nil {
+			resolveErr = err
+		}
+		secrets = append(secrets, value)
+		return value
+	})
+	if resolveErr != nil {
+		return "", nil, resolveErr
+	}
+	return resolved, secrets, nil
+}
+
+// lookupSecret finds a namespace's named secret, looking in order at the namespace's etcd
+// secrets and its WEBHOOK_SECRETS_DIR subdirectory. Secrets are always scoped to the
+// namespace, so a webhook can't read another tenant's secrets by guessing their names.
+func (h *Handler) lookupSecret(ctx context.Context, namespace, name string) (string, error) {
+	kvItem, found, err := h.Store.Get(ctx, h.getSecretKey(namespace, name))
+	if err != nil {
+		return "", fmt.Errorf("secret %q: %w", name, err)
+	}
+	if found {
+		return kvItem.Value, nil
+	}
+
+	if h.Config.WebhookSecretsDir != "" && isSecretPathSegment(namespace) && isSecretPathSegment(name) {
+		data, err := os.ReadFile(filepath.Join(h.Config.WebhookSecretsDir, namespace, name))
+		if err == nil {
+			return strings.TrimRight(string(data), "\r\n"), nil
+		}
+	}
+	return "", fmt.Errorf("secret %q not found", name)
+}
+
+// isSecretPathSegment reports whether s can be used as one path segment below
+// WEBHOOK_SECRETS_DIR without leaving it.
+func isSecretPathSegment(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, `/\`)
+}
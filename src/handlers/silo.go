@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// getRegistryPrefix returns the prefix under which namespaces and apps are registered.
+func (h *Handler) getRegistryPrefix() string {
+	return "/" + h.Config.BaseKeyPrefix + "/registry/"
+}
+
+// checkSiloLimits registers the namespace/app of a write, rejecting it with 400 if it would
+// create a new namespace or app beyond MAX_NAMESPACES or MAX_APPS_PER_NAMESPACE.
+func (h *Handler) checkSiloLimits(ctx context.Context, namespace, appName string) error {
+	return h.enforceSiloLimits(ctx, namespace, appName, true)
+}
+
+// enforceSiloLimits implements checkSiloLimits. Dry runs pass register as false to check the
+// limits without registering the namespace/app.
+func (h *Handler) enforceSiloLimits(ctx context.Context, namespace, appName string, register bool) error {
+	if h.Config.MaxNamespaces <= 0 && h.Config.MaxAppsPerNamespace <= 0 {
+		return nil
+	}
+	silo := namespace + "/" + appName
+	if _, ok := h.knownSilos.Load(silo); ok {
+		return nil
+	}
+
+	namespaceMarker := h.getRegistryPrefix() + "namespaces/" + namespace
+	appsPrefix := h.getRegistryPrefix() + "apps/" + namespace + "/"
+	appMarker := appsPrefix + appName
+
+	_, found, err := h.Store.Get(ctx, appMarker)
+	if err != nil {
+		return err
+	}
+	if found {
+		h.knownSilos.Store(silo, true)
+		return nil
+	}
+
+	// Namespaces/apps holding keys from before the limit was enabled are registered as they are
+	existing, err := h.Store.Count(ctx, h.getKVPrefix(namespace, appName))
+	if err != nil {
+		return err
+	}
+	if existing == 0 {
+		if err := h.checkNamespaceLimit(ctx, namespace, namespaceMarker); err != nil {
+			return err
+		}
+		if h.Config.MaxAppsPerNamespace > 0 {
+			apps, err := h.Store.Count(ctx, appsPrefix)
+			if err != nil {
+				return err
+			}
+			if apps >= int64(h.Config.MaxAppsPerNamespace) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("App limit reached for namespace (max %d)", h.Config.MaxAppsPerNamespace))
+			}
+		}
+	}
+	if !register {
+		return nil
+	}
+
+	if err := h.Store.Set(ctx, namespaceMarker, "", 0); err != nil {
+		return err
+	}
+	if err := h.Store.Set(ctx, appMarker, "", 0); err != nil {
+		return err
+	}
+	h.knownSilos.Store(silo, true)
+	return nil
+}
+
+// checkNamespaceLimit rejects a new namespace once MAX_NAMESPACES namespaces are registered.
+func (h *Handler) checkNamespaceLimit(ctx context.Context, namespace, namespaceMarker string) error {
+	if h.Config.MaxNamespaces <= 0 {
+		return nil
+	}
+	_, found, err := h.Store.Get(ctx, namespaceMarker)
+	if err != nil || found {
+		return err
+	}
+	existing, err := h.Store.Count(ctx, "/"+h.Config.BaseKeyPrefix+"/kv/"+namespace+"/")
+	if err != nil || existing > 0 {
+		return err
+	}
+	namespaces, err := h.Store.Count(ctx, h.getRegistryPrefix()+"namespaces/")
+	if err != nil {
+		return err
+	}
+	if namespaces >= int64(h.Config.MaxNamespaces) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Namespace limit reached (max %d)", h.Config.MaxNamespaces))
+	}
+	return nil
+}
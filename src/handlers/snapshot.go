@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+
+	errInvalidCursor  = "Invalid cursor"
+	errCompacted      = "Revision has been compacted, restart the listing"
+	errFutureRevision = "Revision is in the future"
+)
+
+// SnapshotResponse is one page of a consistent namespace listing.
+type SnapshotResponse struct {
+	Revision   int64        `json:"revision"`
+	Items      []KVResponse `json:"items"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// parsePageLimit reads the ?limit= query parameter.
+func parsePageLimit(c echo.Context) (int64, error) {
+	limitParam := c.QueryParam("limit")
+	if limitParam == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.ParseInt(limitParam, 10, 64)
+	if err != nil || limit <= 0 || limit > maxPageLimit {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", maxPageLimit))
+	}
+	return limit, nil
+}
+
+// parseRevision reads the ?rev= query parameter, 0 if it is not set.
+func parseRevision(c echo.Context) (int64, error) {
+	revParam := c.QueryParam("rev")
+	if revParam == "" {
+		return 0, nil
+	}
+	rev, err := strconv.ParseInt(revParam, 10, 64)
+	if err != nil || rev <= 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Revision must be a positive number")
+	}
+	return rev, nil
+}
+
+// encodeCursor builds an opaque cursor from the next prefixed key, relative to the namespace prefix.
+func encodeCursor(namespacePrefix, nextKey string) string {
+	if nextKey == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.TrimPrefix(nextKey, namespacePrefix)))
+}
+
+// decodeCursor turns a cursor back into a prefixed key within the namespace prefix.
+func decodeCursor(namespacePrefix, cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, errInvalidCursor)
+	}
+	return namespacePrefix + string(key), nil
+}
+
+// encodeSnapshotCursor builds a snapshot cursor that also carries the revision of the listing, so
+// the following pages cannot be read at another revision.
+func encodeSnapshotCursor(namespacePrefix, nextKey string, rev int64) string {
+	if nextKey == "" {
+		return ""
+	}
+	return encodeCursor(namespacePrefix, strconv.FormatInt(rev, 10)+":"+nextKey)
+}
+
+// decodeSnapshotCursor turns a snapshot cursor back into its revision and prefixed key.
+func decodeSnapshotCursor(namespacePrefix, cursor string) (int64, string, error) {
+	if cursor == "" {
+		return 0, "", nil
+	}
+	decoded, err := decodeCursor("", cursor)
+	if err != nil {
+		return 0, "", err
+	}
+	revPart, key, ok := strings.Cut(decoded, ":")
+	rev, err := strconv.ParseInt(revPart, 10, 64)
+	if !ok || err != nil || rev <= 0 {
+		return 0, "", echo.NewHTTPError(http.StatusBadRequest, errInvalidCursor)
+	}
+	return rev, namespacePrefix + key, nil
+}
+
+// GetSnapshot lists the keys of the caller's namespace/app page by page, all pages read at the
+// revision captured by the first page so the listing is one consistent point-in-time view. The
+// cursor carries that revision, and a ?rev= that disagrees with it is rejected.
+func (h *Handler) GetSnapshot(c echo.Context) error {
+	ctx := c.Request().Context()
+	limit, err := parsePageLimit(c)
+	if err != nil {
+		return err
+	}
+	rev, err := parseRevision(c)
+	if err != nil {
+		return err
+	}
+	namespacePrefix, err := h.getKVPrefixedKey(c, "")
+	if err != nil {
+		return err
+	}
+	prefix := namespacePrefix + c.QueryParam("prefix")
+	cursorRev, fromKey, err := decodeSnapshotCursor(namespacePrefix, c.QueryParam("cursor"))
+	if err != nil {
+		return err
+	}
+	if fromKey != "" && !strings.HasPrefix(fromKey, prefix) {
+		return apierror.JSON(c, http.StatusBadRequest, errInvalidCursor)
+	}
+	if cursorRev != 0 {
+		if rev != 0 && rev != cursorRev {
+			return apierror.JSON(c, http.StatusBadRequest, "Cursor belongs to another revision")
+		}
+		rev = cursorRev
+	}
+
+	items, nextKey, rev, err := h.Store.PageAtRevision(ctx, prefix, limit, fromKey, rev)
+	switch {
+	case errors.Is(err, store.ErrCompacted):
+		return apierror.JSON(c, http.StatusGone, errCompacted)
+	case errors.Is(err, store.ErrFutureRevision):
+		return apierror.JSON(c, http.StatusBadRequest, errFutureRevision)
+	case err != nil:
+		return storeError(c, err, "Could not list keys")
+	}
+
+	response := SnapshotResponse{
+		Revision:   rev,
+		Items:      make([]KVResponse, 0, len(items)),
+		NextCursor: encodeSnapshotCursor(namespacePrefix, nextKey, rev),
+	}
+	for _, kv := range items {
+		response.Items = append(response.Items, h.buildKVResponse(c, kv))
+	}
+	return c.JSON(http.StatusOK, response)
+}
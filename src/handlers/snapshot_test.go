@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGetSnapshotCursorKeepsRevision(t *testing.T) {
+	h := newTestHandler(t, nil)
+	put := func(key, value string) {
+		t.Helper()
+		c, rec := newTestContext(http.MethodPut, "/kv/"+key, fmt.Sprintf(`{"value":%q}`, value), "key", key)
+		if status := serve(c, rec, h.UpdateKeyValue); status >= 300 {
+			t.Fatalf("put %s status = %d: %s", key, status, rec.Body)
+		}
+	}
+	snapshot := func(query string) (int, SnapshotResponse) {
+		t.Helper()
+		c, rec := newTestContext(http.MethodGet, "/snapshot?"+query, "")
+		status := serve(c, rec, h.GetSnapshot)
+		var page SnapshotResponse
+		if status == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return status, page
+	}
+	put("a", "1")
+	put("b", "1")
+
+	status, first := snapshot("limit=1")
+	if status != http.StatusOK || first.NextCursor == "" {
+		t.Fatalf("first page status = %d, cursor = %q", status, first.NextCursor)
+	}
+	put("b", "2")
+
+	status, second := snapshot("limit=1&cursor=" + first.NextCursor)
+	if status != http.StatusOK {
+		t.Fatalf("second page status = %d", status)
+	}
+	if second.Revision != first.Revision {
+		t.Errorf("second page revision = %d, want %d", second.Revision, first.Revision)
+	}
+	if len(second.Items) != 1 || second.Items[0].Value != "1" {
+		t.Errorf("second page items = %+v, want b at its snapshot value 1", second.Items)
+	}
+
+	query := fmt.Sprintf("limit=1&rev=%d&cursor=%s", first.Revision+1, first.NextCursor)
+	if status, _ := snapshot(query); status != http.StatusBadRequest {
+		t.Errorf("mismatched rev status = %d, want %d", status, http.StatusBadRequest)
+	}
+	if status, _ := snapshot(fmt.Sprintf("rev=%d", first.Revision+1000)); status != http.StatusBadRequest {
+		t.Errorf("future rev status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error messages of etcd failures clients can retry, see mapStoreError.
+const (
+	errStoreUnavailable = "Store unavailable, retry later"
+	errStoreOverloaded  = "Store overloaded, retry later"
+	errStoreTimeout     = "Store request timed out"
+)
+
+// storeRetryAfter is the Retry-After, in seconds, sent with retryable store errors.
+const storeRetryAfter = "1"
+
+// mapStoreError maps an etcd error to the HTTP status and message a client can act on: 503
+// while etcd is unreachable or has no leader, 429 when it is rejecting requests under load and
+// 504 when a request timed out. Other errors map to 500 with an empty message, for the caller
+// to fill in.
+func mapStoreError(err error) (int, string) {
+	if err == nil {
+		return http.StatusInternalServerError, ""
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, errStoreTimeout
+	}
+	code := status.Code(err)
+	var etcdErr rpctypes.EtcdError
+	if errors.As(err, &etcdErr) {
+		code = etcdErr.Code()
+	}
+	switch code {
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable, errStoreUnavailable
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests, errStoreOverloaded
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout, errStoreTimeout
+	default:
+		return http.StatusInternalServerError, ""
+	}
+}
+
+// storeError answers a request that failed because of err. Retryable etcd failures get their
+// own status and message, with a Retry-After where retrying soon may help; anything else is a
+// 500 with msg.
+func storeError(c echo.Context, err error, msg string) error {
+	status, mapped := mapStoreError(err)
+	if mapped == "" {
+		return apierror.JSON(c, status, msg)
+	}
+	if status == http.StatusServiceUnavailable || status == http.StatusTooManyRequests {
+		c.Response().Header().Set("Retry-After", storeRetryAfter)
+	}
+	return apierror.JSON(c, status, mapped)
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	maxSubscriptions         = 32               // Max prefixes one connection can subscribe to
+	subscriptionSendBuffer   = 256              // Notifications buffered for a client before it is disconnected as too slow
+	subscriptionWriteTimeout = 10 * time.Second // Max time to write one message to a client
+	subscriptionPingInterval = 30 * time.Second // How often idle connections are pinged
+	subscriptionMaxMessage   = 4096             // Max size of a client message
+)
+
+// Subscription actions sent by clients.
+const (
+	subscribeAction   = "subscribe"
+	unsubscribeAction = "unsubscribe"
+)
+
+var subscriptionUpgrader = websocket.Upgrader{}
+
+// SubscriptionRequest is a message sent by a client to subscribe to or unsubscribe from a key prefix.
+type SubscriptionRequest struct {
+	Action string `json:"action"` // subscribe or unsubscribe
+	Prefix string `json:"prefix"` // Key prefix in the caller's namespace/app, "" for all keys
+}
+
+// SubscriptionMessage is a message sent to a subscribed client.
+type SubscriptionMessage struct {
+	Type     string       `json:"type"` // subscribed, unsubscribed, event or error
+	Prefix   string       `json:"prefix"`
+	Event    WebhookEvent `json:"event,omitempty"` // create, update, delete or expire
+	Key      string       `json:"key,omitempty"`
+	Value    *string      `json:"value,omitempty"` // Omitted for delete and expire
+	Encoding string       `json:"encoding,omitempty"`
+	Revision int64        `json:"revision,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// subscriptionConn is one WebSocket client and its subscriptions.
+type subscriptionConn struct {
+	conn     *websocket.Conn
+	send     chan SubscriptionMessage
+	ctx      context.Context
+	cancel   context.CancelFunc
+	tooSlow  bool
+	slowOnce sync.Once
+}
+
+// enqueue queues a message for the client. A client whose buffer is full is disconnected
+// rather than buffering without bound.
+func (s *subscriptionConn) enqueue(msg SubscriptionMessage) {
+	select {
+	case s.send <- msg:
+	case <-s.ctx.Done():
+	default:
+		s.slowOnce.Do(func() {
+			s.tooSlow = true
+			s.cancel()
+		})
+	}
+}
+
+// writeLoop is the only writer of the connection. It closes the connection once ctx is done.
+func (s *subscriptionConn) writeLoop() {
+	ping := time.NewTicker(subscriptionPingInterval)
+	defer ping.Stop()
+	defer s.conn.Close()
+	for {
+		select {
+		case <-s.ctx.Done():
+			code, reason := websocket.CloseNormalClosure, ""
+			if s.tooSlow {
+				code, reason = websocket.ClosePolicyViolation, "client too slow"
+			}
+			s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(subscriptionWriteTimeout))
+			return
+		case msg := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(subscriptionWriteTimeout))
+			if err := s.conn.WriteJSON(msg); err != nil {
+				s.cancel()
+				return
+			}
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(subscriptionWriteTimeout)); err != nil {
+				s.cancel()
+				return
+			}
+		}
+	}
+}
+
+// Subscribe upgrades the request to a WebSocket on which the client subscribes to key prefixes
+// of its namespace/app and receives a message for every change under them.
+func (h *Handler) Subscribe(c echo.Context) error {
+	kvPrefix, err := h.getKVPrefixedKey(c, "")
+	if err != nil {
+		return err
+	}
+	conn, err := subscriptionUpgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		return nil // The upgrader has already answered the request
+	}
+	conn.SetReadLimit(subscriptionMaxMessage)
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+	s := &subscriptionConn{
+		conn:   conn,
+		send:   make(chan SubscriptionMessage, subscriptionSendBuffer),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go s.writeLoop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	subscriptions := make(map[string]context.CancelFunc)
+	for {
+		var req SubscriptionRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			return nil // Client went away, or the connection was closed by writeLoop
+		}
+		if len(req.Prefix) > h.Config.MaxKeyLen {
+			s.enqueue(SubscriptionMessage{Type: "error", Prefix: req.Prefix, Error: fmt.Sprintf("Prefix too long (max %d characters)", h.Config.MaxKeyLen)})
+			continue
+		}
+
+		switch req.Action {
+		case subscribeAction:
+			if _, ok := subscriptions[req.Prefix]; ok {
+				s.enqueue(SubscriptionMessage{Type: "error", Prefix: req.Prefix, Error: "Already subscribed"})
+				continue
+			}
+			if len(subscriptions) >= maxSubscriptions {
+				s.enqueue(SubscriptionMessage{Type: "error", Prefix: req.Prefix, Error: fmt.Sprintf("Too many subscriptions (max %d)", maxSubscriptions)})
+				continue
+			}
+			subCtx, subCancel := context.WithCancel(ctx)
+			subscriptions[req.Prefix] = subCancel
+			// Watch before acknowledging so no change after "subscribed" is missed
+			watchChan := h.Store.Client().Watch(subCtx, kvPrefix+req.Prefix, clientv3.WithPrefix(), clientv3.WithPrevKV())
+			s.enqueue(SubscriptionMessage{Type: "subscribed", Prefix: req.Prefix})
+			wg.Add(1)
+			go func(prefix string) {
+				defer wg.Done()
+				h.forwardSubscription(subCtx, s, kvPrefix, prefix, watchChan)
+			}(req.Prefix)
+		case unsubscribeAction:
+			subCancel, ok := subscriptions[req.Prefix]
+			if !ok {
+				s.enqueue(SubscriptionMessage{Type: "error", Prefix: req.Prefix, Error: "Not subscribed"})
+				continue
+			}
+			subCancel()
+			delete(subscriptions, req.Prefix)
+			s.enqueue(SubscriptionMessage{Type: "unsubscribed", Prefix: req.Prefix})
+		default:
+			s.enqueue(SubscriptionMessage{Type: "error", Prefix: req.Prefix, Error: "Action must be subscribe or unsubscribe"})
+		}
+	}
+}
+
+// forwardSubscription sends the client a message for each change in watchChan, with keys
+// relative to kvPrefix, until the subscription is canceled.
+func (h *Handler) forwardSubscription(ctx context.Context, s *subscriptionConn, kvPrefix, prefix string, watchChan clientv3.WatchChan) {
+	for watchResp := range watchChan {
+		if err := watchResp.Err(); err != nil {
+			if ctx.Err() == nil {
+				s.enqueue(SubscriptionMessage{Type: "error", Prefix: prefix, Error: "Subscription ended: " + err.Error()})
+			}
+			return
+		}
+		for _, ev := range watchResp.Events {
+			msg := SubscriptionMessage{
+				Type:     "event",
+				Prefix:   prefix,
+				Key:      string(ev.Kv.Key)[len(kvPrefix):],
+				Revision: ev.Kv.ModRevision,
+			}
+			switch {
+			case ev.Type == mvccpb.DELETE:
+				msg.Event = EventDelete
+				if ev.PrevKv != nil && h.leaseGone(ctx, ev.PrevKv.Lease) {
+					msg.Event = EventExpire
+				}
+			case ev.IsCreate():
+				msg.Event = EventCreate
+			default:
+				msg.Event = EventUpdate
+			}
+			if ev.Type == mvccpb.PUT {
+				kvItem := h.Store.DecodeKVItem(string(ev.Kv.Key), ev.Kv.Value)
+				value := encodedValue(kvItem)
+				msg.Value = &value
+				msg.Encoding = kvItem.Encoding
+			}
+			s.enqueue(msg)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// ttlFilter keeps only listed keys whose remaining TTL is in a range.
+type ttlFilter struct {
+	noTTL          *bool  // true: only keys without TTL, false: only keys with TTL
+	expiringWithin *int64 // Only keys expiring within this many seconds
+	ttlGT          *int64 // Only keys with a TTL greater than this
+	ttlLT          *int64 // Only keys with a TTL less than this
+}
+
+// parseTTLFilter reads the ?no_ttl=, ?expiring_within=, ?ttl_gt= and ?ttl_lt= query parameters.
+// It returns nil if none is set.
+func parseTTLFilter(c echo.Context) (*ttlFilter, error) {
+	filter := &ttlFilter{}
+	set := false
+	if param := c.QueryParam("no_ttl"); param != "" {
+		noTTL, err := strconv.ParseBool(param)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "no_ttl must be true or false")
+		}
+		filter.noTTL = &noTTL
+		set = true
+	}
+	for name, target := range map[string]**int64{
+		"expiring_within": &filter.expiringWithin,
+		"ttl_gt":          &filter.ttlGT,
+		"ttl_lt":          &filter.ttlLT,
+	} {
+		param := c.QueryParam(name)
+		if param == "" {
+			continue
+		}
+		seconds, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || seconds < 0 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, name+" must be a number of seconds")
+		}
+		*target = &seconds
+		set = true
+	}
+	if !set {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// matches reports whether kv passes the filter. A nil filter matches everything.
+// Keys without TTL only match no_ttl=true, since the other filters need a TTL.
+func (f *ttlFilter) matches(kv *store.KVItem) bool {
+	if f == nil {
+		return true
+	}
+	hasTTL := kv.TTL != nil && *kv.TTL >= 0
+	if f.noTTL != nil && *f.noTTL == hasTTL {
+		return false
+	}
+	if f.expiringWithin == nil && f.ttlGT == nil && f.ttlLT == nil {
+		return true
+	}
+	if !hasTTL {
+		return false
+	}
+	ttl := *kv.TTL
+	if f.expiringWithin != nil && ttl > *f.expiringWithin {
+		return false
+	}
+	if f.ttlGT != nil && ttl <= *f.ttlGT {
+		return false
+	}
+	if f.ttlLT != nil && ttl >= *f.ttlLT {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"math/rand/v2"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// applyTTLJitter shortens the TTL of a write by a random share of up to TTL_JITTER_PERCENT,
+// so keys written in a burst with the same TTL don't all expire at the same moment.
+// The TTL is only ever reduced, never extended past what the client asked for. Writes
+// attached to an existing lease, writes with an expire_at and requests with ?jitter=false are
+// left unchanged.
+func (h *Handler) applyTTLJitter(c echo.Context, kv *KeyValue) error {
+	switch c.QueryParam("jitter") {
+	case "", "true":
+	case "false":
+		return nil
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "Jitter must be true or false")
+	}
+	if h.Config.TTLJitterPercent <= 0 || kv.LeaseID != 0 || kv.ExpireAt != 0 || kv.TTL <= 1 {
+		return nil
+	}
+	maxJitter := kv.TTL * int64(min(h.Config.TTLJitterPercent, 100)) / 100
+	if maxJitter >= kv.TTL {
+		maxJitter = kv.TTL - 1 // Keep at least one second
+	}
+	if maxJitter > 0 {
+		kv.TTL -= rand.Int64N(maxJitter + 1)
+	}
+	return nil
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"log"
-	"strings"
+	"math/rand/v2"
+	"strconv"
 	"time"
 
 	"github.com/mrofi/simple-golang-kv/src/store"
@@ -24,6 +26,7 @@ func (h *Handler) StartWatcher(ctx context.Context) {
 	lockKey := "/" + h.Config.BaseKeyPrefix + "/locks/watcher"
 
 	// Retry loop: keep trying to acquire the lock until successful or context is canceled
+	failures := 0
 	for {
 		select {
 		case <-ctx.Done():
@@ -31,12 +34,41 @@ func (h *Handler) StartWatcher(ctx context.Context) {
 		default:
 			// Try to acquire the lock
 			if h.tryAcquireLockAndWatch(ctx, lockKey) {
-				time.Sleep(2 * time.Second) // Wait a bit before retrying
+				failures = 0
 			} else {
-				time.Sleep(5 * time.Second)
+				failures++
 			}
 		}
+
+		// Wait a jittered delay so pods restarting together don't contend in lockstep
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watcherRetryDelay(h.Config.WatcherRetryBase(), h.Config.WatcherRetryMax(), failures)):
+		}
+	}
+}
+
+// watcherRetryDelay returns the delay before the next lock attempt after the given number of
+// consecutive failures. The delay doubles with each failure, capped at max, and is jittered
+// uniformly between half and all of that value.
+func watcherRetryDelay(base, max time.Duration, failures int) time.Duration {
+	delay := base
+	for i := 0; i < failures && delay > 0 && delay < max; i++ {
+		if delay > max/2 {
+			delay = max // Doubling would pass max, or overflow for a very large max
+			break
+		}
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
 	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int64N(int64(delay-half)+1))
 }
 
 // tryAcquireLockAndWatch attempts to acquire the lock and start watching.
@@ -44,7 +76,7 @@ func (h *Handler) StartWatcher(ctx context.Context) {
 func (h *Handler) tryAcquireLockAndWatch(ctx context.Context, lockKey string) bool {
 	// Create a separate session for the watcher lock with a context that won't be canceled
 	sessionCtx := context.Background()
-	watcherSession, err := concurrency.NewSession(h.Store.Client(), concurrency.WithTTL(10), concurrency.WithContext(sessionCtx))
+	watcherSession, err := concurrency.NewSession(h.Store.Client(), concurrency.WithTTL(h.Config.WatcherSessionTTLSeconds), concurrency.WithContext(sessionCtx))
 	if err != nil {
 		log.Printf("Failed to create watcher session: %v", err)
 		return false
@@ -55,7 +87,7 @@ func (h *Handler) tryAcquireLockAndWatch(ctx context.Context, lockKey string) bo
 	mu := concurrency.NewMutex(watcherSession, lockKey)
 
 	// Try to acquire the lock with a timeout
-	lockCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	lockCtx, cancel := context.WithTimeout(ctx, h.Config.WatcherLockTimeout())
 	defer cancel()
 
 	if err := mu.Lock(lockCtx); err != nil {
@@ -72,34 +104,145 @@ func (h *Handler) tryAcquireLockAndWatch(ctx context.Context, lockKey string) bo
 	}()
 
 	log.Println("Watcher lock acquired, starting to watch for changes...")
+	h.watcher.acquired(int64(watcherSession.Lease()))
+	defer h.watcher.released()
 
 	// Watch all KV changes under the base prefix
 	kvPrefix := "/" + h.Config.BaseKeyPrefix + "/kv/"
 
-	// Initialize previous values by loading all existing keys
-	previousValues := h.initializePreviousValues(kvPrefix)
+	// Initialize previous values by loading all existing keys, as of where the last watcher
+	// stopped if it saved its revision
+	previousValues, startRev := h.initializePreviousValues(ctx, kvPrefix)
+
+	// Deliver the persistent queue for as long as this pod holds the lock, and let deliveries
+	// in flight finish before giving it up
+	if h.Config.WebhookPersistentQueue {
+		queueCtx, stopQueue := context.WithCancel(ctx)
+		queueDone := make(chan struct{})
+		defer func() {
+			stopQueue()
+			<-queueDone
+		}()
+		go func() {
+			defer close(queueDone)
+			h.runDeliveryQueue(queueCtx)
+		}()
+	}
 
-	watchChan := h.Store.Client().Watch(ctx, kvPrefix, clientv3.WithPrefix())
+	webhookWatchChan, pauseWatchChan := h.watchWebhookIndex(ctx)
+	defer h.webhookIndex.reset()
 
-	return h.watchForChanges(ctx, mu, unlockCtx, &unlocked, watcherSession, watchChan, previousValues)
+	return h.watchForChanges(ctx, mu, unlockCtx, &unlocked, watcherSession, kvPrefix, startRev, webhookWatchChan, pauseWatchChan, previousValues)
 }
 
-// initializePreviousValues loads all existing KV pairs to track create vs update.
-func (h *Handler) initializePreviousValues(kvPrefix string) map[string]string {
-	previousValues := make(map[string]string)
-	existingKVs, err := h.Store.All(kvPrefix)
-	if err == nil {
-		for _, kv := range existingKVs {
-			// Skip webhook keys and lock keys
-			if !strings.Contains(kv.Key, webhookPathSegment) && !strings.Contains(kv.Key, "/locks/") {
-				previousValues[kv.Key] = kv.Value
-			}
+// watchKVs watches the KV prefix from startRev, or from now if startRev is 0.
+func (h *Handler) watchKVs(ctx context.Context, kvPrefix string, startRev int64) clientv3.WatchChan {
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if startRev > 0 {
+		opts = append(opts, clientv3.WithRev(startRev))
+	}
+	return h.Store.Client().Watch(ctx, kvPrefix, opts...)
+}
+
+// watcherRevisionKey returns the key holding the last revision processed by the watcher.
+func (h *Handler) watcherRevisionKey() string {
+	return "/" + h.Config.BaseKeyPrefix + "/watcher/revision"
+}
+
+// loadWatcherRevision returns the last revision saved by a watcher, or 0 if there is none.
+func (h *Handler) loadWatcherRevision(ctx context.Context) int64 {
+	kvItem, found, err := h.Store.Get(ctx, h.watcherRevisionKey())
+	if err != nil || !found {
+		return 0
+	}
+	rev, _ := strconv.ParseInt(kvItem.Value, 10, 64)
+	return rev
+}
+
+// saveWatcherRevision saves the last revision processed by the watcher so that the next
+// lock holder can resume from it.
+func (h *Handler) saveWatcherRevision(ctx context.Context, rev int64) {
+	if err := h.Store.SetMany(ctx, []store.KVItem{{Key: h.watcherRevisionKey(), Value: strconv.FormatInt(rev, 10)}}); err != nil {
+		log.Printf("Failed to save watcher revision: %v", err)
+	}
+}
+
+// watchWebhookIndex loads the webhooks of every namespace/app and the paused namespaces into
+// the index and returns the watches that keep them current. It returns nil watches, leaving
+// the index unused, if they cannot be loaded.
+func (h *Handler) watchWebhookIndex(ctx context.Context) (webhooks, pauses clientv3.WatchChan) {
+	webhookPrefix := "/" + h.Config.BaseKeyPrefix + webhookPathSegment
+	items, rev, err := h.Store.AllAtRevision(ctx, webhookPrefix, 0)
+	if err != nil {
+		log.Printf("Failed to load webhook index: %v", err)
+		return nil, nil
+	}
+	pausePrefix := h.getWebhookPausePrefix()
+	pauseItems, _, err := h.Store.AllAtRevision(ctx, pausePrefix, rev)
+	if err != nil {
+		log.Printf("Failed to load webhook index: %v", err)
+		return nil, nil
+	}
+	h.webhookIndex.load(webhookPrefix, items, pausePrefix, pauseItems)
+	// Watch from right after the load so no change is missed in between
+	webhooks = h.Store.Client().Watch(ctx, webhookPrefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+	pauses = h.Store.Client().Watch(ctx, pausePrefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+	return webhooks, pauses
+}
+
+// initializePreviousValues loads all existing KV pairs to track create vs update, and the
+// lease of each key to tell expirations from deletes. It returns the revision to watch from.
+// If a previous watcher saved its last revision, the keys are loaded as of that revision so
+// that changes made while no watcher was running are replayed. If that revision has been
+// compacted, changes since then are lost and the current keys are loaded instead.
+func (h *Handler) initializePreviousValues(ctx context.Context, kvPrefix string) (map[string]*store.KVItem, int64) {
+	if lastRev := h.loadWatcherRevision(ctx); lastRev > 0 {
+		existingKVs, _, err := h.Store.AllAtRevision(ctx, kvPrefix, lastRev)
+		if err == nil {
+			previousValues := buildPreviousValues(existingKVs)
+			log.Printf("Resuming watcher from revision %d with %d keys", lastRev, len(previousValues))
+			return previousValues, lastRev + 1
+		}
+		if errors.Is(err, store.ErrCompacted) {
+			log.Printf("Watcher revision %d has been compacted, resyncing from current keys", lastRev)
 		}
-		log.Printf("Initialized watcher with %d existing keys", len(previousValues))
+	}
+	return h.resyncPreviousValues(ctx, kvPrefix)
+}
+
+// resyncPreviousValues loads the current KV pairs and returns them with the revision right
+// after them. If they cannot be loaded, it returns no keys and 0 to watch from now.
+func (h *Handler) resyncPreviousValues(ctx context.Context, kvPrefix string) (map[string]*store.KVItem, int64) {
+	existingKVs, rev, err := h.Store.AllAtRevision(ctx, kvPrefix, 0)
+	if err != nil {
+		log.Printf("Failed to load existing keys for watcher: %v", err)
+		return make(map[string]*store.KVItem), 0
+	}
+	previousValues := buildPreviousValues(existingKVs)
+	log.Printf("Initialized watcher with %d existing keys", len(previousValues))
+	return previousValues, rev + 1
+}
+
+// buildPreviousValues indexes KV pairs by key. Webhooks, locks and other internal keys live
+// outside the watched KV prefix, so every key is a user key, whatever its segments are named.
+func buildPreviousValues(kvs []*store.KVItem) map[string]*store.KVItem {
+	previousValues := make(map[string]*store.KVItem, len(kvs))
+	for _, kv := range kvs {
+		previousValues[kv.Key] = kv
 	}
 	return previousValues
 }
 
+// leaseGone reports whether a key's lease no longer exists, meaning a delete of the key was
+// caused by the lease expiring or being revoked rather than by an explicit delete.
+func (h *Handler) leaseGone(ctx context.Context, leaseID int64) bool {
+	if leaseID == 0 {
+		return false
+	}
+	resp, err := h.Store.Client().TimeToLive(ctx, clientv3.LeaseID(leaseID))
+	return err == nil && resp.TTL < 0
+}
+
 // unlockMutex unlocks the mutex and logs any errors.
 func (h *Handler) unlockMutex(mu *concurrency.Mutex, unlockCtx context.Context) {
 	if err := mu.Unlock(unlockCtx); err != nil {
@@ -107,10 +250,29 @@ func (h *Handler) unlockMutex(mu *concurrency.Mutex, unlockCtx context.Context)
 	}
 }
 
-// watchForChanges watches for KV changes and triggers webhooks.
-func (h *Handler) watchForChanges(ctx context.Context, mu *concurrency.Mutex, unlockCtx context.Context, unlocked *bool, watcherSession *concurrency.Session, watchChan clientv3.WatchChan, previousValues map[string]string) bool {
+// watchForChanges watches for KV changes from startRev and triggers webhooks. The last
+// revision processed is saved every WATCHER_CHECKPOINT_SECONDS and when the watch stops.
+func (h *Handler) watchForChanges(ctx context.Context, mu *concurrency.Mutex, unlockCtx context.Context, unlocked *bool, watcherSession *concurrency.Session, kvPrefix string, startRev int64, webhookWatchChan, pauseWatchChan clientv3.WatchChan, previousValues map[string]*store.KVItem) bool {
+	watchChan := h.watchKVs(ctx, kvPrefix, startRev)
+
+	lastRev, savedRev := startRev-1, startRev-1
+	h.watcher.observed(lastRev)
+	checkpoint := time.NewTicker(h.Config.WatcherCheckpoint())
+	defer checkpoint.Stop()
+	defer func() {
+		if lastRev > savedRev {
+			// ctx is usually canceled by now, the final checkpoint must still be written
+			h.saveWatcherRevision(context.WithoutCancel(ctx), lastRev)
+		}
+	}()
+
 	for {
 		select {
+		case <-checkpoint.C:
+			if lastRev > savedRev {
+				h.saveWatcherRevision(ctx, lastRev)
+				savedRev = lastRev
+			}
 		case <-ctx.Done():
 			log.Println("Watcher context canceled, stopping...")
 			if !*unlocked {
@@ -130,46 +292,72 @@ func (h *Handler) watchForChanges(ctx context.Context, mu *concurrency.Mutex, un
 				}
 				return true
 			}
+			if watchResp.CompactRevision != 0 {
+				// Events between startRev and the compaction are gone, start over from now
+				log.Printf("Watch revision %d has been compacted, resyncing from current keys", startRev)
+				previousValues, startRev = h.resyncPreviousValues(ctx, kvPrefix)
+				watchChan = h.watchKVs(ctx, kvPrefix, startRev)
+				lastRev = max(lastRev, startRev-1)
+				h.watcher.observed(lastRev)
+				continue
+			}
 			h.processWatchEvents(ctx, watchResp.Events, previousValues)
+			if len(watchResp.Events) > 0 {
+				lastRev = watchResp.Events[len(watchResp.Events)-1].Kv.ModRevision
+				h.watcher.observed(lastRev)
+			}
+		case webhookResp, ok := <-webhookWatchChan:
+			if !ok || webhookResp.Err() != nil {
+				// Fall back to looking up webhooks for every change
+				log.Println("Webhook index watch closed, disabling index...")
+				h.webhookIndex.reset()
+				webhookWatchChan = nil
+				continue
+			}
+			h.webhookIndex.apply(h.Store, "/"+h.Config.BaseKeyPrefix+webhookPathSegment, webhookResp.Events)
+		case pauseResp, ok := <-pauseWatchChan:
+			if !ok || pauseResp.Err() != nil {
+				log.Println("Webhook pause watch closed, disabling index...")
+				h.webhookIndex.reset()
+				pauseWatchChan = nil
+				continue
+			}
+			h.webhookIndex.applyPauses(h.getWebhookPausePrefix(), pauseResp.Events)
 		}
 	}
 }
 
 // processWatchEvents processes watch events and triggers webhooks.
-func (h *Handler) processWatchEvents(ctx context.Context, events []*clientv3.Event, previousValues map[string]string) {
-	for _, event := range events {
+func (h *Handler) processWatchEvents(ctx context.Context, events []*clientv3.Event, previousValues map[string]*store.KVItem) {
+	requestIDs := h.Store.RequestIDs(ctx, events)
+	for i, event := range events {
 		key := string(event.Kv.Key)
-
-		// Skip webhook keys and lock keys
-		if strings.Contains(key, webhookPathSegment) || strings.Contains(key, "/locks/") {
-			continue
-		}
-
-		eventType, kvItem := h.processWatchEvent(ctx, event, key, previousValues)
+		eventType, kvItem, oldItem := h.processWatchEvent(ctx, event, key, requestIDs[i], previousValues)
 		if eventType != "" {
-			h.triggerWebhooksForKey(key, eventType, kvItem)
+			h.triggerWebhooksForKey(ctx, key, eventType, kvItem, oldItem)
 		}
 	}
 }
 
-// processWatchEvent processes a watch event and returns the event type and KV item.
-func (h *Handler) processWatchEvent(ctx context.Context, event *clientv3.Event, key string, previousValues map[string]string) (WebhookEvent, *store.KVItem) {
+// processWatchEvent processes a watch event, made by the request requestID if known, and returns
+// the event type, the KV item and the key's previous item, which is nil for creates.
+func (h *Handler) processWatchEvent(ctx context.Context, event *clientv3.Event, key, requestID string, previousValues map[string]*store.KVItem) (WebhookEvent, *store.KVItem, *store.KVItem) {
 	switch event.Type {
 	case mvccpb.PUT:
 		// Determine if this is create or update
 		var eventType WebhookEvent
-		if _, exists := previousValues[key]; exists {
+		prev, exists := previousValues[key]
+		if exists {
 			eventType = EventUpdate
 		} else {
 			eventType = EventCreate
 		}
-		// Store current value
-		previousValues[key] = string(event.Kv.Value)
 		// Create KVItem
-		kvItem := &store.KVItem{
-			Key:   key,
-			Value: string(event.Kv.Value),
-		}
+		kvItem := h.Store.DecodeKVItem(key, event.Kv.Value)
+		kvItem.LeaseID = event.Kv.Lease
+		kvItem.RequestID = requestID
+		// Store current value
+		previousValues[key] = kvItem
 		// Get TTL if lease exists
 		if event.Kv.Lease > 0 {
 			ttlResp, err := h.Store.Client().TimeToLive(ctx, clientv3.LeaseID(event.Kv.Lease))
@@ -178,21 +366,30 @@ func (h *Handler) processWatchEvent(ctx context.Context, event *clientv3.Event,
 				kvItem.TTL = &ttl
 			}
 		}
-		return eventType, kvItem
+		return eventType, kvItem, prev
 
 	case mvccpb.DELETE:
 		// Get previous value before deletion
-		var kvItem *store.KVItem
-		if prevValue, exists := previousValues[key]; exists {
-			kvItem = &store.KVItem{
-				Key:   key,
-				Value: prevValue,
-			}
-			delete(previousValues, key)
+		prev, exists := previousValues[key]
+		if !exists {
+			return EventDelete, nil, nil
+		}
+		delete(previousValues, key)
+		kvItem := &store.KVItem{
+			Key:         key,
+			Value:       prev.Value,
+			LeaseID:     prev.LeaseID,
+			Checksum:    prev.Checksum,
+			ContentType: prev.ContentType,
+			Tags:        prev.Tags,
+			Encoding:    prev.Encoding,
+		}
+		if h.leaseGone(ctx, prev.LeaseID) {
+			return EventExpire, kvItem, prev
 		}
-		return EventDelete, kvItem
+		return EventDelete, kvItem, prev
 
 	default:
-		return "", nil
+		return "", nil, nil
 	}
 }
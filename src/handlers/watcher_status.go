@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// WatcherStatus is the state of the watcher on this pod.
+type WatcherStatus struct {
+	HoldsLock    bool  `json:"holds_lock"`
+	LeaseID      int64 `json:"lease_id,omitempty"`      // Lease of the watcher session holding the lock
+	LastRevision int64 `json:"last_revision,omitempty"` // Last etcd revision the watcher processed
+	AcquiredAt   int64 `json:"acquired_at,omitempty"`   // Unix time the lock was acquired
+}
+
+// watcherState tracks the watcher of this pod, updated by the watcher and read by WatcherStatus.
+type watcherState struct {
+	mu     sync.Mutex
+	status WatcherStatus
+}
+
+// acquired records that the watcher took the lock with the session of leaseID.
+func (s *watcherState) acquired(leaseID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = WatcherStatus{HoldsLock: true, LeaseID: leaseID, AcquiredAt: time.Now().Unix()}
+}
+
+// observed records the last revision the watcher processed, if known.
+func (s *watcherState) observed(rev int64) {
+	if rev <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LastRevision = rev
+}
+
+// released records that the watcher gave up the lock. The last revision is kept.
+func (s *watcherState) released() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = WatcherStatus{LastRevision: s.status.LastRevision}
+}
+
+func (s *watcherState) get() WatcherStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// GetWatcherStatus returns whether this pod holds the watcher lock, and if so since when, with
+// which session, and how far it has got.
+func (h *Handler) GetWatcherStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.watcher.get())
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mrofi/simple-golang-kv/src/config"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// userKeys are keys with several slashes, including segments named like internal prefixes.
+var userKeys = []string{
+	"config/db/host",
+	"a/b/c/d/e",
+	"team/webhooks/slack",
+	"jobs/locks/nightly",
+	"trailing/slash/",
+}
+
+func TestBuildPreviousValuesKeepsKeysWithSlashes(t *testing.T) {
+	h := &Handler{Config: &config.Config{BaseKeyPrefix: "kvstore"}}
+	var kvs []*store.KVItem
+	for _, key := range userKeys {
+		kvs = append(kvs, &store.KVItem{Key: h.getKVPrefix("ns", "app") + key, Value: key})
+	}
+
+	previousValues := buildPreviousValues(kvs)
+	if len(previousValues) != len(userKeys) {
+		t.Fatalf("got %d previous values, want %d", len(previousValues), len(userKeys))
+	}
+	for _, key := range userKeys {
+		prefixedKey := h.getKVPrefix("ns", "app") + key
+		if previousValues[prefixedKey] == nil {
+			t.Errorf("previous value of %q missing", prefixedKey)
+		}
+		namespace, appName, got := h.slicePrefixedKey(prefixedKey)
+		if namespace != "ns" || appName != "app" || got != key {
+			t.Errorf("slicePrefixedKey(%q) = %q, %q, %q, want ns, app, %q", prefixedKey, namespace, appName, got, key)
+		}
+	}
+}
+
+func TestWatcherRetryDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		base, max time.Duration
+		failures  int
+		want      time.Duration // Delay before jitter, the result is within [want/2, want]
+	}{
+		{"first attempt", 2 * time.Second, 30 * time.Second, 0, 2 * time.Second},
+		{"doubles", 2 * time.Second, 30 * time.Second, 1, 4 * time.Second},
+		{"doubles again", 2 * time.Second, 30 * time.Second, 3, 16 * time.Second},
+		{"capped", 2 * time.Second, 30 * time.Second, 4, 30 * time.Second},
+		{"many failures", 2 * time.Second, 30 * time.Second, 1000, 30 * time.Second},
+		{"huge failure count", 2 * time.Second, 30 * time.Second, math.MaxInt, 30 * time.Second},
+		{"max without overflow", time.Second, math.MaxInt64, 100, math.MaxInt64},
+		{"base above max", time.Minute, 30 * time.Second, 0, 30 * time.Second},
+		{"zero base", 0, 30 * time.Second, math.MaxInt, 0},
+		{"one nanosecond", time.Nanosecond, time.Nanosecond, 5, time.Nanosecond},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			got := watcherRetryDelay(tt.base, tt.max, tt.failures)
+			if got < tt.want/2 || got > tt.want {
+				t.Fatalf("%s: watcherRetryDelay(%v, %v, %d) = %v, want within [%v, %v]",
+					tt.name, tt.base, tt.max, tt.failures, got, tt.want/2, tt.want)
+			}
+		}
+	}
+}
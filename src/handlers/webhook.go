@@ -2,7 +2,11 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"slices"
@@ -11,7 +15,15 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/middleware"
+	"github.com/mrofi/simple-golang-kv/src/redact"
 	"github.com/mrofi/simple-golang-kv/src/store"
+	"github.com/mrofi/simple-golang-kv/src/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // WebhookEvent represents the type of event that triggers a webhook
@@ -21,51 +33,114 @@ const (
 	EventCreate WebhookEvent = "create"
 	EventUpdate WebhookEvent = "update"
 	EventDelete WebhookEvent = "delete"
+	EventExpire WebhookEvent = "expire" // Key deleted because its lease expired or was revoked
 )
 
 const (
 	errWebhookIDEmpty  = "Webhook ID must not be empty"
 	errWebhookNotFound = "Webhook not found"
+
+	errReturnResponseNotBlocking = "return_response requires blocking"
+	errInvalidEvent              = "Event must be one of: create, update, delete, expire"
+	errInvalidWebhookTimeout     = "timeout_seconds must be between 1 and 60"
 )
 
+// maxWebhookTimeoutSeconds is the longest request timeout a webhook can set.
+const maxWebhookTimeoutSeconds = 60
+
+// webhookDiscardMaxBytes caps how much of a response body is read and discarded after a
+// delivery, so a receiver streaming an endless body can't hold the delivery open.
+const webhookDiscardMaxBytes = 64 * 1024
+
+// valid reports whether e is an event webhooks can be registered for.
+func (e WebhookEvent) valid() bool {
+	return e == EventCreate || e == EventUpdate || e == EventDelete || e == EventExpire
+}
+
 var validMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS", "HEAD"}
 var defaultMethod = "POST"
 
 // WebhookRegistration represents a webhook registration request
 type WebhookRegistration struct {
-	Key          string                 `json:"key"`              // Key pattern (supports * suffix for prefix matching)
-	Event        string                 `json:"event"`            // create, update, or delete
-	Endpoint     string                 `json:"endpoint"`         // URL where webhook should be sent
-	Method       string                 `json:"method,omitempty"` // HTTP method to use
-	Headers      map[string]string      `json:"headers,omitempty"`
-	Payload      map[string]interface{} `json:"payload,omitempty"`
-	AddEventData bool                   `json:"add_event_data,omitempty"` // Add event data to the payload
+	Key            string                 `json:"key"`                    // Key pattern, interpreted according to match_type
+	MatchType      string                 `json:"match_type,omitempty"`   // exact, prefix, glob or regex, defaults to prefix
+	ValueFilter    string                 `json:"value_filter,omitempty"` // path=value condition on the JSON value, see parseValueFilter
+	Event          string                 `json:"event"`                  // create, update, delete, or expire
+	Endpoint       string                 `json:"endpoint"`               // URL where webhook should be sent
+	Method         string                 `json:"method,omitempty"`       // HTTP method to use
+	Headers        map[string]string      `json:"headers,omitempty"`
+	Payload        map[string]interface{} `json:"payload,omitempty"`
+	AddEventData   bool                   `json:"add_event_data,omitempty"`  // Add event data to the payload
+	Blocking       bool                   `json:"blocking,omitempty"`        // Deliver synchronously within the write request
+	ReturnResponse bool                   `json:"return_response,omitempty"` // Return the receiver's response in the write response (blocking only)
+	TLS            *WebhookTLS            `json:"tls,omitempty"`             // Client certificate and CA for mutual TLS
+	Enabled        *bool                  `json:"enabled,omitempty"`         // Deliver the webhook, defaults to true
+	Retry          *WebhookRetry          `json:"retry,omitempty"`           // Overrides the delivery retry settings
+	Secret         string                 `json:"secret,omitempty"`          // Key of the HMAC signature sent with each delivery
+	TimeoutSeconds int                    `json:"timeout_seconds,omitempty"` // Request timeout, defaults to WEBHOOK_TIMEOUT_SECONDS
 }
 
 // Webhook represents a stored webhook
 type Webhook struct {
-	ID           string                 `json:"id"`
-	Namespace    string                 `json:"namespace"` // Namespace
-	AppName      string                 `json:"appName"`   // App name
-	Key          string                 `json:"key"`       // Key pattern
-	Event        string                 `json:"event"`     // Event type
-	Endpoint     string                 `json:"endpoint"`  // Webhook URL
-	Method       string                 `json:"method"`    // HTTP method to use
-	Headers      map[string]string      `json:"headers,omitempty"`
-	Payload      map[string]interface{} `json:"payload,omitempty"`
-	AddEventData bool                   `json:"add_event_data"` // Add event data to the payload
-	CreatedAt    int64                  `json:"created_at"`
+	ID             string                 `json:"id"`
+	Namespace      string                 `json:"namespace"` // Namespace
+	AppName        string                 `json:"appName"`   // App name
+	Key            string                 `json:"key"`       // Key pattern
+	MatchType      string                 `json:"match_type,omitempty"`
+	ValueFilter    string                 `json:"value_filter,omitempty"`
+	Event          string                 `json:"event"`    // Event type
+	Endpoint       string                 `json:"endpoint"` // Webhook URL
+	Method         string                 `json:"method"`   // HTTP method to use
+	Headers        map[string]string      `json:"headers,omitempty"`
+	Payload        map[string]interface{} `json:"payload,omitempty"`
+	AddEventData   bool                   `json:"add_event_data"`   // Add event data to the payload
+	Blocking       bool                   `json:"blocking"`         // Deliver synchronously within the write request
+	ReturnResponse bool                   `json:"return_response"`  // Return the receiver's response in the write response
+	TLS            *WebhookTLS            `json:"tls,omitempty"`    // Client certificate and CA for mutual TLS
+	Enabled        *bool                  `json:"enabled"`          // Deliver the webhook, nil for webhooks stored before it existed
+	Retry          *WebhookRetry          `json:"retry,omitempty"`  // Overrides the delivery retry settings
+	Secret         string                 `json:"secret,omitempty"` // Key of the HMAC signature, never returned to clients
+	TimeoutSeconds int                    `json:"timeout_seconds,omitempty"`
+	CreatedAt      int64                  `json:"created_at"`
+}
+
+// isEnabled reports whether the webhook should be delivered. Webhooks are enabled unless paused.
+func (w Webhook) isEnabled() bool {
+	return w.Enabled == nil || *w.Enabled
+}
+
+// public returns a copy of the webhook that is safe to return to clients, without the TLS
+// private key and the signing secret.
+func (w Webhook) public() Webhook {
+	w.Secret = ""
+	if w.TLS != nil {
+		tlsCopy := *w.TLS
+		tlsCopy.ClientKey = ""
+		w.TLS = &tlsCopy
+	}
+	enabled := w.isEnabled()
+	w.Enabled = &enabled
+	return w
 }
 
 // WebhookUpdate represents an update request for a webhook
 type WebhookUpdate struct {
-	Key          string                 `json:"key,omitempty"`
-	Event        string                 `json:"event,omitempty"`
-	Endpoint     string                 `json:"endpoint,omitempty"`
-	Method       string                 `json:"method,omitempty"`
-	Headers      map[string]string      `json:"headers,omitempty"`
-	Payload      map[string]interface{} `json:"payload,omitempty"`
-	AddEventData bool                   `json:"add_event_data,omitempty"`
+	Key            string                 `json:"key,omitempty"`
+	MatchType      string                 `json:"match_type,omitempty"`
+	ValueFilter    *string                `json:"value_filter,omitempty"` // Replaces the value filter, "" removes it
+	Event          string                 `json:"event,omitempty"`
+	Endpoint       string                 `json:"endpoint,omitempty"`
+	Method         string                 `json:"method,omitempty"`
+	Headers        map[string]string      `json:"headers,omitempty"`
+	Payload        map[string]interface{} `json:"payload,omitempty"`
+	AddEventData   bool                   `json:"add_event_data,omitempty"`
+	Blocking       *bool                  `json:"blocking,omitempty"`
+	ReturnResponse *bool                  `json:"return_response,omitempty"`
+	TLS            *WebhookTLS            `json:"tls,omitempty"` // Replaces the TLS settings, {} removes them
+	Enabled        *bool                  `json:"enabled,omitempty"`
+	Retry          *WebhookRetry          `json:"retry,omitempty"`           // Replaces the retry settings, {} removes them
+	Secret         *string                `json:"secret,omitempty"`          // Replaces the signing secret, "" removes it
+	TimeoutSeconds *int                   `json:"timeout_seconds,omitempty"` // Replaces the timeout, 0 goes back to the default
 }
 
 // getWebhookPrefix returns the prefix for webhook storage
@@ -82,26 +157,62 @@ func (h *Handler) getWebhookKey(c echo.Context, webhookID string) string {
 
 // RegisterWebhook handles webhook registration
 func (h *Handler) RegisterWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
 	var reg WebhookRegistration
 	if err := c.Bind(&reg); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
 	}
 
+	webhook, msg := h.newWebhook(c, reg)
+	if msg != "" {
+		return apierror.JSON(c, http.StatusBadRequest, msg)
+	}
+
+	// Store webhook
+	webhookKey := h.getWebhookKey(c, webhook.ID)
+	webhookJSON, err := json.Marshal(webhook)
+	if err != nil {
+		return apierror.JSON(c, http.StatusInternalServerError, "Failed to serialize webhook")
+	}
+
+	if err := h.Store.Set(ctx, webhookKey, string(webhookJSON), 0); err != nil {
+		return storeError(c, err, "Failed to register webhook")
+	}
+
+	// Return webhook with ID
+	return c.JSON(http.StatusCreated, map[string]string{"id": webhook.ID})
+}
+
+// newWebhook validates a registration and builds the webhook to store, with a new ID.
+// It returns an error message for a 400 response if the registration is invalid.
+func (h *Handler) newWebhook(c echo.Context, reg WebhookRegistration) (Webhook, string) {
 	// Validate required fields
 	if reg.Key == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Key must not be empty"})
+		return Webhook{}, "Key must not be empty"
 	}
 	if reg.Event == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Event must not be empty"})
+		return Webhook{}, "Event must not be empty"
 	}
 	if reg.Endpoint == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Endpoint must not be empty"})
+		return Webhook{}, "Endpoint must not be empty"
+	}
+	if msg := h.validateWebhookEndpoint(c.Request().Context(), reg.Endpoint); msg != "" {
+		return Webhook{}, msg
+	}
+	matchType, msg := h.validateKeyPattern(reg.MatchType, reg.Key)
+	if msg != "" {
+		return Webhook{}, msg
+	}
+	if reg.ValueFilter != "" {
+		if _, err := h.parsedValueFilter(reg.ValueFilter); err != nil {
+			return Webhook{}, "Invalid value_filter: " + err.Error()
+		}
 	}
 
 	// Validate method
 	if reg.Method != "" {
 		if !slices.Contains(validMethods, strings.ToUpper(reg.Method)) {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid method"})
+			return Webhook{}, "Invalid method"
 		}
 	} else {
 		reg.Method = defaultMethod
@@ -109,74 +220,104 @@ func (h *Handler) RegisterWebhook(c echo.Context) error {
 
 	// Validate event type
 	event := WebhookEvent(strings.ToLower(reg.Event))
-	if event != EventCreate && event != EventUpdate && event != EventDelete {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Event must be one of: create, update, delete"})
+	if !event.valid() {
+		return Webhook{}, errInvalidEvent
 	}
-
-	// Generate unique webhook ID
-	webhookID := uuid.New().String()
-
-	// Create webhook object
-	webhook := Webhook{
-		ID:           webhookID,
-		Namespace:    h.getNamespace(c),
-		AppName:      h.getAppName(c),
-		Key:          reg.Key,
-		Event:        string(event),
-		Endpoint:     reg.Endpoint,
-		Method:       reg.Method,
-		Headers:      reg.Headers,
-		Payload:      reg.Payload,
-		AddEventData: reg.AddEventData,
-		CreatedAt:    time.Now().Unix(),
+	if reg.ReturnResponse && !reg.Blocking {
+		return Webhook{}, errReturnResponseNotBlocking
 	}
-
-	// Store webhook
-	webhookKey := h.getWebhookKey(c, webhookID)
-	webhookJSON, err := json.Marshal(webhook)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to serialize webhook"})
+	if reg.TimeoutSeconds < 0 || reg.TimeoutSeconds > maxWebhookTimeoutSeconds {
+		return Webhook{}, errInvalidWebhookTimeout
 	}
-
-	if err := h.Store.Set(webhookKey, string(webhookJSON), 0); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to register webhook"})
+	if msg := reg.Retry.validate(); msg != "" {
+		return Webhook{}, msg
+	}
+	if reg.Retry != nil && *reg.Retry == (WebhookRetry{}) {
+		reg.Retry = nil
+	}
+	if reg.TLS != nil && *reg.TLS == (WebhookTLS{}) {
+		reg.TLS = nil
+	}
+	// Load the certificates now, so invalid ones are rejected and later deliveries reuse them
+	if _, err := h.getWebhookTransport(reg.TLS); err != nil {
+		return Webhook{}, "Invalid TLS settings: " + err.Error()
 	}
 
-	// Return webhook with ID
-	return c.JSON(http.StatusCreated, map[string]string{"id": webhookID})
+	// Generate unique webhook ID
+	webhookID := uuid.New().String()
+
+	return Webhook{
+		ID:             webhookID,
+		Namespace:      h.getNamespace(c),
+		AppName:        h.getAppName(c),
+		Key:            reg.Key,
+		MatchType:      matchType,
+		ValueFilter:    reg.ValueFilter,
+		Event:          string(event),
+		Endpoint:       reg.Endpoint,
+		Method:         reg.Method,
+		Headers:        reg.Headers,
+		Payload:        reg.Payload,
+		AddEventData:   reg.AddEventData,
+		Blocking:       reg.Blocking,
+		ReturnResponse: reg.ReturnResponse,
+		TLS:            reg.TLS,
+		Enabled:        reg.Enabled,
+		Retry:          reg.Retry,
+		Secret:         reg.Secret,
+		TimeoutSeconds: reg.TimeoutSeconds,
+		CreatedAt:      time.Now().Unix(),
+	}, ""
 }
 
 // GetWebhook retrieves a webhook by ID
 func (h *Handler) GetWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
 	webhookID := c.Param("id")
 	if webhookID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": errWebhookIDEmpty})
+		return apierror.JSON(c, http.StatusBadRequest, errWebhookIDEmpty)
 	}
 
-	// if webhookID end with * call GetWebhooks
-	if strings.HasSuffix(webhookID, "*") {
+	// Legacy behavior: an ID ending with * is a pattern query
+	if h.Config.WebhookPatternByID && strings.HasSuffix(webhookID, "*") {
 		return h.GetWebhooksForPattern(c, webhookID)
 	}
 
 	webhookKey := h.getWebhookKey(c, webhookID)
-	kvItem, found, err := h.Store.Get(webhookKey)
+	kvItem, found, err := h.Store.Get(ctx, webhookKey)
 	if err != nil || !found {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": errWebhookNotFound})
+		return apierror.JSON(c, http.StatusNotFound, errWebhookNotFound)
 	}
 
 	var webhook Webhook
 	if err := json.Unmarshal([]byte(kvItem.Value), &webhook); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to parse webhook"})
+		return apierror.JSON(c, http.StatusInternalServerError, "Failed to parse webhook")
 	}
 
-	return c.JSON(http.StatusOK, webhook)
+	return c.JSON(http.StatusOK, webhook.public())
+}
+
+// ListWebhooks retrieves all webhooks of the namespace/app, optionally only those whose key
+// matches the ?key= pattern and those registered for the ?event= event
+func (h *Handler) ListWebhooks(c echo.Context) error {
+	event := WebhookEvent(strings.ToLower(c.QueryParam("event")))
+	if event != "" && !event.valid() {
+		return apierror.JSON(c, http.StatusBadRequest, errInvalidEvent)
+	}
+	return h.listWebhooks(c, c.QueryParam("key"), event)
 }
 
 // GetWebhooksForPattern retrieves all webhooks for a pattern
 func (h *Handler) GetWebhooksForPattern(c echo.Context, pattern string) error {
-	webhooks, err := h.Store.All(h.getWebhookPrefix(c))
+	return h.listWebhooks(c, pattern, "")
+}
+
+// listWebhooks retrieves the webhooks matching pattern and event, where empty matches all
+func (h *Handler) listWebhooks(c echo.Context, pattern string, event WebhookEvent) error {
+	ctx := c.Request().Context()
+	webhooks, err := h.Store.All(ctx, h.getWebhookPrefix(c))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get webhooks for pattern"})
+		return storeError(c, err, "Failed to get webhooks")
 	}
 
 	responses := make([]Webhook, 0, len(webhooks))
@@ -185,10 +326,13 @@ func (h *Handler) GetWebhooksForPattern(c echo.Context, pattern string) error {
 		if err := json.Unmarshal([]byte(kvItem.Value), &webhook); err != nil {
 			continue
 		}
-		if !h.keyMatches(pattern, webhook.Key) {
+		if pattern != "" && !h.keyMatches(pattern, webhook.Key) {
+			continue
+		}
+		if event != "" && webhook.Event != string(event) {
 			continue
 		}
-		responses = append(responses, webhook)
+		responses = append(responses, webhook.public())
 	}
 
 	return c.JSON(http.StatusOK, responses)
@@ -196,74 +340,97 @@ func (h *Handler) GetWebhooksForPattern(c echo.Context, pattern string) error {
 
 // UpdateWebhook updates an existing webhook
 func (h *Handler) UpdateWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
 	webhookID := c.Param("id")
 	if webhookID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": errWebhookIDEmpty})
+		return apierror.JSON(c, http.StatusBadRequest, errWebhookIDEmpty)
 	}
 
 	var update WebhookUpdate
 	if err := c.Bind(&update); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
 	}
 
 	// Get existing webhook
 	webhookKey := h.getWebhookKey(c, webhookID)
-	kvItem, found, err := h.Store.Get(webhookKey)
+	kvItem, found, err := h.Store.Get(ctx, webhookKey)
 	if err != nil || !found {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": errWebhookNotFound})
+		return apierror.JSON(c, http.StatusNotFound, errWebhookNotFound)
 	}
 
 	var webhook Webhook
 	if err := json.Unmarshal([]byte(kvItem.Value), &webhook); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to parse webhook"})
+		return apierror.JSON(c, http.StatusInternalServerError, "Failed to parse webhook")
 	}
 
 	// Update fields if provided
-	if err := h.applyWebhookUpdates(&webhook, &update); err != nil {
+	if err := h.applyWebhookUpdates(ctx, &webhook, &update); err != nil {
 		return err
 	}
 
 	// Save updated webhook
 	webhookJSON, err := json.Marshal(webhook)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to serialize webhook"})
+		return apierror.JSON(c, http.StatusInternalServerError, "Failed to serialize webhook")
 	}
 
-	if err := h.Store.Set(webhookKey, string(webhookJSON), 0); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update webhook"})
+	if err := h.Store.Set(ctx, webhookKey, string(webhookJSON), 0); err != nil {
+		return storeError(c, err, "Failed to update webhook")
 	}
 
-	return c.JSON(http.StatusOK, webhook)
+	return c.JSON(http.StatusOK, webhook.public())
 }
 
 // DeleteWebhook deletes a webhook by ID
 func (h *Handler) DeleteWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
 	webhookID := c.Param("id")
 	if webhookID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": errWebhookIDEmpty})
+		return apierror.JSON(c, http.StatusBadRequest, errWebhookIDEmpty)
 	}
 
 	webhookKey := h.getWebhookKey(c, webhookID)
-	if err := h.Store.Delete(webhookKey); err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": errWebhookNotFound})
+	if err := h.Store.Delete(ctx, webhookKey); err != nil {
+		return apierror.JSON(c, http.StatusNotFound, errWebhookNotFound)
 	}
 
 	return c.NoContent(http.StatusNoContent)
 }
 
 // applyWebhookUpdates applies update fields to a webhook
-func (h *Handler) applyWebhookUpdates(webhook *Webhook, update *WebhookUpdate) error {
+func (h *Handler) applyWebhookUpdates(ctx context.Context, webhook *Webhook, update *WebhookUpdate) error {
 	if update.Key != "" {
 		webhook.Key = update.Key
 	}
+	if update.MatchType != "" {
+		webhook.MatchType = update.MatchType
+	}
+	if update.Key != "" || update.MatchType != "" {
+		matchType, msg := h.validateKeyPattern(webhook.MatchType, webhook.Key)
+		if msg != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, msg)
+		}
+		webhook.MatchType = matchType
+	}
+	if update.ValueFilter != nil {
+		if *update.ValueFilter != "" {
+			if _, err := h.parsedValueFilter(*update.ValueFilter); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid value_filter: "+err.Error())
+			}
+		}
+		webhook.ValueFilter = *update.ValueFilter
+	}
 	if update.Event != "" {
 		event := WebhookEvent(strings.ToLower(update.Event))
-		if event != EventCreate && event != EventUpdate && event != EventDelete {
-			return echo.NewHTTPError(http.StatusBadRequest, "Event must be one of: create, update, delete")
+		if !event.valid() {
+			return echo.NewHTTPError(http.StatusBadRequest, errInvalidEvent)
 		}
 		webhook.Event = string(event)
 	}
 	if update.Endpoint != "" {
+		if msg := h.validateWebhookEndpoint(ctx, update.Endpoint); msg != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, msg)
+		}
 		webhook.Endpoint = update.Endpoint
 	}
 	if update.Method != "" {
@@ -281,6 +448,45 @@ func (h *Handler) applyWebhookUpdates(webhook *Webhook, update *WebhookUpdate) e
 	if update.AddEventData != webhook.AddEventData {
 		webhook.AddEventData = update.AddEventData
 	}
+	if update.Blocking != nil {
+		webhook.Blocking = *update.Blocking
+	}
+	if update.ReturnResponse != nil {
+		webhook.ReturnResponse = *update.ReturnResponse
+	}
+	if webhook.ReturnResponse && !webhook.Blocking {
+		return echo.NewHTTPError(http.StatusBadRequest, errReturnResponseNotBlocking)
+	}
+	if update.Enabled != nil {
+		webhook.Enabled = update.Enabled
+	}
+	if update.TimeoutSeconds != nil {
+		if *update.TimeoutSeconds < 0 || *update.TimeoutSeconds > maxWebhookTimeoutSeconds {
+			return echo.NewHTTPError(http.StatusBadRequest, errInvalidWebhookTimeout)
+		}
+		webhook.TimeoutSeconds = *update.TimeoutSeconds
+	}
+	if update.Secret != nil {
+		webhook.Secret = *update.Secret
+	}
+	if update.Retry != nil {
+		if msg := update.Retry.validate(); msg != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, msg)
+		}
+		webhook.Retry = update.Retry
+		if *update.Retry == (WebhookRetry{}) {
+			webhook.Retry = nil
+		}
+	}
+	if update.TLS != nil {
+		webhook.TLS = update.TLS
+		if *update.TLS == (WebhookTLS{}) {
+			webhook.TLS = nil
+		}
+		if _, err := h.getWebhookTransport(webhook.TLS); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid TLS settings: "+err.Error())
+		}
+	}
 	return nil
 }
 
@@ -296,8 +502,9 @@ func (h *Handler) keyMatches(pattern, key string) bool {
 // slicePrefixedKey extracts namespace, app name, and key from a prefixed key
 // Key format: /{basePrefix}/kv/{namespace}/{app}/{key}
 func (h *Handler) slicePrefixedKey(prefixedKey string) (namespace, appName, key string) {
-	parts := strings.Split(strings.TrimPrefix(prefixedKey, "/"+h.Config.BaseKeyPrefix+"/kv/"), "/")
-	if len(parts) < 2 {
+	// Namespaces and app names cannot contain slashes, so everything after them is the key
+	parts := strings.SplitN(strings.TrimPrefix(prefixedKey, "/"+h.Config.BaseKeyPrefix+"/kv/"), "/", 3)
+	if len(parts) < 3 {
 		return "", "", "" // Invalid key format
 	}
 	namespace = parts[0]
@@ -307,58 +514,67 @@ func (h *Handler) slicePrefixedKey(prefixedKey string) (namespace, appName, key
 	return namespace, appName, key
 }
 
-// triggerWebhooksForKey triggers webhooks for a given key and event type.
-func (h *Handler) triggerWebhooksForKey(prefixedKey string, event WebhookEvent, kvItem *store.KVItem) {
+// matchingWebhooks returns the enabled webhooks of a namespace/app registered for the given event and key.
+// It returns none while webhooks of the namespace are paused.
+func (h *Handler) matchingWebhooks(ctx context.Context, namespace, appName, key string, event WebhookEvent, kvItem *store.KVItem) ([]Webhook, error) {
+	decisions, err := h.evaluateWebhooks(ctx, namespace, appName, key, event, kvItem)
+	if err != nil {
+		return nil, err
+	}
+	return matchedWebhooks(decisions), nil
+}
+
+// triggerWebhooksForKey triggers webhooks for a given key and event type. oldItem is the key's
+// previous item, nil for creates.
+// Blocking webhooks are skipped, they are delivered by the write request itself, except for
+// expirations which no request causes.
+func (h *Handler) triggerWebhooksForKey(ctx context.Context, prefixedKey string, event WebhookEvent, kvItem, oldItem *store.KVItem) {
 	namespace, appName, key := h.slicePrefixedKey(prefixedKey)
 	if namespace == "" || appName == "" {
 		// Invalid key format, silently fail
 		return
 	}
 
-	// Build webhook prefix
-	webhookPrefix := "/" + h.Config.BaseKeyPrefix + "/webhooks/" + namespace + "/" + appName + "/"
-
-	// Get all webhooks for this namespace/app
-	allWebhooks, err := h.Store.All(webhookPrefix)
+	// The watcher keeps the webhooks cached, only look them up if the cache is not maintained
+	webhooks, known := h.webhookIndex.webhooksOf(namespace, appName)
+	if !known {
+		var err error
+		if webhooks, err = h.loadWebhooks(ctx, namespace, appName); err != nil {
+			return // Silently fail
+		}
+	}
+	decisions, err := h.decideWebhooks(ctx, namespace, webhooks, key, event, kvItem)
 	if err != nil {
 		return // Silently fail
 	}
 
-	// Filter and trigger matching webhooks
-	for _, webhookKV := range allWebhooks {
-		var webhook Webhook
-		if err := json.Unmarshal([]byte(webhookKV.Value), &webhook); err != nil {
-			continue
-		}
-
-		// Check if event matches
-		if WebhookEvent(webhook.Event) != event {
-			continue
-		}
-
-		// Check if key matches
-		if !h.keyMatches(webhook.Key, key) {
+	for _, webhook := range matchedWebhooks(decisions) {
+		if webhook.Blocking && event != EventExpire {
 			continue
 		}
-
 		// Trigger webhook asynchronously
-		go h.sendWebhook(webhook, key, kvItem)
+		if h.Config.WebhookPersistentQueue {
+			h.enqueueDelivery(webhook, key, event, kvItem, oldItem)
+		} else {
+			h.deliverAsync(webhook, key, event, kvItem, oldItem)
+		}
 	}
 }
 
 // buildWebhookPayload builds the webhook payload
-func (h *Handler) buildWebhookPayload(webhook Webhook, key string, kvItem *store.KVItem) ([]byte, error) {
+func (h *Handler) buildWebhookPayload(webhook Webhook, key string, kvItem, oldItem *store.KVItem) ([]byte, error) {
 	payload := make(map[string]interface{})
 
-	// Add custom payload fields if provided
+	// Add custom payload fields if provided, with event placeholders substituted
 	if webhook.Payload != nil {
+		template := newPayloadTemplate(webhook, key, kvItem)
 		for k, v := range webhook.Payload {
-			payload[k] = v
+			payload[k] = template.expand(v)
 		}
 	}
 
 	if webhook.AddEventData {
-		eventData := h.buildEventData(webhook, key, kvItem)
+		eventData := h.buildEventData(webhook, key, kvItem, oldItem)
 		payload["event"] = eventData
 	}
 
@@ -373,8 +589,9 @@ func (h *Handler) buildWebhookPayload(webhook Webhook, key string, kvItem *store
 	return payloadJSON, nil
 }
 
-// buildEventData builds the event data structure
-func (h *Handler) buildEventData(webhook Webhook, key string, kvItem *store.KVItem) map[string]interface{} {
+// buildEventData builds the event data structure. old_value is the key's previous value, null
+// for creates and whenever the previous value is not known.
+func (h *Handler) buildEventData(webhook Webhook, key string, kvItem, oldItem *store.KVItem) map[string]interface{} {
 	eventData := make(map[string]interface{})
 	eventData["event"] = webhook.Event
 	eventData["namespace"] = webhook.Namespace
@@ -383,7 +600,19 @@ func (h *Handler) buildEventData(webhook Webhook, key string, kvItem *store.KVIt
 	eventData["timestamp"] = time.Now().Unix()
 
 	if kvItem != nil {
-		eventData["value"] = kvItem.Value
+		eventData["value"] = encodedValue(kvItem)
+		if kvItem.Encoding != "" {
+			eventData["encoding"] = kvItem.Encoding
+		}
+		if kvItem.Checksum != "" {
+			eventData["checksum"] = kvItem.Checksum
+		}
+		if kvItem.ContentType != "" {
+			eventData["content_type"] = kvItem.ContentType
+		}
+		if len(kvItem.Tags) > 0 {
+			eventData["tags"] = kvItem.Tags
+		}
 		if kvItem.TTL != nil {
 			eventData["ttl"] = *kvItem.TTL
 			eventData["expire_at"] = time.Now().Add(time.Duration(*kvItem.TTL) * time.Second).Unix()
@@ -391,46 +620,190 @@ func (h *Handler) buildEventData(webhook Webhook, key string, kvItem *store.KVIt
 	} else {
 		eventData["value"] = nil
 	}
+	if oldItem != nil {
+		eventData["old_value"] = encodedValue(oldItem)
+	} else {
+		eventData["old_value"] = nil
+	}
 
 	return eventData
 }
 
-// sendHTTPRequest sends the HTTP request for a webhook
-func (h *Handler) sendHTTPRequest(webhook Webhook, payloadJSON []byte) error {
-	req, err := http.NewRequest(webhook.Method, webhook.Endpoint, bytes.NewBuffer(payloadJSON))
-	if err != nil {
-		return err
+// sendHTTPRequest sends the HTTP request for a webhook event on key, retrying with exponential
+// backoff on errors and non-2xx responses until the webhook's attempts are used up. Every
+// attempt is recorded in the webhook's delivery log under requestID, the ID of the request
+// that caused the event, if known.
+func (h *Handler) sendHTTPRequest(webhook Webhook, key, requestID string, payloadJSON []byte) error {
+	attempts, delay := h.webhookRetryPolicy(webhook)
+	for attempt := 1; ; attempt++ {
+		err := h.attemptDelivery(webhook, key, requestID, payloadJSON, attempt)
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+		time.Sleep(delay)
+		delay *= 2
 	}
+}
+
+// attemptDelivery sends a webhook request once and records the attempt in the delivery log.
+// A non-2xx response is returned as an error.
+func (h *Handler) attemptDelivery(webhook Webhook, key, requestID string, payloadJSON []byte, attempt int) error {
+	start := time.Now()
+	// Background deliveries are not tied to the request that caused the event, and start their own trace
+	status, _, err := h.doWebhookRequest(context.Background(), webhook, requestID, payloadJSON, 0)
+	if err == nil {
+		err = checkWebhookStatus(status)
+	}
+	record := newDeliveryAttempt(webhook, key, requestID, attempt, status, err, time.Since(start))
+	maxAttempts, _ := h.webhookRetryPolicy(webhook)
+	h.logDeliveryAttempt(webhook, record, attempt >= maxAttempts)
+	h.recordDeliveryAttempt(webhook, record)
+	return err
+}
 
+// setWebhookHeaders sets the headers of a webhook request: the standard ones, then
+// WEBHOOK_DEFAULT_HEADERS, then the webhook's own headers with their secrets resolved, so the
+// webhook's headers win on conflicts. It returns the secrets used, to redact from errors.
+func (h *Handler) setWebhookHeaders(ctx context.Context, req *http.Request, webhook Webhook, requestID string) ([]string, error) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "github.com/mrofi/simple-golang-kv")
-	if webhook.Headers != nil {
-		for k, v := range webhook.Headers {
-			req.Header.Set(k, v)
+	if requestID != "" {
+		req.Header.Set(middleware.HeaderRequestID, requestID)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	for k, v := range h.Config.WebhookDefaultHeaders {
+		req.Header.Set(k, v)
+	}
+	var secrets []string
+	for k, v := range webhook.Headers {
+		value, headerSecrets, err := h.resolveSecrets(ctx, webhook.Namespace, v)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, headerSecrets...)
+		req.Header.Set(k, value)
+	}
+	return secrets, nil
+}
+
+// doWebhookRequest sends the HTTP request for a webhook and returns the response status
+// and up to maxBody bytes of the response body. A non-empty requestID is sent in X-Request-ID.
+// The request is traced as a child of the span in ctx, and carries the trace context to the
+// receiver; canceling ctx does not cancel it.
+func (h *Handler) doWebhookRequest(ctx context.Context, webhook Webhook, requestID string, payloadJSON []byte, maxBody int64) (status int, body []byte, err error) {
+	ctx, span := tracing.Start(context.WithoutCancel(ctx), "webhook.deliver",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("webhook.id", webhook.ID),
+			attribute.String("webhook.event", string(webhook.Event)),
+			attribute.String("kv.namespace", webhook.Namespace),
+			attribute.String("kv.app", webhook.AppName),
+		))
+	defer func() {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		tracing.End(span, err)
+	}()
+
+	endpoint, secrets, err := h.resolveSecrets(ctx, webhook.Namespace, webhook.Endpoint)
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequest(webhook.Method, endpoint, bytes.NewBuffer(payloadJSON))
+	if err != nil {
+		return 0, nil, redactError(err, secrets)
+	}
+
+	headerSecrets, err := h.setWebhookHeaders(ctx, req, webhook, requestID)
+	if err != nil {
+		return 0, nil, err
+	}
+	secrets = append(secrets, headerSecrets...)
+	if webhook.Secret != "" {
+		signingSecret, _, err := h.resolveSecrets(ctx, webhook.Namespace, webhook.Secret)
+		if err != nil {
+			return 0, nil, err
 		}
+		setWebhookSignature(req, signingSecret, payloadJSON)
 	}
 
+	transport, err := h.getWebhookTransport(webhook.TLS)
+	if err != nil {
+		return 0, nil, err
+	}
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Timeout:   h.webhookTimeout(webhook),
+		Transport: transport,
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		// Transport errors quote the URL, which may hold a resolved secret
+		return 0, nil, redactError(err, secrets)
 	}
 	defer resp.Body.Close()
+
+	if maxBody > 0 {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxBody))
+		if err != nil {
+			return resp.StatusCode, nil, err
+		}
+	}
+	// Drain what's left so the connection can be reused, but never more than a bounded amount
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookDiscardMaxBytes))
+	return resp.StatusCode, body, nil
+}
+
+// webhookTimeout returns the request timeout of a webhook.
+func (h *Handler) webhookTimeout(webhook Webhook) time.Duration {
+	if webhook.TimeoutSeconds > 0 {
+		return time.Duration(webhook.TimeoutSeconds) * time.Second
+	}
+	return time.Duration(h.Config.WebhookTimeoutSeconds) * time.Second
+}
+
+// webhookStatusError is returned for a delivery whose receiver answered with a non-2xx status.
+type webhookStatusError struct {
+	Status int
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("receiver returned status %d", e.Status)
+}
+
+// checkWebhookStatus returns a *webhookStatusError unless status is a 2xx status.
+func checkWebhookStatus(status int) error {
+	if status < 200 || status > 299 {
+		return &webhookStatusError{Status: status}
+	}
 	return nil
 }
 
+// redactError returns err with the given secret values replaced, or err itself if there are none.
+func redactError(err error, secrets []string) error {
+	if len(secrets) == 0 {
+		return err
+	}
+	return errors.New(redact.Secrets(err.Error(), secrets...))
+}
+
 // sendWebhook sends the webhook HTTP request
-func (h *Handler) sendWebhook(webhook Webhook, key string, kvItem *store.KVItem) {
-	payloadJSON, err := h.buildWebhookPayload(webhook, key, kvItem)
+func (h *Handler) sendWebhook(webhook Webhook, key string, kvItem, oldItem *store.KVItem) {
+	payloadJSON, err := h.buildWebhookPayload(webhook, key, kvItem, oldItem)
 	if err != nil {
 		log.Printf("Error building payload for key %s to %s: %v", key, webhook.Endpoint, err)
 		return
 	}
 
-	if err := h.sendHTTPRequest(webhook, payloadJSON); err != nil {
-		log.Printf("Error sending webhook for key %s to %s: %v", key, webhook.Endpoint, err)
-		return
+	// Failures are logged by attemptDelivery
+	_ = h.sendHTTPRequest(webhook, key, itemRequestID(kvItem), payloadJSON)
+}
+
+// itemRequestID returns the ID of the request that wrote kvItem, or "" if it is unknown.
+func itemRequestID(kvItem *store.KVItem) string {
+	if kvItem == nil {
+		return ""
 	}
+	return kvItem.RequestID
 }
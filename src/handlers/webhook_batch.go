@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// WebhookBatchResult is the outcome of one registration of a batch, in request order: the new
+// webhook's ID, or why the registration was rejected.
+type WebhookBatchResult struct {
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// RegisterWebhooks registers several webhooks in one request. Each registration is validated
+// like in RegisterWebhook; the valid ones are stored in one etcd transaction and invalid ones
+// are reported without failing the rest. It returns 201 if any webhook was registered and 400
+// if none was.
+func (h *Handler) RegisterWebhooks(c echo.Context) error {
+	ctx := c.Request().Context()
+	var regs []WebhookRegistration
+	if err := c.Bind(&regs); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if len(regs) == 0 {
+		return apierror.JSON(c, http.StatusBadRequest, "Webhooks must not be empty")
+	}
+	if len(regs) > maxTxnOps {
+		return apierror.JSON(c, http.StatusBadRequest, fmt.Sprintf("Too many webhooks (max %d)", maxTxnOps))
+	}
+
+	results := make([]WebhookBatchResult, len(regs))
+	items := make([]store.KVItem, 0, len(regs))
+	for i, reg := range regs {
+		webhook, msg := h.newWebhook(c, reg)
+		if msg != "" {
+			results[i].Error = msg
+			continue
+		}
+		webhookJSON, err := json.Marshal(webhook)
+		if err != nil {
+			return apierror.JSON(c, http.StatusInternalServerError, "Failed to serialize webhook")
+		}
+		items = append(items, store.KVItem{Key: h.getWebhookKey(c, webhook.ID), Value: string(webhookJSON)})
+		results[i].ID = webhook.ID
+	}
+	if len(items) == 0 {
+		return apierror.JSONWithDetails(c, http.StatusBadRequest, "No webhook was registered", map[string]any{"results": results})
+	}
+
+	if err := h.Store.SetMany(ctx, items); err != nil {
+		return storeError(c, err, "Failed to register webhooks")
+	}
+	return c.JSON(http.StatusCreated, results)
+}
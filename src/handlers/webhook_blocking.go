@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mrofi/simple-golang-kv/src/middleware"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// WebhookResponse is the captured response of a blocking webhook delivery.
+type WebhookResponse struct {
+	ID     string `json:"id"`
+	Status int    `json:"status,omitempty"`
+	Body   any    `json:"body,omitempty"` // Embedded as JSON when the receiver returned JSON, otherwise a string
+	Error  string `json:"error,omitempty"`
+}
+
+// deliverBlockingWebhooks delivers the blocking webhooks matching a write before the request returns.
+// Deliveries run concurrently, so the write waits for the slowest receiver. Only responses of
+// webhooks with return_response are returned. oldItem is the key's previous item, if the write
+// knows it.
+func (h *Handler) deliverBlockingWebhooks(ctx context.Context, prefixedKey string, event WebhookEvent, kvItem, oldItem *store.KVItem) []WebhookResponse {
+	namespace, appName, key := h.slicePrefixedKey(prefixedKey)
+	if namespace == "" || appName == "" {
+		return nil
+	}
+
+	webhooks, err := h.matchingWebhooks(ctx, namespace, appName, key, event, kvItem)
+	if err != nil {
+		log.Printf("Error loading blocking webhooks for key %s: %v", key, err)
+		return nil
+	}
+
+	requestID := middleware.RequestIDFromContext(ctx)
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		responses []WebhookResponse
+	)
+	for _, webhook := range webhooks {
+		if !webhook.Blocking {
+			continue
+		}
+		wg.Add(1)
+		go func(webhook Webhook) {
+			defer wg.Done()
+			response := h.sendBlockingWebhook(ctx, webhook, key, requestID, kvItem, oldItem)
+			if !webhook.ReturnResponse {
+				return
+			}
+			mu.Lock()
+			responses = append(responses, response)
+			mu.Unlock()
+		}(webhook)
+	}
+	wg.Wait()
+	return responses
+}
+
+// sendBlockingWebhook delivers a webhook and captures the receiver's response.
+func (h *Handler) sendBlockingWebhook(ctx context.Context, webhook Webhook, key, requestID string, kvItem, oldItem *store.KVItem) WebhookResponse {
+	response := WebhookResponse{ID: webhook.ID}
+
+	payloadJSON, err := h.buildWebhookPayload(webhook, key, kvItem, oldItem)
+	if err != nil {
+		log.Printf("Error building payload for key %s to %s: %v", key, webhook.Endpoint, err)
+		response.Error = "Failed to build payload"
+		return response
+	}
+
+	maxBody := int64(0)
+	if webhook.ReturnResponse {
+		maxBody = int64(h.Config.WebhookResponseMaxBytes)
+	}
+	start := time.Now()
+	status, body, err := h.doWebhookRequest(ctx, webhook, requestID, payloadJSON, maxBody)
+	response.Status = status
+	deliveryErr := err
+	if deliveryErr == nil {
+		deliveryErr = checkWebhookStatus(status)
+	}
+	// Blocking deliveries are not retried
+	record := newDeliveryAttempt(webhook, key, requestID, 1, status, deliveryErr, time.Since(start))
+	h.logDeliveryAttempt(webhook, record, true)
+	h.recordDeliveryAttempt(webhook, record)
+	if err != nil {
+		response.Error = err.Error()
+		return response
+	}
+	// The receiver's response is still returned, its status tells the writer what went wrong
+
+	if len(body) > 0 {
+		if json.Valid(body) {
+			response.Body = json.RawMessage(body)
+		} else {
+			response.Body = string(body)
+		}
+	}
+	return response
+}
+
+// writeEvent returns the event of a write that replaced prev, nil if the key did not exist.
+func writeEvent(prev *store.KVItem) WebhookEvent {
+	if prev == nil {
+		return EventCreate
+	}
+	return EventUpdate
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrofi/simple-golang-kv/src/config"
+)
+
+// newBlockingReceiver starts a webhook receiver and returns its URL and the event data of the
+// deliveries it gets, in order.
+func newBlockingReceiver(t *testing.T) (string, chan map[string]any) {
+	t.Helper()
+	events := make(chan map[string]any, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload struct {
+			Event map[string]any `json:"event"`
+		}
+		json.Unmarshal(body, &payload)
+		events <- payload.Event
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, events
+}
+
+// registerBlockingWebhook registers a blocking webhook with event data for key and event.
+func registerBlockingWebhook(t *testing.T, h *Handler, endpoint, key, event, valueFilter string) {
+	t.Helper()
+	body := fmt.Sprintf(`{"key":%q,"match_type":"exact","event":%q,"endpoint":%q,"add_event_data":true,"blocking":true,"value_filter":%q}`,
+		key, event, endpoint, valueFilter)
+	c, rec := newTestContext(http.MethodPost, "/webhooks", body)
+	if status := serve(c, rec, h.RegisterWebhook); status != http.StatusCreated {
+		t.Fatalf("registering %s webhook: status = %d: %s", event, status, rec.Body)
+	}
+}
+
+func TestBlockingWebhooksSingleKeyWrites(t *testing.T) {
+	h := newTestHandler(t, func(cfg *config.Config) { cfg.WebhookAllowedNetworks = []string{"127.0.0.1"} })
+	endpoint, events := newBlockingReceiver(t)
+	for _, event := range []string{"create", "update"} {
+		registerBlockingWebhook(t, h, endpoint, "item", event, "")
+	}
+	// Deletes carry the deleted value, so a value filter applies to them too
+	registerBlockingWebhook(t, h, endpoint, "item", "delete", "state=done")
+
+	steps := []struct {
+		method, body    string
+		event           string
+		value, oldValue any
+	}{
+		{http.MethodPut, `{"value":"{\"state\":\"new\"}"}`, "create", `{"state":"new"}`, nil},
+		{http.MethodPut, `{"value":"{\"state\":\"done\"}"}`, "update", `{"state":"done"}`, `{"state":"new"}`},
+		{http.MethodDelete, "", "delete", `{"state":"done"}`, `{"state":"done"}`},
+	}
+	for _, step := range steps {
+		c, rec := newTestContext(step.method, "/kv/item", step.body, "key", "item")
+		handler := h.UpdateKeyValue
+		if step.method == http.MethodDelete {
+			handler = h.DeleteKeyValue
+		}
+		if status := serve(c, rec, handler); status >= 300 {
+			t.Fatalf("%s: status = %d: %s", step.event, status, rec.Body)
+		}
+		select {
+		case got := <-events:
+			if got["event"] != step.event || got["value"] != step.value || got["old_value"] != step.oldValue {
+				t.Errorf("%s: delivered event %v, value %v, old_value %v, want %s, %v, %v",
+					step.event, got["event"], got["value"], got["old_value"], step.event, step.value, step.oldValue)
+			}
+		default:
+			t.Errorf("%s: no blocking delivery", step.event)
+		}
+	}
+
+	// Deleting a key that does not exist fires nothing
+	c, rec := newTestContext(http.MethodDelete, "/kv/item", "", "key", "item")
+	if status := serve(c, rec, h.DeleteKeyValue); status != http.StatusNoContent {
+		t.Errorf("deleting a missing key: status = %d, want 204", status)
+	}
+	select {
+	case got := <-events:
+		t.Errorf("deleting a missing key delivered %v", got)
+	default:
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mrofi/simple-golang-kv/src/config"
+)
+
+// WebhookTLS holds the PEM encoded client certificate and CA used to deliver a webhook
+// over mutual TLS. Fields left empty fall back to the global WEBHOOK_CLIENT_* settings.
+type WebhookTLS struct {
+	ClientCert string `json:"client_cert,omitempty"` // PEM client certificate chain
+	ClientKey  string `json:"client_key,omitempty"`  // PEM private key, never returned by the API
+	CACert     string `json:"ca_cert,omitempty"`     // PEM CA certificates used to verify the receiver
+}
+
+// newWebhookTransport builds the HTTP transport used for webhook deliveries.
+// If WEBHOOK_SOURCE_ADDR is set, outbound connections are bound to that local IP.
+// If WEBHOOK_CLIENT_CERT_FILE/WEBHOOK_CLIENT_KEY_FILE or WEBHOOK_CA_FILE are set, they are
+// used for mutual TLS with receivers. Every dialed address is checked against addresses.
+func newWebhookTransport(cfg *config.Config, addresses webhookAddressPolicy) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   addresses.control,
+	}
+
+	if cfg.WebhookSourceAddr != "" {
+		ip := net.ParseIP(cfg.WebhookSourceAddr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_SOURCE_ADDR %q: not an IP address", cfg.WebhookSourceAddr)
+		}
+		if !isLocalIP(ip) {
+			return nil, fmt.Errorf("invalid WEBHOOK_SOURCE_ADDR %q: not assigned to any local interface", cfg.WebhookSourceAddr)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.WebhookClientCertFile != "" || cfg.WebhookClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.WebhookClientCertFile, cfg.WebhookClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_CLIENT_CERT_FILE/WEBHOOK_CLIENT_KEY_FILE: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.WebhookCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.WebhookCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("invalid WEBHOOK_CA_FILE %q: no certificates found", cfg.WebhookCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// isLocalIP reports whether ip is assigned to one of the host's interfaces.
+func isLocalIP(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// getWebhookTransport returns the transport used to deliver a webhook. Webhooks with their own
+// TLS settings get a dedicated transport, built once per distinct certificate set and cached.
+func (h *Handler) getWebhookTransport(webhookTLS *WebhookTLS) (*http.Transport, error) {
+	if webhookTLS == nil {
+		return h.webhookTransport, nil
+	}
+
+	sum := sha256.Sum256([]byte(webhookTLS.ClientCert + "\x00" + webhookTLS.ClientKey + "\x00" + webhookTLS.CACert))
+	cacheKey := hex.EncodeToString(sum[:])
+	if transport, ok := h.webhookTLSTransports.Load(cacheKey); ok {
+		return transport.(*http.Transport), nil
+	}
+
+	tlsConfig := h.webhookTransport.TLSClientConfig.Clone()
+	if webhookTLS.ClientCert != "" || webhookTLS.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(webhookTLS.ClientCert), []byte(webhookTLS.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if webhookTLS.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(webhookTLS.CACert)) {
+			return nil, errors.New("invalid CA certificate: no certificates found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := h.webhookTransport.Clone()
+	transport.TLSClientConfig = tlsConfig
+	actual, _ := h.webhookTLSTransports.LoadOrStore(cacheKey, transport)
+	return actual.(*http.Transport), nil
+}
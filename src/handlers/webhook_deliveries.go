@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// DeliveryAttempt is the recorded outcome of one attempt to deliver a webhook event.
+type DeliveryAttempt struct {
+	WebhookID  string `json:"webhook_id"`
+	Event      string `json:"event"`
+	Key        string `json:"key"`
+	RequestID  string `json:"request_id,omitempty"` // Request that caused the event, if known
+	Attempt    int    `json:"attempt"`
+	Status     int    `json:"status,omitempty"` // 0 if no response was received
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// getDeliveryLogPrefix returns the prefix of the recorded delivery attempts of a webhook.
+func (h *Handler) getDeliveryLogPrefix(namespace, appName, webhookID string) string {
+	return "/" + h.Config.BaseKeyPrefix + "/webhook-logs/" + namespace + "/" + appName + "/" + webhookID + "/"
+}
+
+// recordDeliveryAttempt stores a delivery attempt with a short TTL and trims the webhook's
+// log to the newest WEBHOOK_DELIVERY_LOG_MAX attempts. Attempts share leases, see
+// store.SharedLease, rather than costing one each. Failing to record is only logged.
+func (h *Handler) recordDeliveryAttempt(webhook Webhook, attempt DeliveryAttempt) {
+	ctx := context.Background()
+	if h.Config.WebhookDeliveryLogTTLSeconds <= 0 {
+		return
+	}
+	data, err := json.Marshal(attempt)
+	if err != nil {
+		return
+	}
+	leaseID, err := h.Store.SharedLease(ctx, int64(h.Config.WebhookDeliveryLogTTLSeconds))
+	if err != nil {
+		log.Printf("Error recording delivery of webhook %s: %v", webhook.ID, err)
+		return
+	}
+	prefix := h.getDeliveryLogPrefix(webhook.Namespace, webhook.AppName, webhook.ID)
+	// Zero-padded nanoseconds keep entries in chronological key order
+	entryKey := prefix + fmt.Sprintf("%019d-%s", time.Now().UnixNano(), uuid.New().String()[:8])
+	if err := h.Store.SetMany(ctx, []store.KVItem{{Key: entryKey, Value: string(data), LeaseID: leaseID}}); err != nil {
+		log.Printf("Error recording delivery of webhook %s: %v", webhook.ID, err)
+		return
+	}
+	if _, err := h.Store.Trim(ctx, prefix, int64(h.Config.WebhookDeliveryLogMax)); err != nil {
+		log.Printf("Error trimming delivery log of webhook %s: %v", webhook.ID, err)
+	}
+}
+
+// newDeliveryAttempt builds the record of an attempt from its outcome.
+func newDeliveryAttempt(webhook Webhook, key, requestID string, attempt, status int, err error, duration time.Duration) DeliveryAttempt {
+	record := DeliveryAttempt{
+		WebhookID:  webhook.ID,
+		Event:      webhook.Event,
+		Key:        key,
+		RequestID:  requestID,
+		Attempt:    attempt,
+		Status:     status,
+		DurationMs: duration.Milliseconds(),
+		Timestamp:  time.Now().Unix(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// GetWebhookDeliveries returns the recent delivery attempts of a webhook, newest first.
+func (h *Handler) GetWebhookDeliveries(c echo.Context) error {
+	ctx := c.Request().Context()
+	webhookID := c.Param("id")
+	if webhookID == "" {
+		return apierror.JSON(c, http.StatusBadRequest, errWebhookIDEmpty)
+	}
+	prefix := h.getDeliveryLogPrefix(h.getNamespace(c), h.getAppName(c), webhookID)
+	items, err := h.Store.All(ctx, prefix)
+	if err != nil {
+		return storeError(c, err, "Failed to get deliveries")
+	}
+
+	attempts := make([]DeliveryAttempt, 0, len(items))
+	for _, kvItem := range items {
+		var attempt DeliveryAttempt
+		if err := json.Unmarshal([]byte(kvItem.Value), &attempt); err != nil {
+			continue
+		}
+		attempts = append(attempts, attempt)
+	}
+	slices.Reverse(attempts)
+	return c.JSON(http.StatusOK, attempts)
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRecordDeliveryAttemptsShareLease(t *testing.T) {
+	h := newTestHandler(t, nil)
+	webhook := Webhook{ID: "hook", Namespace: "ns", AppName: "app", Event: string(EventCreate)}
+	for attempt := 1; attempt <= 3; attempt++ {
+		h.recordDeliveryAttempt(webhook, newDeliveryAttempt(webhook, "key", "", attempt, 503, nil, 0))
+	}
+
+	items, err := h.Store.All(context.Background(), h.getDeliveryLogPrefix("ns", "app", "hook"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("%d attempts recorded, want 3", len(items))
+	}
+	for _, item := range items[1:] {
+		if item.LeaseID == 0 || item.LeaseID != items[0].LeaseID {
+			t.Errorf("attempts recorded with leases %d and %d, want one shared lease", items[0].LeaseID, item.LeaseID)
+		}
+	}
+}
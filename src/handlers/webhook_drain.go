@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// Queue policies when all webhook workers are busy and the queue is full
+const (
+	webhookQueueBlock = "block" // Wait for room, holding up the watcher
+	webhookQueueDrop  = "drop"  // Dead-letter the delivery
+)
+
+var (
+	webhookQueueDepth        = expvar.NewInt("webhook_queue_depth")
+	webhookDeliveriesDropped = expvar.NewInt("webhook_deliveries_dropped")
+)
+
+// pendingDelivery is an asynchronous webhook delivery that has not finished yet.
+type pendingDelivery struct {
+	id      uint64
+	webhook Webhook
+	key     string
+	event   WebhookEvent
+	kvItem  *store.KVItem
+	oldItem *store.KVItem
+}
+
+// deliveryTracker queues asynchronous webhook deliveries for a fixed pool of workers, and keeps
+// track of them so they can be drained on shutdown.
+type deliveryTracker struct {
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+	draining  bool
+	abandoned bool // Drain timed out, queued deliveries were dead-lettered and must not be sent
+	nextID    uint64
+	pending   map[uint64]*pendingDelivery
+	queue     chan *pendingDelivery
+}
+
+func newDeliveryTracker(queueSize int) *deliveryTracker {
+	return &deliveryTracker{
+		pending: make(map[uint64]*pendingDelivery),
+		queue:   make(chan *pendingDelivery, max(queueSize, 0)),
+	}
+}
+
+// startDeliveryWorkers starts the workers that send queued webhook deliveries.
+func (h *Handler) startDeliveryWorkers(workers int) {
+	for range max(workers, 1) {
+		go h.runDeliveryWorker()
+	}
+}
+
+// runDeliveryWorker sends queued deliveries one at a time.
+func (h *Handler) runDeliveryWorker() {
+	t := h.deliveries
+	for delivery := range t.queue {
+		webhookQueueDepth.Add(-1)
+		t.mu.Lock()
+		abandoned := t.abandoned
+		t.mu.Unlock()
+		if !abandoned {
+			h.sendWebhook(delivery.webhook, delivery.key, delivery.kvItem, delivery.oldItem)
+		}
+		t.finish(delivery.id)
+	}
+}
+
+// finish marks a delivery as done.
+func (t *deliveryTracker) finish(id uint64) {
+	t.mu.Lock()
+	delete(t.pending, id)
+	t.mu.Unlock()
+	t.wg.Done()
+}
+
+// DeadLetter is an undelivered webhook event persisted for later inspection or replay.
+type DeadLetter struct {
+	ID        string          `json:"id"`
+	WebhookID string          `json:"webhook_id"`
+	Namespace string          `json:"namespace"`
+	AppName   string          `json:"appName"`
+	Key       string          `json:"key"`
+	Event     WebhookEvent    `json:"event"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Reason    string          `json:"reason"`
+	CreatedAt int64           `json:"created_at"`
+}
+
+// getDeadLetterPrefix returns the prefix of the dead-letter entries of a namespace/app.
+func (h *Handler) getDeadLetterPrefix(namespace, appName string) string {
+	return "/" + h.Config.BaseKeyPrefix + "/webhook-queue/dead/" + namespace + "/" + appName + "/"
+}
+
+// deliverAsync queues a webhook for the delivery workers, tracking it so shutdown can wait for it.
+// Once draining has started, new deliveries are dead-lettered instead of sent. When the queue is
+// full, it waits for room or dead-letters the delivery, depending on WEBHOOK_QUEUE_FULL_POLICY.
+func (h *Handler) deliverAsync(webhook Webhook, key string, event WebhookEvent, kvItem, oldItem *store.KVItem) {
+	t := h.deliveries
+	delivery := &pendingDelivery{webhook: webhook, key: key, event: event, kvItem: kvItem, oldItem: oldItem}
+
+	t.mu.Lock()
+	if t.draining {
+		t.mu.Unlock()
+		h.deadLetter(delivery, "shutting down")
+		return
+	}
+	t.nextID++
+	delivery.id = t.nextID
+	t.pending[delivery.id] = delivery
+	t.wg.Add(1)
+	t.mu.Unlock()
+
+	if h.Config.WebhookQueueFullPolicy == webhookQueueDrop {
+		select {
+		case t.queue <- delivery:
+			webhookQueueDepth.Add(1)
+		default:
+			t.finish(delivery.id)
+			webhookDeliveriesDropped.Add(1)
+			log.Printf("Webhook queue full, dead-lettering webhook %s for key %s", webhook.ID, key)
+			h.deadLetter(delivery, "delivery queue full")
+		}
+		return
+	}
+	webhookQueueDepth.Add(1)
+	t.queue <- delivery
+}
+
+// DrainWebhooks stops accepting new asynchronous deliveries and waits up to timeout for the
+// queued and in-flight ones to finish. Deliveries still queued or running after the timeout are
+// persisted to the dead-letter prefix, and queued ones are no longer sent. It returns how many
+// deliveries finished and how many were dead-lettered.
+func (h *Handler) DrainWebhooks(timeout time.Duration) (drained, deadLettered int) {
+	t := h.deliveries
+	t.mu.Lock()
+	t.draining = true
+	inFlight := len(t.pending)
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return inFlight, 0
+	case <-time.After(timeout):
+	}
+
+	t.mu.Lock()
+	t.abandoned = true
+	remaining := make([]*pendingDelivery, 0, len(t.pending))
+	for _, delivery := range t.pending {
+		remaining = append(remaining, delivery)
+	}
+	t.mu.Unlock()
+
+	// A delivery may still complete after being dead-lettered, so receivers can see it twice
+	for _, delivery := range remaining {
+		h.deadLetter(delivery, "delivery did not finish before shutdown")
+	}
+	return inFlight - len(remaining), len(remaining)
+}
+
+// deadLetter persists an undelivered webhook event.
+func (h *Handler) deadLetter(delivery *pendingDelivery, reason string) {
+	ctx := context.Background()
+	payload, err := h.buildWebhookPayload(delivery.webhook, delivery.key, delivery.kvItem, delivery.oldItem)
+	if err != nil {
+		log.Printf("Error building payload for key %s to %s: %v", delivery.key, delivery.webhook.Endpoint, err)
+	}
+	entry := DeadLetter{
+		ID:        uuid.New().String(),
+		WebhookID: delivery.webhook.ID,
+		Namespace: delivery.webhook.Namespace,
+		AppName:   delivery.webhook.AppName,
+		Key:       delivery.key,
+		Event:     delivery.event,
+		Reason:    reason,
+		CreatedAt: time.Now().Unix(),
+	}
+	if len(payload) > 0 {
+		entry.Payload = payload
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error dead-lettering webhook %s for key %s: %v", delivery.webhook.ID, delivery.key, err)
+		return
+	}
+	entryKey := h.getDeadLetterPrefix(entry.Namespace, entry.AppName) + entry.ID
+	if err := h.Store.Set(ctx, entryKey, string(data), 0); err != nil {
+		log.Printf("Error dead-lettering webhook %s for key %s: %v", delivery.webhook.ID, delivery.key, err)
+	}
+}
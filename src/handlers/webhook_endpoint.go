@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// secretHostPlaceholder stands in for ${secret:name} references while an endpoint is parsed.
+const secretHostPlaceholder = "secret-ref"
+
+// webhookAddressPolicy decides which addresses webhooks may be delivered to. Loopback,
+// private, link-local and unspecified addresses are refused so a webhook can't be used to
+// reach the server itself or the internal network, unless the operator allows their
+// network with WEBHOOK_ALLOWED_NETWORKS.
+type webhookAddressPolicy struct {
+	allowed []*net.IPNet
+}
+
+// permits reports whether a webhook may be delivered to ip.
+func (p webhookAddressPolicy) permits(ip net.IP) bool {
+	for _, ipNet := range p.allowed {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// control is the net.Dialer Control hook of webhook transports. It checks the address
+// actually dialed, so redirects and hosts resolving differently than at registration are
+// refused too.
+func (p webhookAddressPolicy) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !p.permits(ip) {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
+
+// validateWebhookEndpoint checks that endpoint is an http or https URL whose host resolves
+// only to permitted addresses. It returns an error message for a 400 response if not.
+// A host taken from a secret is only known at delivery, so it is checked when dialing.
+func (h *Handler) validateWebhookEndpoint(ctx context.Context, endpoint string) string {
+	u, err := url.Parse(secretRefPattern.ReplaceAllString(endpoint, secretHostPlaceholder))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return "Endpoint must be an http or https URL"
+	}
+	if strings.Contains(u.Host, secretHostPlaceholder) {
+		return ""
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Sprintf("Endpoint host %q cannot be resolved", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !h.webhookAddresses.permits(addr.IP) {
+			return fmt.Sprintf("Endpoint host %q resolves to %s, which is not an allowed webhook address", u.Hostname(), addr.IP)
+		}
+	}
+	return ""
+}
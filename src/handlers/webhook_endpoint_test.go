@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestWebhookAddressPolicyPermits(t *testing.T) {
+	_, allowed, _ := net.ParseCIDR("10.20.0.0/16")
+	policy := webhookAddressPolicy{allowed: []*net.IPNet{allowed}}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1::1", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"0.0.0.0", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"10.20.3.4", true},
+	}
+	for _, tt := range tests {
+		if got := policy.permits(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("permits(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookAddressPolicyControl(t *testing.T) {
+	var policy webhookAddressPolicy
+	if err := policy.control("tcp4", "127.0.0.1:8080", nil); err == nil {
+		t.Error("control allowed a loopback address")
+	}
+	if err := policy.control("tcp4", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("control refused a public address: %v", err)
+	}
+}
+
+func TestValidateWebhookEndpoint(t *testing.T) {
+	h := &Handler{}
+	tests := []struct {
+		endpoint string
+		valid    bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"http://[2606:2800:220:1::1]:8080/hook", true},
+		{"https://${secret:receiver_host}/hook", true},
+		{"https://93.184.216.34/${secret:path}", true},
+		{"ftp://93.184.216.34/hook", false},
+		{"/relative/hook", false},
+		{"https:///hook", false},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://10.0.0.5/hook", false},
+	}
+	for _, tt := range tests {
+		msg := h.validateWebhookEndpoint(context.Background(), tt.endpoint)
+		if (msg == "") != tt.valid {
+			t.Errorf("validateWebhookEndpoint(%q) = %q, want valid %v", tt.endpoint, msg, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mrofi/simple-golang-kv/src/store"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// webhookIndex caches the webhooks of every namespace/app and the paused namespaces, so the
+// watcher does not read and parse them from etcd for every key change. It is only populated
+// on the pod running the watcher, which keeps it current by watching the webhook and pause
+// prefixes.
+type webhookIndex struct {
+	mu       sync.RWMutex
+	ready    bool
+	silos    map[string]string             // webhook key -> namespace/app
+	webhooks map[string]map[string]Webhook // namespace/app -> webhook key -> webhook
+	lists    map[string][]Webhook          // namespace/app -> its webhooks ordered by key, rebuilt on change
+	paused   map[string]bool               // namespaces whose webhooks are all paused
+}
+
+func newWebhookIndex() *webhookIndex {
+	return &webhookIndex{}
+}
+
+// siloOf returns the namespace/app a webhook key belongs to.
+// Key format: {webhookPrefix}{namespace}/{app}/{id}
+func siloOf(webhookPrefix, key string) (string, bool) {
+	rest := strings.TrimPrefix(key, webhookPrefix)
+	i := strings.LastIndex(rest, "/")
+	if i <= 0 || len(rest) == len(key) {
+		return "", false
+	}
+	return rest[:i], true
+}
+
+// load replaces the index with the given webhooks and namespace pause flags.
+func (x *webhookIndex) load(webhookPrefix string, items []*store.KVItem, pausePrefix string, pauses []*store.KVItem) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.silos = make(map[string]string, len(items))
+	x.webhooks = make(map[string]map[string]Webhook)
+	x.lists = make(map[string][]Webhook)
+	x.paused = make(map[string]bool, len(pauses))
+	for _, item := range pauses {
+		x.paused[strings.TrimPrefix(item.Key, pausePrefix)] = true
+	}
+	changed := make(map[string]bool)
+	for _, item := range items {
+		if silo, ok := x.put(webhookPrefix, item.Key, item.Value); ok {
+			changed[silo] = true
+		}
+	}
+	for silo := range changed {
+		x.rebuild(silo)
+	}
+	x.ready = true
+}
+
+// put records a webhook, or drops it if its value cannot be parsed, as evaluateWebhooks skips
+// such webhooks. It returns the namespace/app whose list must be rebuilt. The caller must hold
+// the write lock.
+func (x *webhookIndex) put(webhookPrefix, key, value string) (string, bool) {
+	silo, ok := siloOf(webhookPrefix, key)
+	if !ok {
+		return "", false
+	}
+	var webhook Webhook
+	if err := json.Unmarshal([]byte(value), &webhook); err != nil {
+		return x.remove(key)
+	}
+	if x.webhooks[silo] == nil {
+		x.webhooks[silo] = make(map[string]Webhook)
+	}
+	x.silos[key] = silo
+	x.webhooks[silo][key] = webhook
+	return silo, true
+}
+
+// remove drops a webhook. It returns the namespace/app whose list must be rebuilt, and false
+// if the webhook was not indexed. The caller must hold the write lock.
+func (x *webhookIndex) remove(key string) (string, bool) {
+	silo, exists := x.silos[key]
+	if !exists {
+		return "", false
+	}
+	delete(x.silos, key)
+	delete(x.webhooks[silo], key)
+	if len(x.webhooks[silo]) == 0 {
+		delete(x.webhooks, silo)
+	}
+	return silo, true
+}
+
+// rebuild recomputes the ordered webhook list of a namespace/app. The caller must hold the
+// write lock.
+func (x *webhookIndex) rebuild(silo string) {
+	webhooks := x.webhooks[silo]
+	if len(webhooks) == 0 {
+		delete(x.lists, silo)
+		return
+	}
+	keys := make([]string, 0, len(webhooks))
+	for key := range webhooks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]Webhook, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, webhooks[key])
+	}
+	x.lists[silo] = list
+}
+
+// apply updates the index from webhook watch events, decoding their values with s.
+func (x *webhookIndex) apply(s *store.Store, webhookPrefix string, events []*clientv3.Event) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.ready {
+		return
+	}
+	changed := make(map[string]bool)
+	for _, event := range events {
+		key := string(event.Kv.Key)
+		var silo string
+		var ok bool
+		switch event.Type {
+		case mvccpb.PUT:
+			silo, ok = x.put(webhookPrefix, key, s.DecodeKVItem(key, event.Kv.Value).Value)
+		case mvccpb.DELETE:
+			silo, ok = x.remove(key)
+		}
+		if ok {
+			changed[silo] = true
+		}
+	}
+	for silo := range changed {
+		x.rebuild(silo)
+	}
+}
+
+// applyPauses updates the paused namespaces from pause flag watch events.
+func (x *webhookIndex) applyPauses(pausePrefix string, events []*clientv3.Event) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.ready {
+		return
+	}
+	for _, event := range events {
+		namespace := strings.TrimPrefix(string(event.Kv.Key), pausePrefix)
+		switch event.Type {
+		case mvccpb.PUT:
+			x.paused[namespace] = true
+		case mvccpb.DELETE:
+			delete(x.paused, namespace)
+		}
+	}
+}
+
+// reset empties the index, after which lookups report it as unknown.
+func (x *webhookIndex) reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.ready = false
+	x.silos = nil
+	x.webhooks = nil
+	x.lists = nil
+	x.paused = nil
+}
+
+// webhooksOf returns the webhooks of a namespace/app ordered by key, as etcd lists them. The
+// slice and the webhooks are shared and must not be modified. known is false if the index is
+// not being maintained on this pod, in which case the caller must look them up.
+func (x *webhookIndex) webhooksOf(namespace, appName string) (webhooks []Webhook, known bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if !x.ready {
+		return nil, false
+	}
+	return x.lists[namespace+"/"+appName], true
+}
+
+// namespacePaused reports whether the webhooks of a namespace are all paused. known is false if
+// the index is not being maintained on this pod, in which case the caller must look it up.
+func (x *webhookIndex) namespacePaused(namespace string) (paused, known bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if !x.ready {
+		return false, false
+	}
+	return x.paused[namespace], true
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/mrofi/simple-golang-kv/src/store"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestWebhookIndexPausedNamespaces(t *testing.T) {
+	const pausePrefix = "/kv/webhook-pause/"
+	x := newWebhookIndex()
+	if _, known := x.namespacePaused("ns"); known {
+		t.Fatal("namespacePaused is known before the index is loaded")
+	}
+
+	x.load("/kv/webhooks/", nil, pausePrefix, []*store.KVItem{{Key: pausePrefix + "ns"}})
+	if paused, known := x.namespacePaused("ns"); !paused || !known {
+		t.Errorf("namespacePaused(ns) = %v, %v, want true, true", paused, known)
+	}
+
+	x.applyPauses(pausePrefix, []*clientv3.Event{
+		{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(pausePrefix + "ns")}},
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(pausePrefix + "other")}},
+	})
+	if paused, _ := x.namespacePaused("ns"); paused {
+		t.Error("ns is still paused after its flag was deleted")
+	}
+	if paused, _ := x.namespacePaused("other"); !paused {
+		t.Error("other is not paused after its flag was written")
+	}
+
+	x.reset()
+	if _, known := x.namespacePaused("other"); known {
+		t.Error("namespacePaused is known after a reset")
+	}
+}
+
+// BenchmarkTriggerWebhooksManyNamespaces measures the watcher's webhook lookup for changes
+// spread over many busy namespaces, only one of which has a webhook, with and without the
+// webhook index.
+func BenchmarkTriggerWebhooksManyNamespaces(b *testing.B) {
+	h := newTestHandler(b, nil)
+	ctx := context.Background()
+	webhookPrefix := "/" + h.Config.BaseKeyPrefix + webhookPathSegment
+
+	webhook, _ := json.Marshal(Webhook{
+		ID: "hook", Namespace: "hooked", AppName: "app",
+		Key: "never/*", Event: string(EventUpdate), Endpoint: "https://example.com/hook",
+	})
+	if err := h.Store.Set(ctx, webhookPrefix+"hooked/app/hook", string(webhook), 0); err != nil {
+		b.Fatal(err)
+	}
+
+	const namespaces = 1000
+	keys := make([]string, namespaces)
+	keys[0] = h.getKVPrefix("hooked", "app") + "key"
+	for i := 1; i < namespaces; i++ {
+		keys[i] = h.getKVPrefix(fmt.Sprintf("busy-%d", i), "app") + "key"
+	}
+	item := &store.KVItem{Value: "value"}
+
+	b.Run("index", func(b *testing.B) {
+		webhooks, err := h.Store.All(ctx, webhookPrefix)
+		if err != nil {
+			b.Fatal(err)
+		}
+		h.webhookIndex.load(webhookPrefix, webhooks, h.getWebhookPausePrefix(), nil)
+		defer h.webhookIndex.reset()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			h.triggerWebhooksForKey(ctx, keys[i%namespaces], EventUpdate, item, nil)
+		}
+	})
+	b.Run("no index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			h.triggerWebhooksForKey(ctx, keys[i%namespaces], EventUpdate, item, nil)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// How a webhook's key pattern is matched against keys.
+const (
+	matchTypeExact  = "exact"  // The key equals the pattern
+	matchTypePrefix = "prefix" // A pattern ending with * matches keys starting with the rest, others match exactly
+	matchTypeGlob   = "glob"   // path.Match syntax, * does not match past a /
+	matchTypeRegex  = "regex"  // RE2 syntax, unanchored unless the pattern uses ^ and $
+)
+
+const errInvalidMatchType = "match_type must be one of: exact, prefix, glob, regex"
+
+// validateKeyPattern checks that pattern is valid for matchType, where empty means prefix.
+// It returns the normalized match type, or an error message for a 400 response.
+func (h *Handler) validateKeyPattern(matchType, pattern string) (string, string) {
+	matchType = strings.ToLower(matchType)
+	switch matchType {
+	case "":
+		matchType = matchTypePrefix
+	case matchTypeExact, matchTypePrefix:
+	case matchTypeGlob:
+		if _, err := path.Match(pattern, ""); err != nil {
+			return "", "Invalid glob key pattern: " + err.Error()
+		}
+	case matchTypeRegex:
+		if _, err := h.keyRegexp(pattern); err != nil {
+			return "", "Invalid regex key pattern: " + err.Error()
+		}
+	default:
+		return "", errInvalidMatchType
+	}
+	return matchType, ""
+}
+
+// webhookKeyMatches reports whether key matches the webhook's key pattern. Webhooks stored
+// before match types existed have none and use prefix matching.
+func (h *Handler) webhookKeyMatches(webhook Webhook, key string) bool {
+	switch webhook.MatchType {
+	case matchTypeExact:
+		return webhook.Key == key
+	case matchTypeGlob:
+		matched, err := path.Match(webhook.Key, key)
+		return err == nil && matched
+	case matchTypeRegex:
+		re, err := h.keyRegexp(webhook.Key)
+		return err == nil && re.MatchString(key)
+	default:
+		return h.keyMatches(webhook.Key, key)
+	}
+}
+
+// keyRegexp returns the compiled regex key pattern. Patterns are compiled once, when the
+// webhook is registered or first matched, and cached.
+func (h *Handler) keyRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := h.keyPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := h.keyPatterns.LoadOrStore(pattern, re)
+	return actual.(*regexp.Regexp), nil
+}
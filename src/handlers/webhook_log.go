@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// Webhook delivery log levels
+const (
+	webhookLogLevelInfo  = "info"  // Successful deliveries
+	webhookLogLevelWarn  = "warn"  // Failed attempts that will be retried
+	webhookLogLevelError = "error" // Failed attempts that will not be retried
+)
+
+var webhookLogLevelRank = map[string]int{webhookLogLevelInfo: 0, webhookLogLevelWarn: 1, webhookLogLevelError: 2}
+
+// webhookLog writes delivery log lines on stdout, like the request log.
+var webhookLog = log.New(os.Stdout, "", 0)
+
+// webhookLogEntry is one line of the delivery log.
+type webhookLogEntry struct {
+	Time       string `json:"time"`
+	Level      string `json:"level"`
+	Msg        string `json:"msg"`
+	WebhookID  string `json:"webhook_id"`
+	Namespace  string `json:"namespace"`
+	App        string `json:"app"`
+	Event      string `json:"event"`
+	Key        string `json:"key"`
+	Endpoint   string `json:"endpoint"`
+	Status     int    `json:"status"` // 0 if no response was received
+	Attempt    int    `json:"attempt"`
+	DurationMs int64  `json:"duration_ms"`
+	RequestID  string `json:"request_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// logDeliveryAttempt writes the outcome of a delivery attempt as a JSON line, at info if it
+// succeeded, warn if it failed and will be retried and error if it failed for good. Lines
+// below WEBHOOK_LOG_LEVEL are dropped, and nothing is written when it is "off".
+func (h *Handler) logDeliveryAttempt(webhook Webhook, attempt DeliveryAttempt, final bool) {
+	level, msg := webhookLogLevelInfo, "webhook delivered"
+	switch {
+	case attempt.Error != "" && final:
+		level, msg = webhookLogLevelError, "webhook delivery failed"
+	case attempt.Error != "":
+		level, msg = webhookLogLevelWarn, "webhook delivery attempt failed, retrying"
+	}
+	minRank, enabled := webhookLogLevelRank[h.Config.WebhookLogLevel]
+	if !enabled || webhookLogLevelRank[level] < minRank {
+		return
+	}
+	data, err := json.Marshal(webhookLogEntry{
+		Time:       time.Now().UTC().Format(time.RFC3339Nano),
+		Level:      level,
+		Msg:        msg,
+		WebhookID:  webhook.ID,
+		Namespace:  webhook.Namespace,
+		App:        webhook.AppName,
+		Event:      attempt.Event,
+		Key:        attempt.Key,
+		Endpoint:   webhook.Endpoint,
+		Status:     attempt.Status,
+		Attempt:    attempt.Attempt,
+		DurationMs: attempt.DurationMs,
+		RequestID:  attempt.RequestID,
+		Error:      attempt.Error,
+	})
+	if err == nil {
+		webhookLog.Println(string(data))
+	}
+}
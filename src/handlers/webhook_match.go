@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// Reasons a webhook does or does not fire for a key change.
+const (
+	matchReasonMatched         = "matched"
+	matchReasonNamespacePaused = "namespace_paused"
+	matchReasonDisabled        = "disabled"
+	matchReasonEventMismatch   = "event_mismatch"
+	matchReasonKeyMismatch     = "key_mismatch"
+	matchReasonFilteredOut     = "filtered_out"
+)
+
+// webhookDecision is whether one webhook fires for a key change, and why.
+type webhookDecision struct {
+	Webhook Webhook
+	Reason  string
+}
+
+// evaluateWebhooks decides for every webhook of a namespace/app whether it fires for the given
+// event and key, with kvItem the value value filters are checked against. This is the single
+// place deliveries are decided, so the match endpoint reports exactly what the watcher and
+// blocking deliveries do.
+// The webhooks are read from etcd, so a webhook registered or changed just before is always
+// taken into account.
+func (h *Handler) evaluateWebhooks(ctx context.Context, namespace, appName, key string, event WebhookEvent, kvItem *store.KVItem) ([]webhookDecision, error) {
+	webhooks, err := h.loadWebhooks(ctx, namespace, appName)
+	if err != nil {
+		return nil, err
+	}
+	return h.decideWebhooks(ctx, namespace, webhooks, key, event, kvItem)
+}
+
+// loadWebhooks reads the webhooks of a namespace/app from etcd, skipping any that cannot be parsed.
+func (h *Handler) loadWebhooks(ctx context.Context, namespace, appName string) ([]Webhook, error) {
+	// Build webhook prefix
+	webhookPrefix := "/" + h.Config.BaseKeyPrefix + "/webhooks/" + namespace + "/" + appName + "/"
+
+	// Get all webhooks for this namespace/app
+	allWebhooks, err := h.Store.All(ctx, webhookPrefix)
+	if err != nil {
+		return nil, err
+	}
+	webhooks := make([]Webhook, 0, len(allWebhooks))
+	for _, webhookKV := range allWebhooks {
+		var webhook Webhook
+		if err := json.Unmarshal([]byte(webhookKV.Value), &webhook); err != nil {
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+// decideWebhooks decides for each of the webhooks of a namespace whether it fires for the
+// given event, key and value.
+func (h *Handler) decideWebhooks(ctx context.Context, namespace string, webhooks []Webhook, key string, event WebhookEvent, kvItem *store.KVItem) ([]webhookDecision, error) {
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+	paused, err := h.isNamespacePaused(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := make([]webhookDecision, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		decisions = append(decisions, webhookDecision{
+			Webhook: webhook,
+			Reason:  h.webhookMatchReason(webhook, key, event, kvItem, paused),
+		})
+	}
+	return decisions, nil
+}
+
+// matchedWebhooks returns the webhooks of the decisions that fire.
+func matchedWebhooks(decisions []webhookDecision) []Webhook {
+	var matched []Webhook
+	for _, decision := range decisions {
+		if decision.Reason == matchReasonMatched {
+			matched = append(matched, decision.Webhook)
+		}
+	}
+	return matched
+}
+
+// webhookMatchReason returns why a webhook does or does not fire for a key change.
+func (h *Handler) webhookMatchReason(webhook Webhook, key string, event WebhookEvent, kvItem *store.KVItem, namespacePaused bool) string {
+	switch {
+	case namespacePaused:
+		return matchReasonNamespacePaused
+	case !webhook.isEnabled():
+		return matchReasonDisabled
+	case WebhookEvent(webhook.Event) != event:
+		return matchReasonEventMismatch
+	case !h.webhookKeyMatches(webhook, key):
+		return matchReasonKeyMismatch
+	case !h.valueFilterMatches(webhook, kvItem):
+		return matchReasonFilteredOut
+	default:
+		return matchReasonMatched
+	}
+}
+
+// WebhookMatchRequest describes a key change to evaluate webhooks against.
+type WebhookMatchRequest struct {
+	Key   string  `json:"key"`
+	Event string  `json:"event"`
+	Value *string `json:"value,omitempty"` // Value checked against value filters; without it, webhooks with one are filtered out
+}
+
+// WebhookMatchResult is the decision for one webhook.
+type WebhookMatchResult struct {
+	ID       string `json:"id"`
+	Key      string `json:"key"`
+	Event    string `json:"event"`
+	Endpoint string `json:"endpoint"`
+	Blocking bool   `json:"blocking"`
+	Matched  bool   `json:"matched"`
+	Reason   string `json:"reason"`
+}
+
+// MatchWebhooks reports, for every webhook of the caller's namespace/app, whether it would fire
+// for the given key change and why. Nothing is delivered.
+func (h *Handler) MatchWebhooks(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req WebhookMatchRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.JSON(c, http.StatusBadRequest, "Invalid input")
+	}
+	if req.Key == "" {
+		return apierror.JSON(c, http.StatusBadRequest, errKeyEmpty)
+	}
+	event := WebhookEvent(strings.ToLower(req.Event))
+	if !event.valid() {
+		return apierror.JSON(c, http.StatusBadRequest, errInvalidEvent)
+	}
+
+	var kvItem *store.KVItem
+	if req.Value != nil {
+		kvItem = &store.KVItem{Value: *req.Value}
+	}
+	decisions, err := h.evaluateWebhooks(ctx, h.getNamespace(c), h.getAppName(c), req.Key, event, kvItem)
+	if err != nil {
+		return storeError(c, err, "Failed to get webhooks")
+	}
+
+	matched := make([]string, 0)
+	results := make([]WebhookMatchResult, 0, len(decisions))
+	for _, decision := range decisions {
+		webhook := decision.Webhook
+		isMatch := decision.Reason == matchReasonMatched
+		if isMatch {
+			matched = append(matched, webhook.ID)
+		}
+		results = append(results, WebhookMatchResult{
+			ID:       webhook.ID,
+			Key:      webhook.Key,
+			Event:    webhook.Event,
+			Endpoint: webhook.Endpoint,
+			Blocking: webhook.Blocking,
+			Matched:  isMatch,
+			Reason:   decision.Reason,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"key":      req.Key,
+		"event":    event,
+		"matched":  matched,
+		"webhooks": results,
+	})
+}
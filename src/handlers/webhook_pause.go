@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+)
+
+// getWebhookPausePrefix returns the prefix of the keys flagging paused namespaces.
+func (h *Handler) getWebhookPausePrefix() string {
+	return "/" + h.Config.BaseKeyPrefix + "/webhook-pause/"
+}
+
+// getWebhookPauseKey returns the key flagging that all webhooks of a namespace are paused.
+func (h *Handler) getWebhookPauseKey(namespace string) string {
+	return h.getWebhookPausePrefix() + namespace
+}
+
+// isNamespacePaused reports whether webhook delivery is paused for a whole namespace. The
+// watcher keeps the flags cached with the webhook index, etcd is only read on other pods.
+func (h *Handler) isNamespacePaused(ctx context.Context, namespace string) (bool, error) {
+	if paused, known := h.webhookIndex.namespacePaused(namespace); known {
+		return paused, nil
+	}
+	_, found, err := h.Store.Get(ctx, h.getWebhookPauseKey(namespace))
+	return found, err
+}
+
+// namespaceParam returns the :namespace path parameter of the admin routes, which the
+// identity middleware does not check.
+func (h *Handler) namespaceParam(c echo.Context) (string, error) {
+	namespace := c.Param("namespace")
+	switch {
+	case namespace == "":
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Namespace must not be empty")
+	case len(namespace) > h.Config.MaxNamespaceLen:
+		return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Namespace too long (max %d characters)", h.Config.MaxNamespaceLen))
+	case strings.Contains(namespace, "/"):
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Namespace must not contain /")
+	}
+	return namespace, nil
+}
+
+// PauseWebhook stops deliveries of a webhook without deleting it.
+func (h *Handler) PauseWebhook(c echo.Context) error {
+	return h.setWebhookEnabled(c, false)
+}
+
+// ResumeWebhook restarts deliveries of a paused webhook.
+func (h *Handler) ResumeWebhook(c echo.Context) error {
+	return h.setWebhookEnabled(c, true)
+}
+
+// setWebhookEnabled sets the enabled flag of the webhook in the :id path parameter.
+func (h *Handler) setWebhookEnabled(c echo.Context, enabled bool) error {
+	ctx := c.Request().Context()
+	webhookID := c.Param("id")
+	if webhookID == "" {
+		return apierror.JSON(c, http.StatusBadRequest, errWebhookIDEmpty)
+	}
+
+	webhookKey := h.getWebhookKey(c, webhookID)
+	kvItem, found, err := h.Store.Get(ctx, webhookKey)
+	if err != nil || !found {
+		return apierror.JSON(c, http.StatusNotFound, errWebhookNotFound)
+	}
+
+	var webhook Webhook
+	if err := json.Unmarshal([]byte(kvItem.Value), &webhook); err != nil {
+		return apierror.JSON(c, http.StatusInternalServerError, "Failed to parse webhook")
+	}
+	webhook.Enabled = &enabled
+
+	webhookJSON, err := json.Marshal(webhook)
+	if err != nil {
+		return apierror.JSON(c, http.StatusInternalServerError, "Failed to serialize webhook")
+	}
+	if err := h.Store.Set(ctx, webhookKey, string(webhookJSON), 0); err != nil {
+		return storeError(c, err, "Failed to update webhook")
+	}
+
+	return c.JSON(http.StatusOK, webhook.public())
+}
+
+// PauseNamespaceWebhooks stops deliveries of every webhook in the :namespace namespace, across all
+// apps. It is an admin route, since it affects apps other than the caller's.
+func (h *Handler) PauseNamespaceWebhooks(c echo.Context) error {
+	ctx := c.Request().Context()
+	namespace, err := h.namespaceParam(c)
+	if err != nil {
+		return err
+	}
+	if err := h.Store.Set(ctx, h.getWebhookPauseKey(namespace), "", 0); err != nil {
+		return storeError(c, err, "Failed to pause webhooks")
+	}
+	return c.JSON(http.StatusOK, map[string]any{"namespace": namespace, "paused": true})
+}
+
+// ResumeNamespaceWebhooks restarts deliveries of the webhooks in the :namespace namespace.
+// Webhooks paused individually stay paused.
+func (h *Handler) ResumeNamespaceWebhooks(c echo.Context) error {
+	ctx := c.Request().Context()
+	namespace, err := h.namespaceParam(c)
+	if err != nil {
+		return err
+	}
+	if err := h.Store.Delete(ctx, h.getWebhookPauseKey(namespace)); err != nil {
+		return storeError(c, err, "Failed to resume webhooks")
+	}
+	return c.JSON(http.StatusOK, map[string]any{"namespace": namespace, "paused": false})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// WebhookTestResult is the outcome of a test delivery.
+type WebhookTestResult struct {
+	ID         string `json:"id"`
+	OK         bool   `json:"ok"` // The receiver answered with a 2xx status
+	Status     int    `json:"status,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// TestWebhook sends a synthetic event to a webhook's endpoint and reports how the receiver
+// answered. The delivery is made synchronously and once, with the webhook's method and headers,
+// even if the webhook is paused.
+func (h *Handler) TestWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+	webhookID := c.Param("id")
+	if webhookID == "" {
+		return apierror.JSON(c, http.StatusBadRequest, errWebhookIDEmpty)
+	}
+
+	kvItem, found, err := h.Store.Get(ctx, h.getWebhookKey(c, webhookID))
+	if err != nil || !found {
+		return apierror.JSON(c, http.StatusNotFound, errWebhookNotFound)
+	}
+	var webhook Webhook
+	if err := json.Unmarshal([]byte(kvItem.Value), &webhook); err != nil {
+		return apierror.JSON(c, http.StatusInternalServerError, "Failed to parse webhook")
+	}
+
+	payloadJSON, err := h.buildTestWebhookPayload(webhook)
+	if err != nil {
+		return apierror.JSON(c, http.StatusInternalServerError, "Failed to build payload")
+	}
+
+	result := WebhookTestResult{ID: webhook.ID}
+	start := time.Now()
+	status, _, err := h.doWebhookRequest(ctx, webhook, "", payloadJSON, 0)
+	result.DurationMs = time.Since(start).Milliseconds()
+	result.Status = status
+	if err == nil {
+		err = checkWebhookStatus(status)
+	}
+	if err != nil {
+		log.Printf("Test delivery of webhook %s to %s failed: %v", webhook.ID, webhook.Endpoint, err)
+		result.Error = err.Error()
+	}
+	result.OK = err == nil
+	return c.JSON(http.StatusOK, result)
+}
+
+// buildTestWebhookPayload builds the payload of a test delivery: the webhook's own payload
+// marked with "test": true, and synthetic event data if the webhook adds event data.
+func (h *Handler) buildTestWebhookPayload(webhook Webhook) ([]byte, error) {
+	key := strings.TrimSuffix(webhook.Key, "*")
+	kvItem := &store.KVItem{Key: key, Value: "test"}
+	payload := make(map[string]interface{})
+	template := newPayloadTemplate(webhook, key, kvItem)
+	for k, v := range webhook.Payload {
+		payload[k] = template.expand(v)
+	}
+	payload["test"] = true
+	if webhook.AddEventData {
+		eventData := h.buildEventData(webhook, key, kvItem, nil)
+		eventData["test"] = true
+		payload["event"] = eventData
+	}
+	return json.Marshal(payload)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// deliveryQueueBatch is the max number of due deliveries processed per poll.
+const deliveryQueueBatch = 100
+
+// errQueueBatchFull stops scanning the queue once a batch of due deliveries is collected.
+var errQueueBatchFull = errors.New("queue batch full")
+
+// queuedDelivery is a webhook delivery persisted in etcd until it succeeds or is dead-lettered.
+type queuedDelivery struct {
+	ID            string        `json:"id"`
+	WebhookID     string        `json:"webhook_id"`
+	Namespace     string        `json:"namespace"`
+	AppName       string        `json:"appName"`
+	Key           string        `json:"key"`
+	Event         WebhookEvent  `json:"event"`
+	Item          *store.KVItem `json:"item,omitempty"`     // Nil for deletes of keys the watcher had not seen
+	OldItem       *store.KVItem `json:"old_item,omitempty"` // The key's previous item, nil for creates
+	Attempts      int           `json:"attempts"`
+	NextAttemptAt int64         `json:"next_attempt_at"` // Unix milliseconds
+	CreatedAt     int64         `json:"created_at"`
+}
+
+// getDeliveryQueuePrefix returns the prefix of the persistent delivery queue.
+func (h *Handler) getDeliveryQueuePrefix() string {
+	return "/" + h.Config.BaseKeyPrefix + "/webhook-queue/pending/"
+}
+
+// enqueueDelivery persists a webhook delivery for the queue worker. If it cannot be persisted,
+// it is delivered from memory instead so the event is not lost.
+func (h *Handler) enqueueDelivery(webhook Webhook, key string, event WebhookEvent, kvItem, oldItem *store.KVItem) {
+	ctx := context.Background()
+	now := time.Now()
+	entry := queuedDelivery{
+		ID:            uuid.New().String(),
+		WebhookID:     webhook.ID,
+		Namespace:     webhook.Namespace,
+		AppName:       webhook.AppName,
+		Key:           key,
+		Event:         event,
+		Item:          kvItem,
+		OldItem:       oldItem,
+		NextAttemptAt: now.UnixMilli(),
+		CreatedAt:     now.Unix(),
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		// Zero-padded nanoseconds keep entries in the order they were queued
+		entryKey := h.getDeliveryQueuePrefix() + fmt.Sprintf("%019d-%s", now.UnixNano(), entry.ID)
+		err = h.Store.SetMany(ctx, []store.KVItem{{Key: entryKey, Value: string(data)}})
+	}
+	if err != nil {
+		log.Printf("Error queueing webhook %s for key %s, delivering from memory: %v", webhook.ID, key, err)
+		h.deliverAsync(webhook, key, event, kvItem, oldItem)
+	}
+}
+
+// runDeliveryQueue delivers the persisted queue until ctx is canceled. It runs on the pod
+// holding the watcher lock, so deliveries left behind by a crashed holder are picked up by
+// the next one.
+func (h *Handler) runDeliveryQueue(ctx context.Context) {
+	ticker := time.NewTicker(h.Config.WebhookQueuePoll())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.processDeliveryQueue(ctx)
+		}
+	}
+}
+
+// processDeliveryQueue attempts every due delivery of the queue, up to a batch, using at most
+// WEBHOOK_WORKERS concurrent requests, and waits for them all.
+func (h *Handler) processDeliveryQueue(ctx context.Context) {
+	now := time.Now().UnixMilli()
+	due := make(map[string]queuedDelivery)
+	err := h.Store.Scan(ctx, h.getDeliveryQueuePrefix(), deliveryQueueBatch, func(kvItem *store.KVItem) error {
+		var entry queuedDelivery
+		if err := json.Unmarshal([]byte(kvItem.Value), &entry); err != nil {
+			log.Printf("Dropping unreadable queued delivery %s: %v", kvItem.Key, err)
+			h.removeQueuedDelivery(kvItem.Key)
+			return nil
+		}
+		if entry.NextAttemptAt <= now {
+			due[kvItem.Key] = entry
+		}
+		if len(due) >= deliveryQueueBatch {
+			return errQueueBatchFull
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errQueueBatchFull) {
+		log.Printf("Error reading webhook delivery queue: %v", err)
+		return
+	}
+
+	sem := make(chan struct{}, max(h.Config.WebhookWorkers, 1))
+	var wg sync.WaitGroup
+	for entryKey, entry := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			h.deliverQueued(entryKey, entry)
+		}()
+	}
+	wg.Wait()
+}
+
+// deliverQueued makes one attempt of a queued delivery. On success the entry is removed; on
+// failure it is rescheduled with exponential backoff, or dead-lettered once the webhook's
+// attempts are used up.
+func (h *Handler) deliverQueued(entryKey string, entry queuedDelivery) {
+	ctx := context.Background()
+	webhookKey := "/" + h.Config.BaseKeyPrefix + webhookPathSegment + entry.Namespace + "/" + entry.AppName + "/" + entry.WebhookID
+	webhookItem, found, err := h.Store.Get(ctx, webhookKey)
+	if err != nil {
+		return // Try again on the next poll
+	}
+	var webhook Webhook
+	if !found || json.Unmarshal([]byte(webhookItem.Value), &webhook) != nil || !webhook.isEnabled() {
+		// Deleted or paused since the event, neither is delivered later
+		h.removeQueuedDelivery(entryKey)
+		return
+	}
+
+	payloadJSON, err := h.buildWebhookPayload(webhook, entry.Key, entry.Item, entry.OldItem)
+	if err == nil {
+		err = h.attemptDelivery(webhook, entry.Key, itemRequestID(entry.Item), payloadJSON, entry.Attempts+1)
+	}
+	if err == nil {
+		h.removeQueuedDelivery(entryKey)
+		return
+	}
+
+	entry.Attempts++
+	maxAttempts, delay := h.webhookRetryPolicy(webhook)
+	if entry.Attempts >= maxAttempts {
+		h.deadLetter(&pendingDelivery{webhook: webhook, key: entry.Key, event: entry.Event, kvItem: entry.Item, oldItem: entry.OldItem}, "delivery attempts exhausted")
+		h.removeQueuedDelivery(entryKey)
+		return
+	}
+	entry.NextAttemptAt = time.Now().Add(delay << (entry.Attempts - 1)).UnixMilli()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := h.Store.SetMany(ctx, []store.KVItem{{Key: entryKey, Value: string(data)}}); err != nil {
+		log.Printf("Error rescheduling queued delivery %s: %v", entry.ID, err)
+	}
+}
+
+// removeQueuedDelivery deletes a queue entry.
+func (h *Handler) removeQueuedDelivery(entryKey string) {
+	ctx := context.Background()
+	if _, _, err := h.Store.Batch(ctx, []store.BatchOp{{Item: &store.KVItem{Key: entryKey}, Delete: true}}); err != nil {
+		log.Printf("Error removing queued delivery %s: %v", entryKey, err)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	maxWebhookAttempts    = 10
+	maxWebhookRetryBaseMs = 60000
+)
+
+// WebhookRetry overrides the delivery retry settings of a webhook. Zero fields fall back to
+// WEBHOOK_MAX_ATTEMPTS and WEBHOOK_RETRY_BASE_MS.
+type WebhookRetry struct {
+	MaxAttempts int `json:"max_attempts,omitempty"`  // Attempts including the first one
+	BaseDelayMs int `json:"base_delay_ms,omitempty"` // Delay before the first retry, doubled for each further retry
+}
+
+// validate returns an error message, or an empty string if the retry settings are valid.
+func (r *WebhookRetry) validate() string {
+	if r == nil {
+		return ""
+	}
+	if r.MaxAttempts < 0 || r.MaxAttempts > maxWebhookAttempts {
+		return fmt.Sprintf("retry.max_attempts must be between 1 and %d", maxWebhookAttempts)
+	}
+	if r.BaseDelayMs < 0 || r.BaseDelayMs > maxWebhookRetryBaseMs {
+		return fmt.Sprintf("retry.base_delay_ms must be between 0 and %d", maxWebhookRetryBaseMs)
+	}
+	return ""
+}
+
+// webhookRetryPolicy returns how many times a webhook delivery is attempted and the delay
+// before the first retry.
+func (h *Handler) webhookRetryPolicy(webhook Webhook) (int, time.Duration) {
+	attempts := h.Config.WebhookMaxAttempts
+	baseMs := h.Config.WebhookRetryBaseMs
+	if webhook.Retry != nil {
+		if webhook.Retry.MaxAttempts > 0 {
+			attempts = webhook.Retry.MaxAttempts
+		}
+		if webhook.Retry.BaseDelayMs > 0 {
+			baseMs = webhook.Retry.BaseDelayMs
+		}
+	}
+	return max(attempts, 1), time.Duration(baseMs) * time.Millisecond
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	headerWebhookSignature = "X-KV-Signature"
+	headerWebhookTimestamp = "X-KV-Timestamp"
+)
+
+// signWebhookPayload computes the signature of a delivery: the hex HMAC-SHA256, keyed with the
+// webhook secret, of the timestamp, a dot and the payload bytes.
+func signWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// setWebhookSignature adds the signature and timestamp headers to a delivery request.
+func setWebhookSignature(req *http.Request, secret string, payload []byte) {
+	timestamp := time.Now().Unix()
+	req.Header.Set(headerWebhookTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(headerWebhookSignature, signWebhookPayload(secret, timestamp, payload))
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// payloadTemplate substitutes event placeholders in the string values of a webhook payload.
+type payloadTemplate struct {
+	replacer *strings.Replacer
+}
+
+// newPayloadTemplate builds the substitutions of an event on key. kvItem is nil for deletes.
+func newPayloadTemplate(webhook Webhook, key string, kvItem *store.KVItem) *payloadTemplate {
+	value := ""
+	if kvItem != nil {
+		value = encodedValue(kvItem)
+	}
+	return &payloadTemplate{replacer: strings.NewReplacer(
+		"{{key}}", key,
+		"{{value}}", value,
+		"{{namespace}}", webhook.Namespace,
+		"{{event}}", webhook.Event,
+	)}
+}
+
+// expand returns v with placeholders substituted in every string, recursing into nested
+// objects and arrays. Other values are returned unchanged.
+func (t *payloadTemplate) expand(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v
+		}
+		return t.replacer.Replace(v)
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			expanded[k] = t.expand(item)
+		}
+		return expanded
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		for i, item := range v {
+			expanded[i] = t.expand(item)
+		}
+		return expanded
+	default:
+		return v
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mrofi/simple-golang-kv/src/config"
+)
+
+func TestSlicePrefixedKey(t *testing.T) {
+	h := &Handler{Config: &config.Config{BaseKeyPrefix: "kvstore"}}
+	tests := []struct {
+		prefixedKey         string
+		namespace, app, key string
+	}{
+		{"/kvstore/kv/ns/app/foo", "ns", "app", "foo"},
+		{"/kvstore/kv/ns/app/a/b/c", "ns", "app", "a/b/c"},
+		{"/kvstore/kv/ns/app/config/db/primary/host", "ns", "app", "config/db/primary/host"},
+		{"/kvstore/kv/ns/app//leading", "ns", "app", "/leading"},
+		{"/kvstore/kv/ns/app/trailing/", "ns", "app", "trailing/"},
+		{"/kvstore/kv/ns/app/", "ns", "app", ""},
+		{"/kvstore/kv/ns/app", "", "", ""},
+		{"/kvstore/kv/ns", "", "", ""},
+	}
+	for _, tt := range tests {
+		namespace, app, key := h.slicePrefixedKey(tt.prefixedKey)
+		if namespace != tt.namespace || app != tt.app || key != tt.key {
+			t.Errorf("slicePrefixedKey(%q) = %q, %q, %q, want %q, %q, %q",
+				tt.prefixedKey, namespace, app, key, tt.namespace, tt.app, tt.key)
+		}
+	}
+}
+
+func TestKeyMatchesKeysWithSlashes(t *testing.T) {
+	h := &Handler{Config: &config.Config{BaseKeyPrefix: "kvstore"}}
+	_, _, key := h.slicePrefixedKey("/kvstore/kv/ns/app/a/b/c")
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"a/b/c", true},
+		{"a/*", true},
+		{"a/b/*", true},
+		{"a", false},
+		{"c", false},
+		{"a/b/c/d", false},
+	}
+	for _, tt := range tests {
+		if got := h.keyMatches(tt.pattern, key); got != tt.want {
+			t.Errorf("keyMatches(%q, %q) = %v, want %v", tt.pattern, key, got, tt.want)
+		}
+	}
+}
+
+func TestSetWebhookHeadersPrecedence(t *testing.T) {
+	h := &Handler{Config: &config.Config{WebhookDefaultHeaders: map[string]string{
+		"X-Env":         "prod",
+		"Authorization": "Bearer gateway-token",
+		"Content-Type":  "text/plain",
+	}}}
+	webhook := Webhook{Namespace: "ns", Headers: map[string]string{
+		"authorization": "Bearer webhook-token", // Header names are case-insensitive
+		"X-Extra":       "1",
+	}}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hook", nil)
+	if _, err := h.setWebhookHeaders(context.Background(), req, webhook, "req-1"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Authorization": "Bearer webhook-token", // The webhook's headers win over defaults
+		"X-Env":         "prod",                 // Defaults apply when the webhook sets nothing
+		"X-Extra":       "1",
+		"Content-Type":  "text/plain", // Defaults win over the standard headers
+		"X-Request-Id":  "req-1",
+	}
+	for name, value := range want {
+		if got := req.Header.Values(name); len(got) != 1 || got[0] != value {
+			t.Errorf("header %s = %q, want [%q]", name, got, value)
+		}
+	}
+
+	data, err := json.Marshal(webhook.public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "gateway-token") || strings.Contains(string(data), "X-Env") {
+		t.Errorf("public webhook %s contains default headers", data)
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+// valueFilter is a parsed webhook value_filter of the form path=value. path is a dot-separated
+// path into the JSON value, optionally starting with $., where numeric segments index arrays.
+type valueFilter struct {
+	path   []string
+	want   string
+	quoted bool // want was a quoted JSON string, which only matches strings
+}
+
+// parseValueFilter parses a value_filter such as status=failed, $.order.status="failed" or
+// items.0.count==3.
+func parseValueFilter(filter string) (valueFilter, error) {
+	path, want, ok := strings.Cut(filter, "=")
+	if !ok {
+		return valueFilter{}, errors.New("value_filter must have the form path=value")
+	}
+	want = strings.TrimSpace(strings.TrimPrefix(want, "="))
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return valueFilter{}, errors.New("value_filter path must not be empty")
+	}
+	segments := strings.Split(path, ".")
+	if slices.Contains(segments, "") {
+		return valueFilter{}, errors.New("value_filter path must not have empty segments")
+	}
+	// A quoted value is a JSON string, so "3" only matches the string and not the number
+	quoted := false
+	if unquoted, err := strconv.Unquote(want); err == nil && strings.HasPrefix(want, `"`) {
+		want, quoted = unquoted, true
+	}
+	return valueFilter{path: segments, want: want, quoted: quoted}, nil
+}
+
+// matches reports whether the value at the filter's path equals the wanted value. Strings are
+// compared as is, other values by their JSON encoding. Values that are not JSON, or that lack
+// the path, never match.
+func (f valueFilter) matches(value string) bool {
+	var current any
+	if err := json.Unmarshal([]byte(value), &current); err != nil {
+		return false
+	}
+	for _, segment := range f.path {
+		switch node := current.(type) {
+		case map[string]any:
+			var ok bool
+			if current, ok = node[segment]; !ok {
+				return false
+			}
+		case []any:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return false
+			}
+			current = node[i]
+		default:
+			return false
+		}
+	}
+	if s, ok := current.(string); ok {
+		return s == f.want
+	}
+	if f.quoted {
+		return false
+	}
+	encoded, err := json.Marshal(current)
+	return err == nil && string(encoded) == f.want
+}
+
+// parsedValueFilter returns the parsed value filter. Filters are parsed once, when the webhook
+// is registered or first matched, and cached.
+func (h *Handler) parsedValueFilter(filter string) (valueFilter, error) {
+	if parsed, ok := h.valueFilters.Load(filter); ok {
+		return parsed.(valueFilter), nil
+	}
+	parsed, err := parseValueFilter(filter)
+	if err != nil {
+		return valueFilter{}, err
+	}
+	h.valueFilters.Store(filter, parsed)
+	return parsed, nil
+}
+
+// valueFilterMatches reports whether a webhook fires for kvItem, the key's new value or, for
+// deletes and expirations, its last known value. Webhooks without a value filter always fire.
+func (h *Handler) valueFilterMatches(webhook Webhook, kvItem *store.KVItem) bool {
+	if webhook.ValueFilter == "" {
+		return true
+	}
+	if kvItem == nil {
+		return false
+	}
+	filter, err := h.parsedValueFilter(webhook.ValueFilter)
+	return err == nil && filter.matches(kvItem.Value)
+}
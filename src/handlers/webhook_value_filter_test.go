@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mrofi/simple-golang-kv/src/store"
+)
+
+func TestParseValueFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		valid  bool
+		path   []string
+		want   string
+	}{
+		{"status=failed", true, []string{"status"}, "failed"},
+		{"$.order.status=\"failed\"", true, []string{"order", "status"}, "failed"},
+		{"items.0.count==3", true, []string{"items", "0", "count"}, "3"},
+		{" status = failed ", true, []string{"status"}, "failed"},
+		{"count=\"3\"", true, []string{"count"}, "3"},
+		{"note=a=b", true, []string{"note"}, "a=b"},
+		{"status=", true, []string{"status"}, ""},
+		{"status", false, nil, ""},
+		{"=failed", false, nil, ""},
+		{"$=failed", false, nil, ""},
+		{"order..status=failed", false, nil, ""},
+		{"order.=failed", false, nil, ""},
+	}
+	for _, tt := range tests {
+		got, err := parseValueFilter(tt.filter)
+		if (err == nil) != tt.valid {
+			t.Errorf("parseValueFilter(%q) error = %v, want valid %v", tt.filter, err, tt.valid)
+			continue
+		}
+		if tt.valid && (!slices.Equal(got.path, tt.path) || got.want != tt.want) {
+			t.Errorf("parseValueFilter(%q) = %q, %q, want %q, %q", tt.filter, got.path, got.want, tt.path, tt.want)
+		}
+	}
+}
+
+func TestValueFilterMatches(t *testing.T) {
+	tests := []struct {
+		filter, value string
+		want          bool
+	}{
+		{"status=failed", `{"status":"failed"}`, true},
+		{"status=failed", `{"status":"ok"}`, false},
+		{"status=failed", `{"state":"failed"}`, false},
+		{"status=failed", "not json", false},
+		{"$.order.status=failed", `{"order":{"status":"failed"}}`, true},
+		{"items.1.count=3", `{"items":[{"count":1},{"count":3}]}`, true},
+		{"items.2.count=3", `{"items":[{"count":1},{"count":3}]}`, false},
+		{"items.x=3", `{"items":[1]}`, false},
+		// Quoting picks between a string and a number
+		{"count=3", `{"count":3}`, true},
+		{"count=\"3\"", `{"count":3}`, false},
+		{"count=\"3\"", `{"count":"3"}`, true},
+		{"done=true", `{"done":true}`, true},
+		{"done=null", `{"done":null}`, true},
+		{"tags=[\"a\"]", `{"tags":["a"]}`, true},
+		{"status.code=1", `{"status":"failed"}`, false},
+	}
+	for _, tt := range tests {
+		filter, err := parseValueFilter(tt.filter)
+		if err != nil {
+			t.Fatalf("parseValueFilter(%q): %v", tt.filter, err)
+		}
+		if got := filter.matches(tt.value); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.filter, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValueFilterMatchesWebhook(t *testing.T) {
+	item := &store.KVItem{Value: `{"status":"failed"}`}
+	tests := []struct {
+		name   string
+		filter string
+		item   *store.KVItem
+		want   bool
+	}{
+		{"no filter", "", item, true},
+		{"no filter, no value", "", nil, true},
+		{"matching", "status=failed", item, true},
+		{"not matching", "status=ok", item, false},
+		{"no value", "status=failed", nil, false},
+		{"invalid filter", "status", item, false},
+	}
+	h := &Handler{}
+	for _, tt := range tests {
+		if got := h.valueFilterMatches(Webhook{ValueFilter: tt.filter}, tt.item); got != tt.want {
+			t.Errorf("%s: valueFilterMatches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookMatchReasonValueFilter(t *testing.T) {
+	h := &Handler{}
+	enabled := true
+	webhook := Webhook{Key: "order", MatchType: matchTypeExact, Event: "update", Enabled: &enabled, ValueFilter: "status=failed"}
+	tests := []struct {
+		name  string
+		item  *store.KVItem
+		event WebhookEvent
+		want  string
+	}{
+		{"matching value", &store.KVItem{Value: `{"status":"failed"}`}, EventUpdate, matchReasonMatched},
+		{"other value", &store.KVItem{Value: `{"status":"ok"}`}, EventUpdate, matchReasonFilteredOut},
+		{"no value", nil, EventUpdate, matchReasonFilteredOut},
+		{"other event", &store.KVItem{Value: `{"status":"failed"}`}, EventCreate, matchReasonEventMismatch},
+	}
+	for _, tt := range tests {
+		if got := h.webhookMatchReason(webhook, "order", tt.event, tt.item, false); got != tt.want {
+			t.Errorf("%s: reason = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParsedValueFilterIsCached(t *testing.T) {
+	h := &Handler{}
+	if _, err := h.parsedValueFilter("status=failed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.valueFilters.Load("status=failed"); !ok {
+		t.Error("parsed filter was not cached")
+	}
+	if _, err := h.parsedValueFilter("status"); err == nil {
+		t.Error("invalid filter parsed")
+	}
+	if _, ok := h.valueFilters.Load("status"); ok {
+		t.Error("invalid filter was cached")
+	}
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -12,31 +15,62 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/mrofi/simple-golang-kv/src/config"
 	"github.com/mrofi/simple-golang-kv/src/handlers"
+	"github.com/mrofi/simple-golang-kv/src/middleware"
 	"github.com/mrofi/simple-golang-kv/src/routes"
 	"github.com/mrofi/simple-golang-kv/src/store"
+	"github.com/mrofi/simple-golang-kv/src/tracing"
 )
 
 func main() {
+	if err := config.AppConfig.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), config.AppConfig)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	e := echo.New()
 	e.HideBanner = true
 
 	store, err := store.NewStore()
 	if err != nil {
-		log.Fatalf("Failed to connect to etcd: %v", err)
+		log.Fatalf("Failed to create store: %v", err)
 	}
 	defer store.Close()
 
-	handler := handlers.NewHandler(store)
+	handler, err := handlers.NewHandler(store)
+	if err != nil {
+		log.Fatalf("Failed to create handler: %v", err)
+	}
 	routes.SetupRoutes(e, handler)
 
 	// Start watcher in background (only one pod will acquire the lock)
 	watcherCtx, watcherCancel := context.WithCancel(context.Background())
 	defer watcherCancel()
-	go handler.StartWatcher(watcherCtx)
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+		handler.StartWatcher(watcherCtx)
+	}()
+
+	tlsConfig, err := newServerTLSConfig(config.AppConfig)
+	if err != nil {
+		log.Fatalf("Failed to configure TLS: %v", err)
+	}
 
 	// Start server in a goroutine
 	go func() {
-		if err := e.Start(":" + config.AppConfig.Port); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsConfig != nil {
+			e.TLSServer.Addr = ":" + config.AppConfig.Port
+			e.TLSServer.TLSConfig = tlsConfig
+			err = e.StartServer(e.TLSServer)
+		} else {
+			err = e.Start(":" + config.AppConfig.Port)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			e.Logger.Fatal("shutting down the server:", err)
 		}
 	}()
@@ -48,11 +82,19 @@ func main() {
 
 	log.Println("Shutting down...")
 
-	// Step 1: Stop the watcher first (it's a background process)
+	// Step 1: Stop the watcher first (it's a background process) and wait for it to save its
+	// revision, unlock and close its session
 	watcherCancel()
-	// Give watcher a moment to clean up (unlock and close session)
-	time.Sleep(2000 * time.Millisecond)
-	log.Println("Watcher stopped")
+	select {
+	case <-watcherDone:
+		log.Println("Watcher stopped")
+	case <-time.After(config.AppConfig.WebhookDrainTimeout()):
+		log.Println("Watcher did not stop in time, continuing shutdown")
+	}
+
+	// Flush webhook deliveries started by the watcher, dead-lettering what doesn't finish in time
+	drained, abandoned := handler.DrainWebhooks(config.AppConfig.WebhookDrainTimeout())
+	log.Printf("Webhook deliveries: %d drained, %d abandoned and dead-lettered", drained, abandoned)
 
 	// Step 2: Shutdown Echo server (stop accepting new requests, wait for in-flight)
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -69,5 +111,52 @@ func main() {
 	}
 	log.Println("Store closed")
 
+	// Flush the spans of the last requests
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTracing()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		log.Printf("Error flushing traces: %v", err)
+	}
+
 	log.Println("Server gracefully shut down.")
 }
+
+// newServerTLSConfig builds the server TLS config, or returns nil if TLS is not configured.
+// When a client CA is set, client certificates are verified against it.
+func newServerTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		if cfg.IdentitySource == middleware.IdentitySourceCert {
+			return nil, errors.New("IDENTITY_SOURCE=cert requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.TLSClientCAFile != "" {
+		caCert, err := os.ReadFile(cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		if ok := caCertPool.AppendCertsFromPEM(caCert); !ok {
+			return nil, errors.New("failed to append client CA cert")
+		}
+		tlsConfig.ClientCAs = caCertPool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.IdentitySource == middleware.IdentitySourceCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if cfg.IdentitySource == middleware.IdentitySourceCert {
+		return nil, errors.New("IDENTITY_SOURCE=cert requires TLS_CLIENT_CA_FILE")
+	}
+
+	return tlsConfig, nil
+}
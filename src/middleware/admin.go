@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/config"
+)
+
+// adminPathPrefix is the prefix of the routes guarded by AdminAuth instead of APIKeyAuth.
+const adminPathPrefix = "/admin/"
+
+// isAdminPath reports whether a route is an admin route.
+func isAdminPath(path string) bool {
+	return strings.HasPrefix(path, adminPathPrefix)
+}
+
+// AdminAuth requires one of the ADMIN_API_KEYS, sent like any API key, on admin routes, which
+// cross namespace boundaries. With no admin keys configured, admin routes are disabled.
+func AdminAuth(cfg *config.Config) echo.MiddlewareFunc {
+	keys := make(map[[sha256.Size]byte]bool, len(cfg.AdminAPIKeys))
+	for _, key := range cfg.AdminAPIKeys {
+		if key != "" {
+			keys[sha256.Sum256([]byte(key))] = true
+		}
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if len(keys) == 0 {
+				return apierror.JSON(c, http.StatusForbidden, "Admin API is disabled")
+			}
+			key := requestAPIKey(c.Request())
+			if key == "" {
+				return apierror.JSON(c, http.StatusUnauthorized, "Admin API key required")
+			}
+			if !keys[sha256.Sum256([]byte(key))] {
+				return apierror.JSON(c, http.StatusForbidden, "Not an admin API key")
+			}
+			return next(c)
+		}
+	}
+}
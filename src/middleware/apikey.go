@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/config"
+)
+
+// apiKeyOpenPaths are reachable without an API key, so probes keep working and clients can
+// read the API documentation.
+var apiKeyOpenPaths = map[string]bool{
+	"/healthz":      true,
+	"/readyz":       true,
+	"/openapi.json": true,
+	"/docs":         true,
+}
+
+// readOnlyPostPaths are POST routes that only read, so read-only keys may use them.
+var readOnlyPostPaths = map[string]bool{
+	"/kv/multi-list":  true,
+	"/kv/batch-get":   true,
+	"/webhooks/match": true,
+}
+
+// apiKey is what an accepted API key may do.
+type apiKey struct {
+	namespaces map[string]bool // Namespaces the key works for, nil for all
+	readOnly   bool
+}
+
+// acceptedAPIKeyKey is the request context key of the SHA-256 of the API key APIKeyAuth accepted.
+type acceptedAPIKeyKey struct{}
+
+// acceptedAPIKey returns the SHA-256 of the API key APIKeyAuth accepted for a request, and
+// false if it accepted none.
+func acceptedAPIKey(ctx context.Context) ([sha256.Size]byte, bool) {
+	sum, ok := ctx.Value(acceptedAPIKeyKey{}).([sha256.Size]byte)
+	return sum, ok
+}
+
+// APIKeyAuth requires every request to carry one of the configured API keys, either as
+// "Authorization: Bearer <key>" or in the X-API-Key header. A key scoped to namespaces is
+// rejected for any other namespace, and a read-only key for anything but reads. It does
+// nothing when no keys are configured. Admin routes are left to AdminAuth.
+// It must run after CertIdentity so the namespace it checks is the final one.
+func APIKeyAuth(cfg *config.Config) echo.MiddlewareFunc {
+	// The keys were validated at startup, so this only fails if API_KEYS_FILE changed since
+	entries, err := cfg.LoadAPIKeys()
+	if err != nil {
+		log.Printf("Rejecting all requests, API keys could not be loaded: %v", err)
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				return apierror.JSON(c, http.StatusInternalServerError, "API keys could not be loaded")
+			}
+		}
+	}
+	keys := indexAPIKeys(entries)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if len(keys) == 0 {
+			return next
+		}
+		return func(c echo.Context) error {
+			if apiKeyOpenPaths[c.Path()] || isAdminPath(c.Path()) {
+				return next(c)
+			}
+			key := requestAPIKey(c.Request())
+			if key == "" {
+				return apierror.JSON(c, http.StatusUnauthorized, "API key required")
+			}
+			// Keys are looked up by hash so the lookup time does not depend on how much of a key matches
+			sum := sha256.Sum256([]byte(key))
+			allowed, ok := keys[sum]
+			if !ok {
+				return apierror.JSON(c, http.StatusUnauthorized, "Invalid API key")
+			}
+			if allowed.namespaces != nil {
+				namespace := c.Request().Header.Get(cfg.HeaderNamespace)
+				if namespace == "" {
+					namespace = cfg.DefaultNamespace
+				}
+				if !allowed.namespaces[namespace] {
+					return apierror.JSON(c, http.StatusForbidden, "API key is not allowed for this namespace")
+				}
+			}
+			if allowed.readOnly && !isReadRequest(c) {
+				return apierror.JSON(c, http.StatusForbidden, "API key is read-only")
+			}
+			req := c.Request()
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), acceptedAPIKeyKey{}, sum)))
+			return next(c)
+		}
+	}
+}
+
+// isReadRequest reports whether a request only reads, which read-only keys are limited to.
+func isReadRequest(c echo.Context) bool {
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return readOnlyPostPaths[c.Path()]
+	default:
+		return false
+	}
+}
+
+// indexAPIKeys indexes API keys by the SHA-256 of the key.
+func indexAPIKeys(entries []config.APIKey) map[[sha256.Size]byte]apiKey {
+	keys := make(map[[sha256.Size]byte]apiKey, len(entries))
+	for _, entry := range entries {
+		key := apiKey{readOnly: entry.Scope == config.APIKeyScopeReadOnly}
+		if len(entry.Namespaces) > 0 {
+			key.namespaces = make(map[string]bool, len(entry.Namespaces))
+			for _, namespace := range entry.Namespaces {
+				key.namespaces[namespace] = true
+			}
+		}
+		keys[sha256.Sum256([]byte(entry.Key))] = key
+	}
+	return keys
+}
+
+// requestAPIKey returns the API key sent with a request, or "" if there is none.
+func requestAPIKey(req *http.Request) string {
+	if key := req.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(req.Header.Get(echo.HeaderAuthorization), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/mrofi/simple-golang-kv/src/config"
+)
+
+// corsExposeHeaders are the response headers browsers let scripts read, besides the safelisted ones.
+var corsExposeHeaders = []string{"ETag", "Retry-After", HeaderRequestID}
+
+// CORS lets browser apps on CORS_ALLOWED_ORIGINS call the API. Preflight requests are answered
+// here, before API key auth, since browsers send them without credentials. The namespace and
+// app headers are always allowed. With no allowed origins, CORS headers are never sent and
+// browsers keep blocking cross-origin requests.
+func CORS(cfg *config.Config) echo.MiddlewareFunc {
+	if len(cfg.CORSAllowedOrigins) == 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+	headers := slices.Clone(cfg.CORSAllowedHeaders)
+	for _, header := range []string{cfg.HeaderNamespace, cfg.HeaderAppName} {
+		if !slices.Contains(headers, header) {
+			headers = append(headers, header)
+		}
+	}
+	return echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
+		AllowOrigins:     cfg.CORSAllowedOrigins,
+		AllowMethods:     cfg.CORSAllowedMethods,
+		AllowHeaders:     headers,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		ExposeHeaders:    corsExposeHeaders,
+		MaxAge:           cfg.CORSMaxAgeSeconds,
+	})
+}
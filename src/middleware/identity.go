@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/config"
+)
+
+// Identity sources
+const (
+	IdentitySourceHeader = "header" // Namespace/app come from request headers only
+	IdentitySourceCert   = "cert"   // Namespace/app come from the verified client certificate
+)
+
+// CertIdentity derives namespace and app name from the verified TLS client certificate.
+// Derived values are written to the namespace/app headers so handlers pick them up as usual.
+// Requests whose headers conflict with the certificate identity are rejected.
+func CertIdentity(cfg *config.Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if cfg.IdentitySource != IdentitySourceCert {
+			return next
+		}
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+				return apierror.JSON(c, http.StatusUnauthorized, "Verified client certificate required")
+			}
+			cert := req.TLS.VerifiedChains[0][0]
+
+			if err := applyCertIdentity(c, cert, cfg.IdentityCertNamespaceField, cfg.HeaderNamespace, "Namespace"); err != nil {
+				return err
+			}
+			if err := applyCertIdentity(c, cert, cfg.IdentityCertAppNameField, cfg.HeaderAppName, "App name"); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// applyCertIdentity sets header to the value of the certificate field, rejecting conflicting values.
+// An empty field leaves the header untouched, so it can still be supplied by the client.
+func applyCertIdentity(c echo.Context, cert *x509.Certificate, field, header, label string) error {
+	if field == "" {
+		return nil
+	}
+	value := certField(cert, field)
+	if value == "" {
+		return apierror.JSON(c, http.StatusForbidden, label+" not present in client certificate")
+	}
+	if current := c.Request().Header.Get(header); current != "" && current != value {
+		return apierror.JSON(c, http.StatusForbidden, label+" conflicts with client certificate")
+	}
+	c.Request().Header.Set(header, value)
+	return nil
+}
+
+// certField returns the first value of a certificate subject field or SAN.
+// Supported fields: CN, O, OU, DNS, EMAIL, URI.
+func certField(cert *x509.Certificate, field string) string {
+	first := func(values []string) string {
+		if len(values) == 0 {
+			return ""
+		}
+		return values[0]
+	}
+	switch strings.ToUpper(field) {
+	case "CN":
+		return cert.Subject.CommonName
+	case "O":
+		return first(cert.Subject.Organization)
+	case "OU":
+		return first(cert.Subject.OrganizationalUnit)
+	case "DNS":
+		return first(cert.DNSNames)
+	case "EMAIL":
+		return first(cert.EmailAddresses)
+	case "URI":
+		if len(cert.URIs) == 0 {
+			return ""
+		}
+		return cert.URIs[0].String()
+	default:
+		return ""
+	}
+}
+
+// checkSiloName returns why a namespace or app name, named by label, is invalid, or "" if it is
+// valid. Slashes would let a name reach into another silo's etcd keys, as they separate the
+// namespace, the app name and what follows.
+func checkSiloName(name string, maxLen int, label string) string {
+	if len(name) > maxLen {
+		return fmt.Sprintf("%s too long (max %d characters)", label, maxLen)
+	}
+	if strings.Contains(name, "/") {
+		return label + " must not contain /"
+	}
+	return ""
+}
+
+// ValidateIdentity rejects requests whose namespace or app name, as sent or defaulted, is too
+// long or contains a slash, before any handler builds etcd keys from them. Admin routes, which
+// take no namespace from headers, and open routes are left alone.
+// It must run after CertIdentity so the names it checks are the final ones.
+func ValidateIdentity(cfg *config.Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if apiKeyOpenPaths[c.Path()] || isAdminPath(c.Path()) {
+				return next(c)
+			}
+			namespace := c.Request().Header.Get(cfg.HeaderNamespace)
+			if namespace == "" {
+				namespace = cfg.DefaultNamespace
+			}
+			appName := c.Request().Header.Get(cfg.HeaderAppName)
+			if appName == "" {
+				appName = cfg.DefaultAppName
+			}
+			if msg := checkSiloName(namespace, cfg.MaxNamespaceLen, "Namespace"); msg != "" {
+				return apierror.JSON(c, http.StatusBadRequest, msg)
+			}
+			if msg := checkSiloName(appName, cfg.MaxAppNameLen, "App name"); msg != "" {
+				return apierror.JSON(c, http.StatusBadRequest, msg)
+			}
+			return next(c)
+		}
+	}
+}
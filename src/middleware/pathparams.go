@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+)
+
+// UnescapePathParams decodes percent-encoded path parameters. Echo matches routes on the raw
+// path when the request path holds escapes that decoding would lose, such as %2F, and leaves
+// the parameters encoded, so a key sent as config%2Fdb%2Fhost would not reach handlers as
+// config/db/host. Parameters of other requests are already decoded and are left alone.
+func UnescapePathParams() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().URL.RawPath == "" {
+				return next(c)
+			}
+			values := c.ParamValues()
+			for i, value := range values {
+				if unescaped, err := url.PathUnescape(value); err == nil {
+					values[i] = unescaped
+				}
+			}
+			c.SetParamValues(values...)
+			return next(c)
+		}
+	}
+}
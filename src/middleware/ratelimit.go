@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
+	"github.com/mrofi/simple-golang-kv/src/config"
+)
+
+// rateLimitSweepInterval is how often buckets that have refilled are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// tokenBucket holds the tokens left for one client, as of last.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is an in-memory token bucket per client. Each pod limits on its own, so the
+// effective limit across a deployment is the configured one times the number of pods.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // Tokens added per second
+	burst     float64 // Bucket capacity
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// allow takes a token from the client's bucket. If the bucket is empty, it returns false and
+// how long until a token is available.
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that are full again, since a new bucket starts full anyway.
+func (l *rateLimiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// RateLimit limits each client to RATE_LIMIT_RPS requests per second with bursts of up to
+// RATE_LIMIT_BURST, answering 429 with Retry-After beyond that. Clients are told apart by
+// the API key APIKeyAuth accepted, and by namespace/app otherwise. It must run after
+// APIKeyAuth. It does nothing when RATE_LIMIT_RPS is 0.
+func RateLimit(cfg *config.Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if cfg.RateLimitRPS <= 0 {
+			return next
+		}
+		burst := cfg.RateLimitBurst
+		if burst <= 0 {
+			burst = cfg.RateLimitRPS
+		}
+		limiter := &rateLimiter{
+			rate:    float64(cfg.RateLimitRPS),
+			burst:   float64(burst),
+			buckets: make(map[string]*tokenBucket),
+		}
+		return func(c echo.Context) error {
+			if apiKeyOpenPaths[c.Path()] {
+				return next(c)
+			}
+			allowed, wait := limiter.allow(rateLimitClient(c, cfg), time.Now())
+			if !allowed {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				return apierror.JSON(c, http.StatusTooManyRequests, "Rate limit exceeded")
+			}
+			return next(c)
+		}
+	}
+}
+
+// rateLimitClient returns the bucket key of a request. Keys nobody checked, such as any key
+// while API_KEYS is unset, are ignored, or a client could get a fresh bucket per request by
+// sending a new one each time.
+func rateLimitClient(c echo.Context, cfg *config.Config) string {
+	if sum, ok := acceptedAPIKey(c.Request().Context()); ok {
+		return "key:" + hex.EncodeToString(sum[:])
+	}
+	namespace := c.Request().Header.Get(cfg.HeaderNamespace)
+	if namespace == "" {
+		namespace = cfg.DefaultNamespace
+	}
+	appName := c.Request().Header.Get(cfg.HeaderAppName)
+	if appName == "" {
+		appName = cfg.DefaultAppName
+	}
+	return "app:" + namespace + "/" + appName
+}
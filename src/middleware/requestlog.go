@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/config"
+)
+
+// HeaderRequestID carries the ID of a request, in the response and in webhook deliveries.
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLen bounds client-supplied request IDs, longer ones are replaced.
+const maxRequestIDLen = 128
+
+// Request log levels
+const (
+	LogLevelInfo  = "info"  // Log every request
+	LogLevelWarn  = "warn"  // Log 4xx and 5xx responses
+	LogLevelError = "error" // Log 5xx responses
+)
+
+var logLevelRank = map[string]int{LogLevelInfo: 0, LogLevelWarn: 1, LogLevelError: 2}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID stored by RequestLog, or "" if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogEntry is one line of the request log.
+type requestLogEntry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	RequestID string `json:"request_id"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Status    int    `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Namespace string `json:"namespace"`
+	App       string `json:"app"`
+	RemoteIP  string `json:"remote_ip"`
+	BytesOut  int64  `json:"bytes_out"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RequestLog assigns every request an ID, returned in X-Request-ID and available to handlers
+// through the request context, and logs requests at or above REQUEST_LOG_LEVEL as JSON lines
+// on stdout. A valid X-Request-ID sent by the client is kept. It does nothing unless
+// REQUEST_LOG is enabled. It must be the first middleware so it sees every response.
+func RequestLog(cfg *config.Config) echo.MiddlewareFunc {
+	out := log.New(os.Stdout, "", 0)
+	minRank := logLevelRank[cfg.RequestLogLevel]
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if !cfg.RequestLog {
+			return next
+		}
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+			id := req.Header.Get(HeaderRequestID)
+			if !validRequestID(id) {
+				id = uuid.New().String()
+			}
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id)))
+			c.Response().Header().Set(HeaderRequestID, id)
+
+			err := next(c)
+			if err != nil {
+				// Let Echo write the error now so the logged status is the one sent
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			level := LogLevelInfo
+			switch {
+			case status >= 500:
+				level = LogLevelError
+			case status >= 400:
+				level = LogLevelWarn
+			}
+			if logLevelRank[level] < minRank {
+				return nil
+			}
+			entry := requestLogEntry{
+				Time:      start.UTC().Format(time.RFC3339Nano),
+				Level:     level,
+				RequestID: id,
+				Method:    req.Method,
+				Path:      req.URL.Path,
+				Status:    status,
+				LatencyMs: time.Since(start).Milliseconds(),
+				Namespace: valueOr(req.Header.Get(cfg.HeaderNamespace), cfg.DefaultNamespace),
+				App:       valueOr(req.Header.Get(cfg.HeaderAppName), cfg.DefaultAppName),
+				RemoteIP:  c.RealIP(),
+				BytesOut:  c.Response().Size,
+			}
+			if err != nil {
+				entry.Error = err.Error()
+			}
+			if data, err := json.Marshal(entry); err == nil {
+				out.Println(string(data))
+			}
+			return nil
+		}
+	}
+}
+
+// validRequestID reports whether a client-supplied request ID can be reused: non-empty,
+// bounded and printable ASCII, so it is safe to echo in headers and logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// valueOr returns value, or fallback if value is empty.
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/config"
+	"github.com/mrofi/simple-golang-kv/src/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for every request, continuing the trace of the caller when the
+// request carries W3C trace context headers. The span is stored in the request context, so
+// store operations and blocking webhook deliveries become its children. It must come before
+// the other middleware so their time is part of the span.
+func Tracing(cfg *config.Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := tracing.Start(ctx, req.Method+" "+c.Path(),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", req.Method),
+					attribute.String("http.route", c.Path()),
+					attribute.String("url.path", req.URL.Path),
+				))
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			if err := next(c); err != nil {
+				// Let Echo write the error now so the span records the status sent
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(
+				attribute.Int("http.response.status_code", status),
+				attribute.String("kv.namespace", valueOr(req.Header.Get(cfg.HeaderNamespace), cfg.DefaultNamespace)),
+				attribute.String("kv.app", valueOr(req.Header.Get(cfg.HeaderAppName), cfg.DefaultAppName)),
+			)
+			if status >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package redact
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mrofi/simple-golang-kv/src/config"
+)
+
+// Placeholder replaces redacted values.
+const Placeholder = "[REDACTED]"
+
+// Redactor decides which values must not appear in logs and error messages.
+// A value is sensitive if its key matches one of the key patterns, or if its
+// namespace is one whose values are always redacted.
+type Redactor struct {
+	keyPatterns []string
+	namespaces  []string
+}
+
+// New creates a Redactor. Key patterns are case-insensitive globs where * matches
+// any run of characters, including /.
+func New(keyPatterns, namespaces []string) *Redactor {
+	patterns := make([]string, 0, len(keyPatterns))
+	for _, pattern := range keyPatterns {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, strings.ToLower(pattern))
+		}
+	}
+	return &Redactor{keyPatterns: patterns, namespaces: namespaces}
+}
+
+// NewFromConfig creates a Redactor from REDACT_KEY_PATTERNS and REDACT_NAMESPACES.
+func NewFromConfig(cfg *config.Config) *Redactor {
+	return New(cfg.RedactKeyPatterns, cfg.RedactNamespaces)
+}
+
+// IsSensitive reports whether the value of key in namespace must be redacted.
+func (r *Redactor) IsSensitive(namespace, key string) bool {
+	if slices.Contains(r.namespaces, namespace) {
+		return true
+	}
+	key = strings.ToLower(key)
+	for _, pattern := range r.keyPatterns {
+		if globMatch(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns value, or the placeholder if the key is sensitive.
+func (r *Redactor) Value(namespace, key, value string) string {
+	if r.IsSensitive(namespace, key) {
+		return Placeholder
+	}
+	return value
+}
+
+// Secrets replaces every occurrence of the given secret values in s with the placeholder.
+// Use it on error messages that may embed values, such as a URL with a resolved secret.
+func Secrets(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, Placeholder)
+		}
+	}
+	return s
+}
+
+// globMatch reports whether s matches pattern, where * matches any run of characters.
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
@@ -1,23 +1,97 @@
 package routes
 
 import (
+	"expvar"
+
 	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/apierror"
 	"github.com/mrofi/simple-golang-kv/src/handlers"
+	"github.com/mrofi/simple-golang-kv/src/middleware"
 )
 
 const routeKVWithKey = "/kv/:key"
 const routeWebhookWithID = "/webhooks/:id"
+const routeLeaseWithID = "/leases/:id"
 
 // SetupRoutes registers the key-value handlers with the Echo instance.
 func SetupRoutes(e *echo.Echo, h *handlers.Handler) {
+	e.HTTPErrorHandler = apierror.HTTPErrorHandler
+
+	e.Use(middleware.Tracing(h.Config))
+	e.Use(middleware.RequestLog(h.Config))
+	e.Use(middleware.CORS(h.Config))
+	e.Use(middleware.UnescapePathParams())
+	e.Use(middleware.CertIdentity(h.Config))
+	e.Use(middleware.ValidateIdentity(h.Config))
+	e.Use(middleware.APIKeyAuth(h.Config))
+	e.Use(middleware.RateLimit(h.Config))
+
+	// Health routes
+	e.GET("/healthz", h.Healthz)
+	e.GET("/readyz", h.Readyz)
+
+	// API documentation
+	e.GET("/openapi.json", h.GetOpenAPISpec)
+	e.GET("/docs", h.GetDocs)
+
 	e.POST("/kv", h.CreateKeyValue)
+	e.GET("/kv", h.ExportKeyValues)
+	e.DELETE("/kv", h.DeleteKeyValuesByPrefix)
+	e.POST("/kv/multi-list", h.MultiListKeyValues)
+	e.POST("/kv/bulk-cas", h.BulkCompareAndSwap)
+	e.POST("/kv/batch-get", h.BatchGetKeyValues)
+	e.POST("/kv/batch", h.BatchKeyValues)
 	e.GET(routeKVWithKey, h.GetKeyValue)
+	e.HEAD(routeKVWithKey, h.HeadKeyValue)
 	e.PUT(routeKVWithKey, h.UpdateKeyValue)
 	e.DELETE(routeKVWithKey, h.DeleteKeyValue)
+	e.PATCH("/kv/ttl", h.RefreshTTLForPrefix)
+	e.PATCH(routeKVWithKey+"/ttl", h.SetKeyTTL)
+	e.POST(routeKVWithKey+"/touch", h.TouchKeyValue)
+	e.POST(routeKVWithKey+"/rollback", h.RollbackKeyValue)
+
+	e.GET("/keys", h.ListKeys)
+	e.GET("/keys/count", h.CountKeys)
+	e.GET("/scan", h.ScanKeyValues)
+	e.GET("/snapshot", h.GetSnapshot)
+	e.GET("/export", h.DumpKeyValues)
+	e.POST("/import", h.ImportKeyValues)
+	e.GET("/subscribe", h.Subscribe)
+
+	// Counter routes
+	e.POST(routeKVWithKey+"/increment", h.IncrementKeyValue)
+	e.POST(routeKVWithKey+"/decrement", h.DecrementKeyValue)
+
+	// Lock routes
+	e.POST(routeKVWithKey+"/acquire", h.AcquireLock)
+	e.POST(routeKVWithKey+"/release", h.ReleaseLock)
+
+	// Lease routes
+	e.POST("/leases", h.GrantLease)
+	e.GET(routeLeaseWithID, h.GetLease)
+	e.PUT(routeLeaseWithID+"/keepalive", h.KeepAliveLease)
+	e.DELETE(routeLeaseWithID, h.RevokeLease)
 
 	// Webhook routes
 	e.POST("/webhooks", h.RegisterWebhook)
+	e.POST("/webhooks/batch", h.RegisterWebhooks)
+	e.GET("/webhooks", h.ListWebhooks)
+	e.POST("/webhooks/match", h.MatchWebhooks)
 	e.GET(routeWebhookWithID, h.GetWebhook)
 	e.PUT(routeWebhookWithID, h.UpdateWebhook)
 	e.DELETE(routeWebhookWithID, h.DeleteWebhook)
+	e.POST(routeWebhookWithID+"/test", h.TestWebhook)
+	e.GET(routeWebhookWithID+"/deliveries", h.GetWebhookDeliveries)
+	e.POST(routeWebhookWithID+"/pause", h.PauseWebhook)
+	e.POST(routeWebhookWithID+"/resume", h.ResumeWebhook)
+	e.POST(routeWebhookWithID+"/disable", h.PauseWebhook)
+	e.POST(routeWebhookWithID+"/enable", h.ResumeWebhook)
+
+	// Admin routes, across namespaces
+	admin := e.Group("/admin", middleware.AdminAuth(h.Config))
+	admin.GET("/namespaces", h.ListNamespaces)
+	admin.POST("/namespaces/:namespace/webhooks/pause", h.PauseNamespaceWebhooks)
+	admin.POST("/namespaces/:namespace/webhooks/resume", h.ResumeNamespaceWebhooks)
+	admin.GET("/watcher/status", h.GetWatcherStatus)
+	admin.GET("/debug/vars", echo.WrapHandler(expvar.Handler()))
 }
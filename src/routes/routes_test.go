@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mrofi/simple-golang-kv/src/config"
+	"github.com/mrofi/simple-golang-kv/src/handlers"
+)
+
+func TestInvalidNamespaceAndAppNameRejectedOnEveryRoute(t *testing.T) {
+	cfg := config.NewConfig()
+	e := echo.New()
+	// Requests are rejected before any handler touches the store
+	SetupRoutes(e, &handlers.Handler{Config: cfg})
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodGet, "/webhooks", ""},
+		{http.MethodPost, "/webhooks", `{"key":"k","event":"create","endpoint":"https://example.com"}`},
+		{http.MethodGet, "/webhooks/id/deliveries", ""},
+		{http.MethodPost, "/webhooks/id/pause", ""},
+		{http.MethodPost, "/leases", `{"ttl":60}`},
+		{http.MethodGet, "/kv/key", ""},
+	}
+	headers := []struct {
+		name, namespace, appName string
+	}{
+		{"app with slash", "a", "b/c"},
+		{"namespace with slash", "a/b", "c"},
+		{"namespace too long", strings.Repeat("n", cfg.MaxNamespaceLen+1), "c"},
+		{"app name too long", "a", strings.Repeat("a", cfg.MaxAppNameLen+1)},
+	}
+	for _, r := range requests {
+		for _, hdr := range headers {
+			req := httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(cfg.HeaderNamespace, hdr.namespace)
+			req.Header.Set(cfg.HeaderAppName, hdr.appName)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s %s with %s: status = %d, want 400", r.method, r.path, hdr.name, rec.Code)
+			}
+		}
+	}
+}
+
+func TestNamespaceWebhookPauseNeedsAdminKey(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.AdminAPIKeys = []string{"admin-key"}
+	e := echo.New()
+	SetupRoutes(e, &handlers.Handler{Config: cfg})
+
+	requests := []struct {
+		name, path, apiKey string
+		want               int
+	}{
+		{"no key", "/admin/namespaces/ns/webhooks/pause", "", http.StatusUnauthorized},
+		{"tenant key", "/admin/namespaces/ns/webhooks/resume", "tenant-key", http.StatusForbidden},
+		{"namespace with slash", "/admin/namespaces/a%2Fb/webhooks/pause", "admin-key", http.StatusBadRequest},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(http.MethodPost, r.path, nil)
+		if r.apiKey != "" {
+			req.Header.Set("X-API-Key", r.apiKey)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != r.want {
+			t.Errorf("%s: status = %d, want %d", r.name, rec.Code, r.want)
+		}
+	}
+}
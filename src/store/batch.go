@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// BatchOp is one operation of a batch: Item is stored, or its key deleted if Delete is set.
+type BatchOp struct {
+	Item   *KVItem
+	Delete bool
+}
+
+// Batch applies all operations in a single etcd transaction, so either all of them take
+// effect or none does. It returns the revision of the write and, for each operation, the
+// key's value before the batch, nil if it did not exist.
+func (s *Store) Batch(ctx context.Context, ops []BatchOp) (int64, []*KVItem, error) {
+	txnOps := make([]clientv3.Op, 0, len(ops))
+	var written []*KVItem
+	for _, op := range ops {
+		if op.Delete {
+			txnOps = append(txnOps, clientv3.OpDelete(op.Item.Key, clientv3.WithPrevKV()))
+			continue
+		}
+		opts := []clientv3.OpOption{clientv3.WithPrevKV()}
+		if op.Item.LeaseID != 0 {
+			opts = append(opts, clientv3.WithLease(clientv3.LeaseID(op.Item.LeaseID)))
+		}
+		txnOps = append(txnOps, clientv3.OpPut(op.Item.Key, s.encodeValue(op.Item), opts...))
+		written = append(written, op.Item)
+	}
+	txnOps = append(txnOps, s.requestIDOps(ctx, written...)...)
+	resp, err := s.client.Txn(ctx).Then(txnOps...).Commit()
+	if err != nil {
+		return 0, nil, err
+	}
+	prev := make([]*KVItem, len(ops))
+	for i, r := range resp.Responses[:len(ops)] {
+		if del := r.GetResponseDeleteRange(); del != nil && len(del.PrevKvs) > 0 {
+			prev[i] = s.prevKVItem(del.PrevKvs[0])
+		} else if put := r.GetResponsePut(); put != nil {
+			prev[i] = s.prevKVItem(put.PrevKv)
+		}
+	}
+	return resp.Header.Revision, prev, nil
+}
+
+// prevKVItem decodes the previous value etcd returns for a write with WithPrevKV, or returns
+// nil if the key did not exist. The lease's TTL is not looked up.
+func (s *Store) prevKVItem(kv *mvccpb.KeyValue) *KVItem {
+	if kv == nil {
+		return nil
+	}
+	item := s.DecodeKVItem(string(kv.Key), kv.Value)
+	item.Revision = kv.ModRevision
+	item.Created = kv.CreateRevision
+	item.Version = kv.Version
+	item.LeaseID = kv.Lease
+	return item
+}
+
+// SetMany stores all items in a single etcd transaction, each attached to its LeaseID (0 for no lease).
+func (s *Store) SetMany(ctx context.Context, items []KVItem) error {
+	ops := make([]BatchOp, 0, len(items))
+	for i := range items {
+		ops = append(ops, BatchOp{Item: &items[i]})
+	}
+	_, _, err := s.Batch(ctx, ops)
+	return err
+}
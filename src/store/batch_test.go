@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBatchReturnsPreviousValues(t *testing.T) {
+	s, prefix := newTestStore(t)
+	ctx := context.Background()
+	if err := s.Set(ctx, prefix+"updated", "old", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(ctx, prefix+"deleted", "gone", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	_, prev, err := s.Batch(ctx, []BatchOp{
+		{Item: &KVItem{Key: prefix + "created", Value: "new"}},
+		{Item: &KVItem{Key: prefix + "updated", Value: "new"}},
+		{Item: &KVItem{Key: prefix + "deleted"}, Delete: true},
+		{Item: &KVItem{Key: prefix + "absent"}, Delete: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "old", "gone", ""}
+	for i, value := range want {
+		switch {
+		case value == "" && prev[i] != nil:
+			t.Errorf("op %d: previous value %q, want none", i, prev[i].Value)
+		case value != "" && (prev[i] == nil || prev[i].Value != value):
+			t.Errorf("op %d: previous value %+v, want %q", i, prev[i], value)
+		}
+	}
+}
+
+func TestBulkCASReturnsPreviousValues(t *testing.T) {
+	s, prefix := newTestStore(t)
+	ctx := context.Background()
+	if err := s.Set(ctx, prefix+"updated", "old", 0); err != nil {
+		t.Fatal(err)
+	}
+	current, _, err := s.Get(ctx, prefix+"updated")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, prev, failures, err := s.BulkCAS(ctx, []CASItem{
+		{Item: &KVItem{Key: prefix + "created", Value: "new"}},
+		{Item: &KVItem{Key: prefix + "updated", Value: "new"}, ExpectedRevision: current.Revision},
+	})
+	if err != nil || len(failures) > 0 {
+		t.Fatalf("BulkCAS = %v, %v", failures, err)
+	}
+	if prev[0] != nil {
+		t.Errorf("created key has previous value %q", prev[0].Value)
+	}
+	if prev[1] == nil || prev[1].Value != "old" || prev[1].Revision != current.Revision {
+		t.Errorf("updated key has previous value %+v, want old at revision %d", prev[1], current.Revision)
+	}
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// CASItem is a conditional write: Item is stored only if the key's current mod revision
+// equals ExpectedRevision, where 0 means the key must not exist.
+type CASItem struct {
+	Item             *KVItem
+	ExpectedRevision int64
+}
+
+// CASFailure describes a key whose revision did not match the expected one.
+type CASFailure struct {
+	Key              string
+	ExpectedRevision int64
+	CurrentRevision  int64 // 0 if the key does not exist
+}
+
+// BulkCAS writes all items in a single etcd transaction, only if every item's expected
+// revision holds. On success it returns the revision of the write and each key's previous
+// value, nil if it did not exist; otherwise nothing is written and the keys whose revision
+// did not match are returned.
+func (s *Store) BulkCAS(ctx context.Context, items []CASItem) (int64, []*KVItem, []CASFailure, error) {
+	cmps := make([]clientv3.Cmp, 0, len(items))
+	puts := make([]clientv3.Op, 0, len(items))
+	gets := make([]clientv3.Op, 0, len(items))
+	written := make([]*KVItem, 0, len(items))
+	for _, cas := range items {
+		key := cas.Item.Key
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(key), "=", cas.ExpectedRevision))
+		opts := []clientv3.OpOption{clientv3.WithPrevKV()}
+		if cas.Item.LeaseID != 0 {
+			opts = append(opts, clientv3.WithLease(clientv3.LeaseID(cas.Item.LeaseID)))
+		}
+		puts = append(puts, clientv3.OpPut(key, s.encodeValue(cas.Item), opts...))
+		gets = append(gets, clientv3.OpGet(key, clientv3.WithKeysOnly()))
+		written = append(written, cas.Item)
+	}
+	puts = append(puts, s.requestIDOps(ctx, written...)...)
+
+	resp, err := s.client.Txn(ctx).If(cmps...).Then(puts...).Else(gets...).Commit()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if resp.Succeeded {
+		prev := make([]*KVItem, len(items))
+		for i, r := range resp.Responses[:len(items)] {
+			prev[i] = s.prevKVItem(r.GetResponsePut().PrevKv)
+		}
+		return resp.Header.Revision, prev, nil, nil
+	}
+
+	var failures []CASFailure
+	for i, cas := range items {
+		var current int64
+		if kvs := resp.Responses[i].GetResponseRange().Kvs; len(kvs) > 0 {
+			current = kvs[0].ModRevision
+		}
+		if current != cas.ExpectedRevision {
+			failures = append(failures, CASFailure{
+				Key:              cas.Item.Key,
+				ExpectedRevision: cas.ExpectedRevision,
+				CurrentRevision:  current,
+			})
+		}
+	}
+	return 0, nil, failures, nil
+}
+
+// CompareAndSwap writes newValue to key only if its current value equals expected, attaching it
+// to a new lease if ttl > 0. It returns false, not an error, if the key is missing or its value
+// differs, so callers can re-read and retry.
+func (s *Store) CompareAndSwap(ctx context.Context, key, expected, newValue string, ttl int64) (bool, error) {
+	item := &KVItem{Key: key, Value: newValue}
+	if ttl > 0 {
+		leaseID, err := s.Grant(ctx, ttl)
+		if err != nil {
+			return false, err
+		}
+		item.LeaseID = leaseID
+	}
+	_, swapped, err := s.CompareAndSwapItem(ctx, item, expected)
+	if !swapped && item.LeaseID != 0 {
+		s.client.Revoke(context.WithoutCancel(ctx), clientv3.LeaseID(item.LeaseID))
+	}
+	return swapped, err
+}
+
+// CompareAndSwapItem stores item only if the current value of its key equals expected.
+// Values are compared after unwrapping their metadata envelope, and the write is guarded by
+// comparing the exact stored bytes, so a concurrent change in between makes it fail.
+// It returns the value replaced if the swap happened.
+func (s *Store) CompareAndSwapItem(ctx context.Context, item *KVItem, expected string) (*KVItem, bool, error) {
+	resp, err := s.client.Get(ctx, item.Key)
+	if err != nil || len(resp.Kvs) == 0 {
+		return nil, false, err
+	}
+	raw := resp.Kvs[0].Value
+	if s.DecodeKVItem(item.Key, raw).Value != expected {
+		return nil, false, nil
+	}
+
+	opts := []clientv3.OpOption{clientv3.WithPrevKV()}
+	if item.LeaseID != 0 {
+		opts = append(opts, clientv3.WithLease(clientv3.LeaseID(item.LeaseID)))
+	}
+	txnResp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(item.Key), "=", string(raw))).
+		Then(append([]clientv3.Op{clientv3.OpPut(item.Key, s.encodeValue(item), opts...)}, s.requestIDOps(ctx, item)...)...).
+		Commit()
+	if err != nil || !txnResp.Succeeded {
+		return nil, false, err
+	}
+	return s.prevKVItem(txnResp.Responses[0].GetResponsePut().PrevKv), true, nil
+}
+
+// CompareAndSwapRevision stores item only if the mod revision of its key equals rev.
+// It returns false, not an error, if the key is missing or was written since, and the value
+// replaced otherwise.
+func (s *Store) CompareAndSwapRevision(ctx context.Context, item *KVItem, rev int64) (*KVItem, bool, error) {
+	opts := []clientv3.OpOption{clientv3.WithPrevKV()}
+	if item.LeaseID != 0 {
+		opts = append(opts, clientv3.WithLease(clientv3.LeaseID(item.LeaseID)))
+	}
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(item.Key), "=", rev)).
+		Then(append([]clientv3.Op{clientv3.OpPut(item.Key, s.encodeValue(item), opts...)}, s.requestIDOps(ctx, item)...)...).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		return nil, false, err
+	}
+	return s.prevKVItem(resp.Responses[0].GetResponsePut().PrevKv), true, nil
+}
+
+// DeleteIfMatch deletes key only if its current value equals expected, comparing values like
+// CompareAndSwapItem. It returns false, not an error, if the key is missing or its value differs,
+// and the value deleted otherwise.
+func (s *Store) DeleteIfMatch(ctx context.Context, key, expected string) (*KVItem, bool, error) {
+	resp, err := s.client.Get(ctx, key)
+	if err != nil || len(resp.Kvs) == 0 {
+		return nil, false, err
+	}
+	raw := resp.Kvs[0].Value
+	if s.DecodeKVItem(key, raw).Value != expected {
+		return nil, false, nil
+	}
+	txnResp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(key), "=", string(raw))).
+		Then(clientv3.OpDelete(key, clientv3.WithPrevKV())).
+		Commit()
+	if err != nil || !txnResp.Succeeded {
+		return nil, false, err
+	}
+	return s.deletedKVItem(txnResp), true, nil
+}
+
+// DeleteIfRevision deletes key only if its mod revision equals rev.
+// It returns false, not an error, if the key is missing or was written since, and the value
+// deleted otherwise.
+func (s *Store) DeleteIfRevision(ctx context.Context, key string, rev int64) (*KVItem, bool, error) {
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+		Then(clientv3.OpDelete(key, clientv3.WithPrevKV())).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		return nil, false, err
+	}
+	return s.deletedKVItem(resp), true, nil
+}
+
+// deletedKVItem returns the value removed by the single delete of a successful transaction.
+func (s *Store) deletedKVItem(resp *clientv3.TxnResponse) *KVItem {
+	if prev := resp.Responses[0].GetResponseDeleteRange().PrevKvs; len(prev) > 0 {
+		return s.prevKVItem(prev[0])
+	}
+	return nil
+}
+
+// Create writes value to key only if the key does not exist yet, attaching it to a new lease if
+// ttl > 0. It returns false, not an error, if the key already exists.
+func (s *Store) Create(ctx context.Context, key, value string, ttl int64) (bool, error) {
+	item := &KVItem{Key: key, Value: value}
+	if ttl > 0 {
+		leaseID, err := s.Grant(ctx, ttl)
+		if err != nil {
+			return false, err
+		}
+		item.LeaseID = leaseID
+	}
+	created, err := s.CreateItem(ctx, item)
+	if !created && item.LeaseID != 0 {
+		s.client.Revoke(context.WithoutCancel(ctx), clientv3.LeaseID(item.LeaseID))
+	}
+	return created, err
+}
+
+// CreateItem stores item together with its metadata only if its key does not exist yet.
+// It returns false, not an error, if the key already exists.
+func (s *Store) CreateItem(ctx context.Context, item *KVItem) (bool, error) {
+	var opts []clientv3.OpOption
+	if item.LeaseID != 0 {
+		opts = append(opts, clientv3.WithLease(clientv3.LeaseID(item.LeaseID)))
+	}
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(item.Key), "=", 0)).
+		Then(append([]clientv3.Op{clientv3.OpPut(item.Key, s.encodeValue(item), opts...)}, s.requestIDOps(ctx, item)...)...).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
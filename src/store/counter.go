@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// incrementMaxAttempts bounds how often Increment retries when the key changes concurrently.
+const incrementMaxAttempts = 10
+
+// ErrNotInteger is returned when incrementing a key whose value is not an integer.
+var ErrNotInteger = errors.New("value is not an integer")
+
+// ErrIncrementConflict is returned when the key kept changing between read and write.
+var ErrIncrementConflict = errors.New("key changed concurrently, retry")
+
+// ErrValueTooLarge is returned when the new value of a counter is longer than MAX_VALUE_SIZE.
+var ErrValueTooLarge = errors.New("value too large")
+
+// CounterBounds are optional inclusive limits on the value of a counter.
+type CounterBounds struct {
+	Min *int64
+	Max *int64
+}
+
+// CounterBoundError is returned when an increment would leave the counter's bounds.
+type CounterBoundError struct {
+	Current int64  // Value of the counter, unchanged
+	Bound   string // "floor" or "ceiling"
+}
+
+func (e *CounterBoundError) Error() string {
+	return fmt.Sprintf("counter would pass its %s (current value %d)", e.Bound, e.Current)
+}
+
+// Increment atomically adds delta to the integer value of key, treating a missing key as 0,
+// and returns the new value. It returns ErrNotInteger if the current value is not an integer.
+func (s *Store) Increment(ctx context.Context, key string, delta int64, ttl int64) (int64, error) {
+	value, _, err := s.IncrementWithBounds(ctx, key, delta, CounterBounds{}, ttl, "")
+	return value, err
+}
+
+// IncrementWithBounds atomically adds delta to the integer value of key, treating a missing key
+// as 0, and returns the new value and whether the key was created. The write only happens if the
+// new value stays within bounds, otherwise a *CounterBoundError is returned. If ttl > 0 the key
+// is attached to a new lease, otherwise an existing key keeps its lease. The new value is stored
+// like SetItem stores it, keeping the metadata of the current value with its checksum updated,
+// and recording requestID if not empty.
+//
+// The read and write are tied together by an etcd transaction on the key's revision, so
+// concurrent increments never lose updates; on a conflict the increment is retried.
+func (s *Store) IncrementWithBounds(ctx context.Context, key string, delta int64, bounds CounterBounds, ttl int64, requestID string) (int64, bool, error) {
+	var leaseID clientv3.LeaseID
+	if ttl > 0 {
+		lease, err := s.client.Grant(ctx, ttl)
+		if err != nil {
+			return 0, false, err
+		}
+		leaseID = lease.ID
+	}
+	revokeLease := func() {
+		if leaseID != 0 {
+			s.client.Revoke(context.WithoutCancel(ctx), leaseID)
+		}
+	}
+
+	for range incrementMaxAttempts {
+		resp, err := s.client.Get(ctx, key)
+		if err != nil {
+			revokeLease()
+			return 0, false, err
+		}
+
+		var current int64
+		item := &KVItem{Key: key}
+		cmp := clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+		exists := len(resp.Kvs) > 0
+		if exists {
+			kv := resp.Kvs[0]
+			item = s.DecodeKVItem(key, kv.Value)
+			current, err = strconv.ParseInt(strings.TrimSpace(item.Value), 10, 64)
+			if err != nil {
+				revokeLease()
+				return 0, false, ErrNotInteger
+			}
+			cmp = clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)
+		}
+
+		next, err := addWithinBounds(current, delta, bounds)
+		if err != nil {
+			revokeLease()
+			return current, false, err
+		}
+		item.Value = strconv.FormatInt(next, 10)
+		item.RequestID = requestID
+		if item.Checksum != "" {
+			sum := sha256.Sum256([]byte(item.Value))
+			item.Checksum = hex.EncodeToString(sum[:])
+		}
+		if int64(len(item.Value)) > s.maxValueSize {
+			revokeLease()
+			return current, false, ErrValueTooLarge
+		}
+
+		var opts []clientv3.OpOption
+		switch {
+		case leaseID != 0:
+			opts = append(opts, clientv3.WithLease(leaseID))
+		case exists:
+			opts = append(opts, clientv3.WithIgnoreLease())
+		}
+		txnResp, err := s.client.Txn(ctx).
+			If(cmp).
+			Then(append([]clientv3.Op{clientv3.OpPut(key, s.encodeValue(item), opts...)}, s.requestIDOps(ctx, item)...)...).
+			Commit()
+		if err != nil {
+			revokeLease()
+			return 0, false, err
+		}
+		if txnResp.Succeeded {
+			return next, !exists, nil
+		}
+	}
+	revokeLease()
+	return 0, false, ErrIncrementConflict
+}
+
+// addWithinBounds returns current + delta, or a *CounterBoundError if the result would
+// overflow or leave bounds.
+func addWithinBounds(current, delta int64, bounds CounterBounds) (int64, error) {
+	if delta > 0 && current > math.MaxInt64-delta {
+		return 0, &CounterBoundError{Current: current, Bound: "ceiling"}
+	}
+	if delta < 0 && current < math.MinInt64-delta {
+		return 0, &CounterBoundError{Current: current, Bound: "floor"}
+	}
+	next := current + delta
+	if bounds.Max != nil && next > *bounds.Max {
+		return 0, &CounterBoundError{Current: current, Bound: "ceiling"}
+	}
+	if bounds.Min != nil && next < *bounds.Min {
+		return 0, &CounterBoundError{Current: current, Bound: "floor"}
+	}
+	return next, nil
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func bound(v int64) *int64 { return &v }
+
+func TestAddWithinBounds(t *testing.T) {
+	tests := []struct {
+		name           string
+		current, delta int64
+		bounds         CounterBounds
+		want           int64
+		hit            string // Bound hit, "" if the increment succeeds
+	}{
+		{"no bounds", 5, 3, CounterBounds{}, 8, ""},
+		{"up to ceiling", 8, 2, CounterBounds{Max: bound(10)}, 10, ""},
+		{"past ceiling", 9, 2, CounterBounds{Max: bound(10)}, 0, "ceiling"},
+		{"down to floor", 2, -2, CounterBounds{Min: bound(0)}, 0, ""},
+		{"past floor", 1, -2, CounterBounds{Min: bound(0)}, 0, "floor"},
+		{"within both", 5, -1, CounterBounds{Min: bound(0), Max: bound(10)}, 4, ""},
+		{"decrement ignores ceiling", 15, -1, CounterBounds{Max: bound(10)}, 0, "ceiling"},
+		{"zero delta outside bounds", 15, 0, CounterBounds{Max: bound(10)}, 0, "ceiling"},
+		{"overflow", math.MaxInt64, 1, CounterBounds{}, 0, "ceiling"},
+		{"underflow", math.MinInt64, -1, CounterBounds{}, 0, "floor"},
+		{"negative range", -5, -5, CounterBounds{Min: bound(-10), Max: bound(-1)}, -10, ""},
+	}
+	for _, tt := range tests {
+		got, err := addWithinBounds(tt.current, tt.delta, tt.bounds)
+		var boundErr *CounterBoundError
+		switch {
+		case tt.hit == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.hit == "" && got != tt.want:
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		case tt.hit != "" && !errors.As(err, &boundErr):
+			t.Errorf("%s: error = %v, want a *CounterBoundError", tt.name, err)
+		case tt.hit != "" && (boundErr.Bound != tt.hit || boundErr.Current != tt.current):
+			t.Errorf("%s: hit %s at %d, want %s at %d", tt.name, boundErr.Bound, boundErr.Current, tt.hit, tt.current)
+		}
+	}
+}
+
+func TestIncrementWithBoundsHitsFloorAndCeiling(t *testing.T) {
+	s, prefix := newTestStore(t)
+	ctx := context.Background()
+	key := prefix + "counter"
+	bounds := CounterBounds{Min: bound(0), Max: bound(2)}
+
+	for want := int64(1); want <= 2; want++ {
+		if got, _, err := s.IncrementWithBounds(ctx, key, 1, bounds, 0, ""); err != nil || got != want {
+			t.Fatalf("increment = %d, %v, want %d", got, err, want)
+		}
+	}
+	var boundErr *CounterBoundError
+	if _, _, err := s.IncrementWithBounds(ctx, key, 1, bounds, 0, ""); !errors.As(err, &boundErr) || boundErr.Bound != "ceiling" || boundErr.Current != 2 {
+		t.Fatalf("increment past the ceiling = %v, want ceiling at 2", err)
+	}
+
+	if got, _, err := s.IncrementWithBounds(ctx, key, -2, bounds, 0, ""); err != nil || got != 0 {
+		t.Fatalf("decrement to the floor = %d, %v, want 0", got, err)
+	}
+	if _, _, err := s.IncrementWithBounds(ctx, key, -1, bounds, 0, ""); !errors.As(err, &boundErr) || boundErr.Bound != "floor" || boundErr.Current != 0 {
+		t.Fatalf("decrement past the floor = %v, want floor at 0", err)
+	}
+
+	item, found, err := s.Get(ctx, key)
+	if err != nil || !found || item.Value != "0" {
+		t.Errorf("counter after refused increments = %+v, %v, %v, want 0", item, found, err)
+	}
+}
+
+func TestIncrementKeepsEnvelope(t *testing.T) {
+	s, prefix := newTestStore(t)
+	ctx := context.Background()
+	key := prefix + "counter"
+	sum := sha256.Sum256([]byte("1"))
+	if _, err := s.SetItem(ctx, &KVItem{Key: key, Value: "1", ContentType: "text/plain", Tags: []string{"hits"}, Checksum: hex.EncodeToString(sum[:])}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.IncrementWithBounds(ctx, key, 2, CounterBounds{}, 0, "req-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	item, _, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum = sha256.Sum256([]byte("3"))
+	if item.Value != "3" || item.ContentType != "text/plain" || len(item.Tags) != 1 || item.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("incremented item = %+v, want value 3 with its metadata and an updated checksum", item)
+	}
+	event := &clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(key), ModRevision: item.Revision}}
+	if ids := s.RequestIDs(ctx, []*clientv3.Event{event}); ids[0] != "req-1" {
+		t.Errorf("request ID of the increment = %q, want req-1", ids[0])
+	}
+}
+
+func TestIncrementRespectsMaxValueSize(t *testing.T) {
+	s, prefix := newTestStore(t)
+	s.maxValueSize = 1
+	ctx := context.Background()
+	key := prefix + "counter"
+	if _, err := s.Increment(ctx, key, 9, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Increment(ctx, key, 1, 0); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("increment past MAX_VALUE_SIZE: error = %v, want ErrValueTooLarge", err)
+	}
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// Values that carry metadata are stored in a versioned envelope:
+//
+//	"\x00kv" + version + "\n" + JSON metadata + "\n" + value
+//
+// Values without metadata are stored as-is, so keys written by plain clients (or before
+// the envelope existed) keep their exact bytes in etcd. On read, anything that does not
+// parse as a known envelope version is returned unchanged as a plain value. Values starting
+// with the envelope prefix are always wrapped, even without metadata, so they read back as
+// written.
+//
+// The metadata is JSON so fields can be added without a new version; unknown fields are
+// ignored by older readers. A new version is only needed if the layout itself changes.
+//
+// A compressed value is stored compressed after the metadata, which names the compression.
+const (
+	envelopePrefix     = "\x00kv"
+	envelopeVersion1   = "1"
+	valueEnvelopeMagic = envelopePrefix + envelopeVersion1 + "\n"
+
+	compressionGzip = "gzip"
+)
+
+// valueMeta is the metadata stored alongside a value.
+type valueMeta struct {
+	Checksum    string   `json:"checksum,omitempty"`
+	ContentType string   `json:"content_type,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Encoding    string   `json:"encoding,omitempty"`
+	Compression string   `json:"compression,omitempty"`
+}
+
+// empty reports whether there is no metadata to store.
+func (m valueMeta) empty() bool {
+	return m.Checksum == "" && m.ContentType == "" && len(m.Tags) == 0 && m.Encoding == "" && m.Compression == ""
+}
+
+// encodeValue wraps the item value in an envelope when it has metadata, compressing values of
+// at least COMPRESS_MIN_SIZE bytes if that makes them smaller. Values that themselves start
+// with the envelope prefix are always wrapped, so a client can't write a value that reads
+// back as an envelope with metadata it chose.
+func (s *Store) encodeValue(item *KVItem) string {
+	value := item.Value
+	meta := valueMeta{
+		Checksum:    item.Checksum,
+		ContentType: item.ContentType,
+		Tags:        item.Tags,
+		Encoding:    item.Encoding,
+	}
+	if s.compressMinSize > 0 && len(value) >= s.compressMinSize {
+		if compressed, ok := gzipValue(value); ok {
+			value = compressed
+			meta.Compression = compressionGzip
+		}
+	}
+	if meta.empty() && !strings.HasPrefix(value, envelopePrefix) {
+		return value
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return item.Value
+	}
+	return valueEnvelopeMagic + string(data) + "\n" + value
+}
+
+// gzipValue compresses value, reporting false if that does not make it smaller.
+func gzipValue(value string) (string, bool) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, value); err != nil {
+		return "", false
+	}
+	if err := zw.Close(); err != nil {
+		return "", false
+	}
+	if buf.Len() >= len(value) {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// DecodeKVItem builds a KVItem from a stored value, unwrapping its metadata envelope if present.
+// A compressed value inflating past MAX_VALUE_SIZE is corrupt, and returned as stored.
+func (s *Store) DecodeKVItem(key string, raw []byte) *KVItem {
+	item := &KVItem{Key: key, Value: string(raw), StoredSize: int64(len(raw))}
+	if !bytes.HasPrefix(raw, []byte(valueEnvelopeMagic)) {
+		return item
+	}
+	rest := raw[len(valueEnvelopeMagic):]
+	i := bytes.IndexByte(rest, '\n')
+	if i < 0 {
+		return item
+	}
+	var meta valueMeta
+	if err := json.Unmarshal(rest[:i], &meta); err != nil {
+		return item // Not an envelope after all, treat as a plain value
+	}
+	value := rest[i+1:]
+	if meta.Compression == compressionGzip {
+		zr, err := gzip.NewReader(bytes.NewReader(value))
+		if err != nil {
+			return item
+		}
+		if value, err = io.ReadAll(io.LimitReader(zr, s.maxValueSize+1)); err != nil || int64(len(value)) > s.maxValueSize {
+			return item
+		}
+	} else if meta.Compression != "" {
+		return item // Compressed with something this version cannot read
+	}
+	item.Value = string(value)
+	item.Checksum = meta.Checksum
+	item.ContentType = meta.ContentType
+	item.Tags = meta.Tags
+	item.Encoding = meta.Encoding
+	return item
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDecodeKVItemLegacyRawValues(t *testing.T) {
+	s := &Store{maxValueSize: 1 << 20}
+	values := []string{
+		"",
+		"plain value",
+		`{"json":true}`,
+		"\x00binary\x01data",
+		"\x00kv",                      // Envelope prefix without a version
+		"\x00kv1\n",                   // Envelope header without metadata
+		"\x00kv1\nnot json\nvalue",    // Metadata that is not JSON
+		"\x00kv9\n{}\nfuture version", // Unknown version
+	}
+	for _, value := range values {
+		item := s.DecodeKVItem("k", []byte(value))
+		if item.Value != value {
+			t.Errorf("DecodeKVItem(%q).Value = %q, want it unchanged", value, item.Value)
+		}
+		if item.Checksum != "" || item.ContentType != "" || item.Tags != nil || item.Encoding != "" {
+			t.Errorf("DecodeKVItem(%q) has metadata %+v, want none", value, item)
+		}
+	}
+}
+
+func TestEncodeValueRoundTrip(t *testing.T) {
+	s := &Store{maxValueSize: 1 << 20}
+	tests := []struct {
+		name string
+		item KVItem
+		raw  bool // Stored without an envelope
+	}{
+		{"plain", KVItem{Value: "hello"}, true},
+		{"request ID only", KVItem{Value: "hello", RequestID: "req-1"}, true},
+		{"metadata", KVItem{Value: "hello", ContentType: "text/plain", Tags: []string{"a", "b"}, Checksum: "sha256:x", Encoding: "base64"}, false},
+		{"envelope look-alike", KVItem{Value: "\x00kv1\n{\"content_type\":\"text/html\"}\nspoofed"}, false},
+		{"envelope prefix only", KVItem{Value: "\x00kv"}, false},
+		{"look-alike with metadata", KVItem{Value: "\x00kv1\n{}\nx", Tags: []string{"t"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := s.encodeValue(&tt.item)
+			if raw := stored == tt.item.Value; raw != tt.raw {
+				t.Fatalf("stored raw = %v, want %v (stored %q)", raw, tt.raw, stored)
+			}
+			got := s.DecodeKVItem("k", []byte(stored))
+			if got.Value != tt.item.Value {
+				t.Errorf("Value = %q, want %q", got.Value, tt.item.Value)
+			}
+			if got.ContentType != tt.item.ContentType || got.Checksum != tt.item.Checksum || got.Encoding != tt.item.Encoding || !slices.Equal(got.Tags, tt.item.Tags) {
+				t.Errorf("metadata = %+v, want %+v", got, tt.item)
+			}
+		})
+	}
+}
+
+func TestEncodeValueCompression(t *testing.T) {
+	s := &Store{compressMinSize: 64, maxValueSize: 1 << 20}
+	value := strings.Repeat("compressible ", 100)
+	stored := s.encodeValue(&KVItem{Value: value})
+	if len(stored) >= len(value) {
+		t.Fatalf("stored %d bytes, want fewer than %d", len(stored), len(value))
+	}
+	if got := s.DecodeKVItem("k", []byte(stored)); got.Value != value {
+		t.Errorf("Value = %q, want the original value", got.Value)
+	}
+}
+
+func TestDecodeKVItemCompressedPastMaxValueSize(t *testing.T) {
+	writer := &Store{compressMinSize: 64, maxValueSize: 1 << 20}
+	value := strings.Repeat("a", 4096)
+	stored := writer.encodeValue(&KVItem{Value: value, ContentType: "text/plain"})
+
+	reader := &Store{maxValueSize: 1024}
+	got := reader.DecodeKVItem("k", []byte(stored))
+	if got.Value != stored {
+		t.Errorf("Value has %d bytes, want the %d stored bytes returned as is", len(got.Value), len(stored))
+	}
+	if got.ContentType != "" {
+		t.Errorf("ContentType = %q, want none for a corrupt value", got.ContentType)
+	}
+
+	reader.maxValueSize = int64(len(value))
+	if got := reader.DecodeKVItem("k", []byte(stored)); got.Value != value {
+		t.Errorf("value of exactly the max size was not decompressed")
+	}
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+// EndpointStatus describes the etcd endpoint that answered a status request.
+type EndpointStatus struct {
+	Endpoint string
+	Version  string
+}
+
+// Status asks the configured etcd endpoints for their status, in order, and returns the
+// first one that answers.
+func (s *Store) Status(ctx context.Context) (*EndpointStatus, error) {
+	var errs []error
+	for _, endpoint := range s.client.Endpoints() {
+		resp, err := s.client.Status(ctx, endpoint)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return &EndpointStatus{Endpoint: endpoint, Version: resp.Version}, nil
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no etcd endpoints configured")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Ping reports whether at least one etcd endpoint is reachable.
+func (s *Store) Ping(ctx context.Context) error {
+	_, err := s.Status(ctx)
+	return err
+}
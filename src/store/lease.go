@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// refreshBatchSize is the number of keys updated per transaction by RefreshTTL.
+const refreshBatchSize = 100
+
+var (
+	// ErrLeaseNotFound is returned when a lease does not exist or has expired.
+	ErrLeaseNotFound = errors.New("lease not found")
+	// ErrKeyNotFound is returned when a key that must exist does not.
+	ErrKeyNotFound = errors.New("key not found")
+)
+
+// LeaseInfo describes a lease and the keys attached to it.
+type LeaseInfo struct {
+	ID         int64
+	TTL        int64 // Remaining TTL in seconds
+	GrantedTTL int64 // TTL the lease was granted or last refreshed with
+	Keys       []string
+}
+
+// KeepAlive refreshes a lease once and returns its new TTL.
+func (s *Store) KeepAlive(ctx context.Context, leaseID int64) (int64, error) {
+	resp, err := s.client.KeepAliveOnce(ctx, clientv3.LeaseID(leaseID))
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return 0, ErrLeaseNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return resp.TTL, nil
+}
+
+// Lease returns the remaining TTL of a lease and the keys attached to it.
+func (s *Store) Lease(ctx context.Context, leaseID int64) (*LeaseInfo, error) {
+	resp, err := s.client.TimeToLive(ctx, clientv3.LeaseID(leaseID), clientv3.WithAttachedKeys())
+	if err != nil {
+		return nil, err
+	}
+	if resp.TTL <= 0 {
+		return nil, ErrLeaseNotFound
+	}
+	info := &LeaseInfo{
+		ID:         leaseID,
+		TTL:        resp.TTL,
+		GrantedTTL: resp.GrantedTTL,
+		Keys:       make([]string, 0, len(resp.Keys)),
+	}
+	for _, key := range resp.Keys {
+		info.Keys = append(info.Keys, string(key))
+	}
+	return info, nil
+}
+
+// sharedLease is a lease handed out to many short-lived keys, see SharedLease.
+type sharedLease struct {
+	id      int64
+	renewAt time.Time // When to grant a new lease instead
+}
+
+// SharedLease returns a lease of ttl seconds to attach a short-lived key to, shared with the
+// other keys of the same TTL so that each of them does not cost a lease of its own. A new lease
+// is granted once the current one has used a tenth of its TTL, so attached keys live between
+// nine tenths of ttl and ttl seconds. Leases are shared within this Store only.
+func (s *Store) SharedLease(ctx context.Context, ttl int64) (int64, error) {
+	s.sharedLeasesMu.Lock()
+	defer s.sharedLeasesMu.Unlock()
+	now := time.Now()
+	if lease, ok := s.sharedLeases[ttl]; ok && now.Before(lease.renewAt) {
+		return lease.id, nil
+	}
+	id, err := s.Grant(ctx, ttl)
+	if err != nil {
+		return 0, err
+	}
+	if s.sharedLeases == nil {
+		s.sharedLeases = make(map[int64]sharedLease)
+	}
+	s.sharedLeases[ttl] = sharedLease{id: id, renewAt: now.Add(time.Duration(ttl) * time.Second / 10)}
+	return id, nil
+}
+
+// Revoke revokes a lease, deleting every key attached to it.
+func (s *Store) Revoke(ctx context.Context, leaseID int64) error {
+	_, err := s.client.Revoke(ctx, clientv3.LeaseID(leaseID))
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return ErrLeaseNotFound
+	}
+	return err
+}
+
+// RefreshTTL attaches every key under prefix to one new lease with the given TTL, without
+// rewriting their values, and returns the number of keys updated. Keys are processed in
+// batches, each batch in a single transaction; keys deleted concurrently are skipped.
+func (s *Store) RefreshTTL(ctx context.Context, prefix string, ttl int64) (int64, error) {
+	lease, err := s.client.Grant(ctx, ttl)
+	if err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	end := clientv3.GetPrefixRangeEnd(prefix)
+	from := prefix
+	for {
+		resp, err := s.client.Get(ctx, from, clientv3.WithRange(end), clientv3.WithLimit(refreshBatchSize), clientv3.WithKeysOnly())
+		if err != nil {
+			return updated, err
+		}
+
+		ops := make([]clientv3.Op, 0, len(resp.Kvs))
+		for _, kv := range resp.Kvs {
+			key := string(kv.Key)
+			ops = append(ops, clientv3.OpTxn(
+				[]clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(key), ">", 0)},
+				[]clientv3.Op{clientv3.OpPut(key, "", clientv3.WithIgnoreValue(), clientv3.WithLease(lease.ID))},
+				nil,
+			))
+		}
+		if len(ops) > 0 {
+			txnResp, err := s.client.Txn(ctx).Then(ops...).Commit()
+			if err != nil {
+				return updated, err
+			}
+			for _, r := range txnResp.Responses {
+				if r.GetResponseTxn().GetSucceeded() {
+					updated++
+				}
+			}
+		}
+
+		if !resp.More || len(resp.Kvs) == 0 {
+			break
+		}
+		from = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+
+	// Nothing is attached to the lease, don't leave it dangling
+	if updated == 0 {
+		s.client.Revoke(context.WithoutCancel(ctx), lease.ID)
+	}
+	return updated, nil
+}
+
+// SetTTL attaches key to a new lease with the given TTL without rewriting its value, or removes
+// its expiration if ttl is 0. It returns ErrKeyNotFound if the key does not exist.
+func (s *Store) SetTTL(ctx context.Context, key string, ttl int64) error {
+	var leaseID clientv3.LeaseID
+	if ttl > 0 {
+		lease, err := s.client.Grant(ctx, ttl)
+		if err != nil {
+			return err
+		}
+		leaseID = lease.ID
+	}
+
+	// A put without a lease detaches the key from its current one
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+		Then(clientv3.OpPut(key, "", clientv3.WithIgnoreValue(), clientv3.WithLease(leaseID))).
+		Commit()
+	if err == nil && resp.Succeeded {
+		return nil
+	}
+	if leaseID != 0 {
+		s.client.Revoke(context.WithoutCancel(ctx), leaseID)
+	}
+	if err != nil {
+		return err
+	}
+	return ErrKeyNotFound
+}
+
+// Touch attaches key to a new lease with the given TTL, without rewriting its value, and returns
+// the key as of that write. It returns false if the key does not exist.
+func (s *Store) Touch(ctx context.Context, key string, ttl int64) (*KVItem, bool, error) {
+	lease, err := s.client.Grant(ctx, ttl)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+		Then(
+			clientv3.OpPut(key, "", clientv3.WithIgnoreValue(), clientv3.WithLease(lease.ID)),
+			clientv3.OpGet(key),
+		).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		s.client.Revoke(context.WithoutCancel(ctx), lease.ID)
+		return nil, false, err
+	}
+	kvs := resp.Responses[1].GetResponseRange().Kvs
+	if len(kvs) == 0 {
+		return nil, false, nil
+	}
+	kvItem := s.DecodeKVItem(key, kvs[0].Value)
+	kvItem.Revision = kvs[0].ModRevision
+	kvItem.Created = kvs[0].CreateRevision
+	kvItem.Version = kvs[0].Version
+	kvItem.LeaseID = int64(lease.ID)
+	kvItem.TTL = &ttl
+	return kvItem, true, nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// LockInfo describes the current holder of a key used as a lock.
+// The lock key is readable like any other key, so only a hash of the token is stored in it.
+type LockInfo struct {
+	Owner     string `json:"owner"`
+	TokenHash string `json:"token_hash,omitempty"`
+	ExpireAt  int64  `json:"expire_at"`
+}
+
+// hashLockToken returns the hex SHA-256 of a lock token, as stored in the lock key.
+func hashLockToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// heldWith reports whether the stored lock info was acquired with token.
+func (info *LockInfo) heldWith(token string) bool {
+	if info.TokenHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(info.TokenHash), []byte(hashLockToken(token))) == 1
+}
+
+// Acquire creates the key as a lock held by owner if it does not already exist.
+// The key is attached to a fresh lease so the lock expires after ttl seconds.
+// It returns the new lock and true on success, or the current holder and false
+// if the key already exists.
+func (s *Store) Acquire(ctx context.Context, key, owner, token string, ttl int64) (*LockInfo, bool, error) {
+	lease, err := s.client.Grant(ctx, ttl)
+	if err != nil {
+		return nil, false, err
+	}
+
+	info := &LockInfo{
+		Owner:     owner,
+		TokenHash: hashLockToken(token),
+		ExpireAt:  time.Now().Unix() + ttl,
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(data), clientv3.WithLease(lease.ID))).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		s.client.Revoke(context.WithoutCancel(ctx), lease.ID)
+		return nil, false, err
+	}
+	if resp.Succeeded {
+		return info, true, nil
+	}
+
+	// Lock is held by someone else, the lease we granted is not needed
+	s.client.Revoke(context.WithoutCancel(ctx), lease.ID)
+
+	holder := &LockInfo{}
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(kvs) == 0 {
+		return holder, false, nil
+	}
+	json.Unmarshal(kvs[0].Value, holder) // Key may not be a lock, return what we can
+	holder.TokenHash = ""
+	if kvs[0].Lease != 0 {
+		if ttlResp, err := s.client.TimeToLive(ctx, clientv3.LeaseID(kvs[0].Lease)); err == nil {
+			holder.ExpireAt = time.Now().Unix() + ttlResp.TTL
+		}
+	}
+	return holder, false, nil
+}
+
+// Release deletes a lock key only if it is held with the given token.
+// It returns false if the key does not exist or the token does not match.
+func (s *Store) Release(ctx context.Context, key, token string) (bool, error) {
+	resp, err := s.client.Get(ctx, key)
+	if err != nil || len(resp.Kvs) == 0 {
+		return false, err
+	}
+	kv := resp.Kvs[0]
+
+	var info LockInfo
+	if err := json.Unmarshal(kv.Value, &info); err != nil || !info.heldWith(token) {
+		return false, nil
+	}
+
+	// Only delete if nobody modified the lock since we read it
+	txnResp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil || !txnResp.Succeeded {
+		return false, err
+	}
+
+	if kv.Lease != 0 {
+		s.client.Revoke(context.WithoutCancel(ctx), clientv3.LeaseID(kv.Lease))
+	}
+	return true, nil
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLockInfoHeldWith(t *testing.T) {
+	hashed := &LockInfo{Owner: "worker-1", TokenHash: hashLockToken("secret-token")}
+	// Locks stored before tokens were hashed held the token itself, which is no longer accepted
+	legacy := &LockInfo{}
+	if err := json.Unmarshal([]byte(`{"owner":"worker-1","token":"secret-token"}`), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		info  *LockInfo
+		token string
+		want  bool
+	}{
+		{"hashed, right token", hashed, "secret-token", true},
+		{"hashed, wrong token", hashed, "other-token", false},
+		{"hashed, hash as token", hashed, hashed.TokenHash, false},
+		{"legacy plaintext token", legacy, "secret-token", false},
+		{"no token", &LockInfo{Owner: "worker-1"}, "", false},
+	}
+	for _, tt := range tests {
+		if got := tt.info.heldWith(tt.token); got != tt.want {
+			t.Errorf("%s: heldWith(%q) = %v, want %v", tt.name, tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestLockInfoStoredWithoutToken(t *testing.T) {
+	data, err := json.Marshal(&LockInfo{Owner: "worker-1", TokenHash: hashLockToken("secret-token"), ExpireAt: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-token") || strings.Contains(string(data), `"token"`) {
+		t.Errorf("stored lock %s contains the token", data)
+	}
+}
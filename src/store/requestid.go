@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// requestIDTTL is how many seconds the ID of the request behind a write is kept, long enough
+// for the watcher to pass it on to webhooks even if it lags behind or has just failed over.
+const requestIDTTL = 600
+
+// requestIDBatchSize is the number of request IDs read per transaction by RequestIDs, below
+// etcd's default limit of operations per transaction.
+const requestIDBatchSize = 100
+
+// requestIDKey returns the key holding the ID of the request that last wrote key.
+func (s *Store) requestIDKey(key string) string {
+	return s.requestIDPrefix + key
+}
+
+// requestIDOps returns the operations recording the ID of the request writing items, to run
+// in the same transaction as the writes. The ID is kept under a short-lived key of its own
+// rather than with the value, so values are stored exactly as sent, and the watcher finds it
+// whichever pod handled the request. Items without a request ID are skipped, and so are all
+// of them if no lease can be had: losing the ID must not fail the write.
+func (s *Store) requestIDOps(ctx context.Context, items ...*KVItem) []clientv3.Op {
+	var ops []clientv3.Op
+	var leaseID int64
+	for _, item := range items {
+		if item.RequestID == "" {
+			continue
+		}
+		if leaseID == 0 {
+			id, err := s.SharedLease(ctx, requestIDTTL)
+			if err != nil {
+				return nil
+			}
+			leaseID = id
+		}
+		ops = append(ops, clientv3.OpPut(s.requestIDKey(item.Key), item.RequestID, clientv3.WithLease(clientv3.LeaseID(leaseID))))
+	}
+	return ops
+}
+
+// RequestIDs returns, for each event, the ID of the request that made the write, or "" if it
+// is unknown: the event is a delete, the write was made without a request ID, or so long ago
+// that its ID is gone.
+func (s *Store) RequestIDs(ctx context.Context, events []*clientv3.Event) []string {
+	ids := make([]string, len(events))
+	var puts []int // Indexes of the events to look up
+	for i, event := range events {
+		if event.Type == mvccpb.PUT {
+			puts = append(puts, i)
+		}
+	}
+	for start := 0; start < len(puts); start += requestIDBatchSize {
+		batch := puts[start:min(start+requestIDBatchSize, len(puts))]
+		gets := make([]clientv3.Op, 0, len(batch))
+		for _, i := range batch {
+			kv := events[i].Kv
+			gets = append(gets, clientv3.OpGet(s.requestIDKey(string(kv.Key)), clientv3.WithRev(kv.ModRevision)))
+		}
+		resp, err := s.client.Txn(ctx).Then(gets...).Commit()
+		if err != nil {
+			continue // Compacted or unreachable, the IDs are unknown
+		}
+		for j, r := range resp.Responses {
+			// The ID key is written with the value, an older one belongs to an earlier write
+			kvs := r.GetResponseRange().Kvs
+			if i := batch[j]; len(kvs) > 0 && kvs[0].ModRevision == events[i].Kv.ModRevision {
+				ids[i] = string(kvs[0].Value)
+			}
+		}
+	}
+	return ids
+}
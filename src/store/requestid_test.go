@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestRequestIDsFollowWrites(t *testing.T) {
+	s, prefix := newTestStore(t)
+	ctx := context.Background()
+	key := prefix + "traced"
+
+	// putEvent writes item and returns the watch event of the write
+	putEvent := func(item *KVItem) *clientv3.Event {
+		t.Helper()
+		if _, err := s.SetItem(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+		stored, _, err := s.Get(ctx, item.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(item.Key), ModRevision: stored.Revision}}
+	}
+	traced := putEvent(&KVItem{Key: key, Value: "v", RequestID: "req-1"})
+	untraced := putEvent(&KVItem{Key: key, Value: "w"})
+	deleted := &clientv3.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(key), ModRevision: traced.Kv.ModRevision}}
+
+	// A store of its own stands in for the watcher's pod
+	other, _ := newTestStore(t)
+	other.requestIDPrefix = s.requestIDPrefix
+	got := other.RequestIDs(ctx, []*clientv3.Event{traced, untraced, deleted})
+	want := []string{"req-1", "", ""}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("RequestIDs()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	raw, err := s.client.Get(ctx, key, clientv3.WithRev(traced.Kv.ModRevision))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := string(raw.Kvs[0].Value); value != "v" {
+		t.Errorf("stored value = %q, want it stored exactly as sent", value)
+	}
+}
+
+func TestSharedLeaseIsReused(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	first, err := s.SharedLease(ctx, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.SharedLease(ctx, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("SharedLease granted %d then %d, want one lease", first, second)
+	}
+	other, err := s.SharedLease(ctx, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Error("SharedLease shared a lease between different TTLs")
+	}
+}
@@ -4,28 +4,61 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/mrofi/simple-golang-kv/src/config"
+	"github.com/mrofi/simple-golang-kv/src/tracing"
 	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// ErrCompacted is returned when reading at a revision that has been compacted away.
+var ErrCompacted = errors.New("revision has been compacted")
+
+// ErrFutureRevision is returned when reading at a revision etcd has not reached yet.
+var ErrFutureRevision = errors.New("revision is in the future")
+
 // Store represents a key-value store backed by etcd.
 type Store struct {
 	client     *clientv3.Client
-	session    *concurrency.Session
+	sessionMu  sync.Mutex
+	session    *concurrency.Session // Replaced when it expires, see lockSession
 	lockPrefix string
+	writeLocks bool // Lock keys around Set and Delete
+
+	compressMinSize int   // Values of at least this many bytes are gzipped, 0 to never compress
+	maxValueSize    int64 // Largest value a compressed value may inflate to, see DecodeKVItem
+	requestIDPrefix string
+
+	sharedLeasesMu sync.Mutex
+	sharedLeases   map[int64]sharedLease // By TTL, see SharedLease
 }
 
 type KVItem struct {
-	Key   string
-	Value string
-	TTL   *int64 // in seconds
+	Key      string
+	Value    string
+	TTL      *int64 // Remaining seconds, 0 once the lease has run out; nil if the key has no lease or it is unknown
+	LeaseID  int64  // 0 if the key has no lease
+	Revision int64  // etcd mod revision of the key, 0 if unknown
+	Created  int64  // etcd create revision of the key, 0 if unknown
+	Version  int64  // Number of writes since the key was created, 0 if unknown
+	Checksum string // sha256 hex of Value, optional
+
+	ContentType string   // MIME type of Value, optional
+	Tags        []string // Free-form labels, optional
+	Encoding    string   // How the client encodes Value on the wire, e.g. "base64"; Value itself is raw
+	RequestID   string   // ID of the request that wrote the value, optional; kept apart from the value, see RequestIDs
+	StoredSize  int64    // Bytes stored in etcd, with metadata and after compression, 0 if unknown
 }
 
 // NewStore creates a new instance of Store connected to etcd with optional TLS.
@@ -34,6 +67,7 @@ func NewStore() (*Store, error) {
 }
 
 // NewStoreWithConfig creates a new instance of Store connected to etcd with optional TLS.
+// Unreadable or invalid certificate files are returned as errors.
 func NewStoreWithConfig(cfg *config.Config) (*Store, error) {
 	endpoints := cfg.ETCDEndpoints
 	caFile := cfg.ETCDCAFile
@@ -46,18 +80,18 @@ func NewStoreWithConfig(cfg *config.Config) (*Store, error) {
 		// Load CA cert
 		caCert, err := os.ReadFile(caFile)
 		if err != nil {
-			log.Fatalf("Failed to read CA cert: %v", err)
+			return nil, fmt.Errorf("failed to read CA cert: %w", err)
 		}
 
 		caCertPool := x509.NewCertPool()
 		if ok := caCertPool.AppendCertsFromPEM(caCert); !ok {
-			log.Fatalf("Failed to append CA cert")
+			return nil, errors.New("failed to append CA cert")
 		}
 
 		// Load client cert/key pair
 		clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
 		if err != nil {
-			log.Fatalf("Failed to load client cert and key: %v", err)
+			return nil, fmt.Errorf("failed to load client cert and key: %w", err)
 		}
 
 		tlsConfig = &tls.Config{
@@ -80,18 +114,20 @@ func NewStoreWithConfig(cfg *config.Config) (*Store, error) {
 
 	cli, err := clientv3.New(clientv3.Config{
 		Endpoints:   endpoints,
-		DialTimeout: 5 * time.Second,
+		DialTimeout: time.Duration(cfg.ETCDDialTimeoutSeconds) * time.Second,
 		TLS:         tlsConfig,
 		Logger:      zapLogger,
+		Username:    cfg.ETCDUsername,
+		Password:    cfg.ETCDPassword,
+
+		DialKeepAliveTime:    time.Duration(cfg.ETCDKeepAliveTimeSeconds) * time.Second,
+		DialKeepAliveTimeout: time.Duration(cfg.ETCDKeepAliveTimeoutSeconds) * time.Second,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Create a session for distributed locking with a background context
-	// This ensures the session's lease operations won't be affected by context cancellation
-	sessionCtx := context.Background()
-	session, err := concurrency.NewSession(cli, concurrency.WithTTL(10), concurrency.WithContext(sessionCtx))
+	session, err := newLockSession(context.Background(), cli)
 	if err != nil {
 		cli.Close()
 		return nil, err
@@ -104,78 +140,420 @@ func NewStoreWithConfig(cfg *config.Config) (*Store, error) {
 		client:     cli,
 		session:    session,
 		lockPrefix: lockPrefix,
+		writeLocks: cfg.EnableWriteLocks,
+
+		requestIDPrefix: "/" + baseKeyPrefix + "/request-ids",
+
+		compressMinSize: cfg.CompressMinSize,
+		maxValueSize:    int64(cfg.MaxValueSize),
 	}, nil
 }
 
 // Set adds or updates a key-value pair in etcd with optional TTL (in seconds).
-// This operation is protected by a distributed lock to prevent race conditions.
-func (s *Store) Set(key string, value string, ttl int64) error {
-	ctx := context.Background()
-
-	// Acquire distributed lock for this key
-	mu := concurrency.NewMutex(s.session, s.lockPrefix+key)
-	if err := mu.Lock(ctx); err != nil {
-		return err
-	}
-	defer mu.Unlock(ctx)
-
+// Unless write locks are disabled, this operation is protected by a distributed lock to
+// prevent race conditions; without it, concurrent writes to the key are last-write-wins.
+func (s *Store) Set(ctx context.Context, key string, value string, ttl int64) error {
+	var leaseID int64
 	if ttl > 0 {
-		lease, err := s.client.Grant(ctx, ttl)
+		id, err := s.Grant(ctx, ttl)
 		if err != nil {
 			return err
 		}
-		_, err = s.client.Put(ctx, key, value, clientv3.WithLease(lease.ID))
-		return err
+		leaseID = id
 	}
-	_, err := s.client.Put(ctx, key, value)
+	return s.SetWithLease(ctx, key, value, leaseID)
+}
+
+// SetWithLease adds or updates a key-value pair attached to an existing lease (0 for no lease).
+// Unless write locks are disabled, this operation is protected by a distributed lock to
+// prevent race conditions; without it, concurrent writes to the key are last-write-wins.
+func (s *Store) SetWithLease(ctx context.Context, key string, value string, leaseID int64) error {
+	_, err := s.SetItem(ctx, &KVItem{Key: key, Value: value, LeaseID: leaseID})
 	return err
 }
 
+// SetItem adds or updates a key-value pair together with its metadata, attached to item.LeaseID
+// (0 for no lease). It returns the key's previous value, nil if the key did not exist.
+// Unless write locks are disabled, this operation is protected by a distributed lock to
+// prevent race conditions; without it, concurrent writes to the key are last-write-wins.
+func (s *Store) SetItem(ctx context.Context, item *KVItem) (prev *KVItem, err error) {
+	ctx, span := startSpan(ctx, "store.Set", "db.key", item.Key)
+	defer func() { tracing.End(span, err) }()
+
+	unlock, err := s.lockKey(ctx, item.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	opts := []clientv3.OpOption{clientv3.WithPrevKV()}
+	if item.LeaseID != 0 {
+		opts = append(opts, clientv3.WithLease(clientv3.LeaseID(item.LeaseID)))
+	}
+	ops := append([]clientv3.Op{clientv3.OpPut(item.Key, s.encodeValue(item), opts...)}, s.requestIDOps(ctx, item)...)
+	resp, err := s.client.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return nil, err
+	}
+	return s.prevKVItem(resp.Responses[0].GetResponsePut().PrevKv), nil
+}
+
+// startSpan starts a client span for a store operation on the key or prefix given as attr.
+func startSpan(ctx context.Context, name, attr, key string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "etcd"), attribute.String(attr, key)))
+}
+
+// lockSessionTTL is the TTL in seconds of the session holding write locks.
+const lockSessionTTL = 10
+
+// newLockSession creates a session for distributed locking. The lease is granted with ctx, but
+// the session is kept alive with a background context so its lease operations are not affected
+// by the cancellation of the request that created it.
+func newLockSession(ctx context.Context, cli *clientv3.Client) (*concurrency.Session, error) {
+	lease, err := cli.Grant(ctx, lockSessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	return concurrency.NewSession(cli, concurrency.WithLease(lease.ID), concurrency.WithContext(context.Background()))
+}
+
+// lockSession returns the session for write locks. A session whose lease has expired, for
+// example because etcd was unreachable for longer than its TTL, can never lock again, so it is
+// replaced by a new one and writes recover once etcd is back.
+func (s *Store) lockSession(ctx context.Context) (*concurrency.Session, error) {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	select {
+	case <-s.session.Done():
+	default:
+		return s.session, nil
+	}
+	session, err := newLockSession(ctx, s.client)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Store lock session expired, created a new one")
+	s.session = session
+	return session, nil
+}
+
+// lockKey acquires the distributed lock of a key and returns the function releasing it.
+// The lock makes concurrent writes to the same key take turns, at the cost of two extra etcd
+// round trips per write. With ENABLE_WRITE_LOCKS=false it does nothing: each write is a
+// single Put or Delete, and concurrent writes to a key are last-write-wins.
+func (s *Store) lockKey(ctx context.Context, key string) (func(), error) {
+	if !s.writeLocks {
+		return func() {}, nil
+	}
+	session, err := s.lockSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mu := concurrency.NewMutex(session, s.lockPrefix+key)
+	if err := mu.Lock(ctx); err != nil {
+		return nil, err
+	}
+	return func() {
+		// Unlock even if ctx is canceled, or the lock is held until the session expires
+		mu.Unlock(context.WithoutCancel(ctx))
+	}, nil
+}
+
+// Grant creates a new lease with the given TTL (in seconds) and returns its ID.
+func (s *Store) Grant(ctx context.Context, ttl int64) (int64, error) {
+	lease, err := s.client.Grant(ctx, ttl)
+	if err != nil {
+		return 0, err
+	}
+	return int64(lease.ID), nil
+}
+
 // Get retrieves the value for a given key from etcd and returns its lease ID and TTL if set.
-func (s *Store) Get(key string) (kvItem *KVItem, found bool, err error) {
-	resp, err := s.client.Get(context.Background(), key)
+func (s *Store) Get(ctx context.Context, key string) (kvItem *KVItem, found bool, err error) {
+	ctx, span := startSpan(ctx, "store.Get", "db.key", key)
+	defer func() { tracing.End(span, err) }()
+
+	resp, err := s.client.Get(ctx, key)
 	if err != nil || len(resp.Kvs) == 0 {
 		return nil, false, err
 	}
-	kv := s.formatKVKey(resp.Kvs[0])
+	kv := s.formatKVKey(ctx, resp.Kvs[0])
 	return kv, true, nil
 }
 
+// GetAtRevision retrieves a key as it was at rev. It returns ErrCompacted if rev has been
+// compacted away and ErrFutureRevision if etcd has not reached it yet. The TTL is that of the
+// key's lease now, not at rev.
+func (s *Store) GetAtRevision(ctx context.Context, key string, rev int64) (kvItem *KVItem, found bool, err error) {
+	ctx, span := startSpan(ctx, "store.GetAtRevision", "db.key", key)
+	defer func() { tracing.End(span, err) }()
+
+	resp, err := s.client.Get(ctx, key, clientv3.WithRev(rev))
+	switch {
+	case errors.Is(err, rpctypes.ErrCompacted):
+		return nil, false, ErrCompacted
+	case errors.Is(err, rpctypes.ErrFutureRev):
+		return nil, false, ErrFutureRevision
+	case err != nil || len(resp.Kvs) == 0:
+		return nil, false, err
+	}
+	return s.formatKVKey(ctx, resp.Kvs[0]), true, nil
+}
+
+// Stat retrieves a key's TTL, lease and revision without fetching its value.
+func (s *Store) Stat(ctx context.Context, key string) (kvItem *KVItem, found bool, err error) {
+	resp, err := s.client.Get(ctx, key, clientv3.WithKeysOnly())
+	if err != nil || len(resp.Kvs) == 0 {
+		return nil, false, err
+	}
+	return s.formatKVKey(ctx, resp.Kvs[0]), true, nil
+}
+
+// GetMany retrieves several keys in a single etcd transaction. The result has one entry per
+// key, in the same order, with nil for keys that do not exist.
+func (s *Store) GetMany(ctx context.Context, keys []string) ([]*KVItem, error) {
+	ops := make([]clientv3.Op, 0, len(keys))
+	for _, key := range keys {
+		ops = append(ops, clientv3.OpGet(key))
+	}
+	resp, err := s.client.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	var kvs []*mvccpb.KeyValue
+	positions := make([]int, 0, len(keys))
+	for i, r := range resp.Responses {
+		if found := r.GetResponseRange().Kvs; len(found) > 0 {
+			kvs = append(kvs, found[0])
+			positions = append(positions, i)
+		}
+	}
+	result := make([]*KVItem, len(keys))
+	for i, kvItem := range s.formatKVKeys(ctx, kvs) {
+		result[positions[i]] = kvItem
+	}
+	return result, nil
+}
+
 // Delete removes a key-value pair from etcd.
-// This operation is protected by a distributed lock to prevent race conditions.
-func (s *Store) Delete(key string) error {
-	ctx := context.Background()
+// Unless write locks are disabled, this operation is protected by a distributed lock to
+// prevent race conditions; without it, concurrent writes to the key are last-write-wins.
+func (s *Store) Delete(ctx context.Context, key string) (err error) {
+	ctx, span := startSpan(ctx, "store.Delete", "db.key", key)
+	defer func() { tracing.End(span, err) }()
 
-	// Acquire distributed lock for this key
-	mu := concurrency.NewMutex(s.session, s.lockPrefix+key)
-	if err := mu.Lock(ctx); err != nil {
+	unlock, err := s.lockKey(ctx, key)
+	if err != nil {
 		return err
 	}
-	defer mu.Unlock(ctx)
+	defer unlock()
 
-	_, err := s.client.Delete(ctx, key)
+	_, err = s.client.Delete(ctx, key)
 	return err
 }
 
-// All returns all key-value pairs in etcd (under a prefix).
-func (s *Store) All(prefix string) ([]*KVItem, error) {
-	resp, err := s.client.Get(context.Background(), prefix, clientv3.WithPrefix())
+// GetAndDelete atomically removes a key and returns its value before deletion.
+// Unless write locks are disabled, this operation is protected by a distributed lock to
+// prevent race conditions; without it, concurrent writes to the key are last-write-wins.
+func (s *Store) GetAndDelete(ctx context.Context, key string) (kvItem *KVItem, found bool, err error) {
+	ctx, span := startSpan(ctx, "store.Delete", "db.key", key)
+	defer func() { tracing.End(span, err) }()
+
+	unlock, err := s.lockKey(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	defer unlock()
+
+	resp, err := s.client.Delete(ctx, key, clientv3.WithPrevKV())
+	if err != nil || len(resp.PrevKvs) == 0 {
+		return nil, false, err
+	}
+	return s.prevKVItem(resp.PrevKvs[0]), true, nil
+}
+
+// DeletePrefix removes every key under a prefix in a single etcd request and returns the
+// items removed, as they were right before the delete.
+func (s *Store) DeletePrefix(ctx context.Context, prefix string) ([]*KVItem, error) {
+	resp, err := s.client.Delete(ctx, prefix, clientv3.WithPrefix(), clientv3.WithPrevKV())
 	if err != nil {
 		return nil, err
 	}
-	var result []*KVItem
+	items := make([]*KVItem, 0, len(resp.PrevKvs))
+	for _, kv := range resp.PrevKvs {
+		item := s.DecodeKVItem(string(kv.Key), kv.Value)
+		item.LeaseID = kv.Lease
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// All returns all key-value pairs in etcd (under a prefix).
+func (s *Store) All(ctx context.Context, prefix string) ([]*KVItem, error) {
+	items, _, err := s.AllAtRevision(ctx, prefix, 0)
+	return items, err
+}
+
+// AllAtRevision returns all KV pairs under a prefix as they were at rev, or at the current
+// revision if rev is 0, and the revision they were read at. It returns ErrCompacted if rev has
+// been compacted away.
+func (s *Store) AllAtRevision(ctx context.Context, prefix string, rev int64) (items []*KVItem, readRev int64, err error) {
+	ctx, span := startSpan(ctx, "store.All", "db.prefix", prefix)
+	defer func() { tracing.End(span, err) }()
+
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev))
+	}
+	resp, err := s.client.Get(ctx, prefix, opts...)
+	if errors.Is(err, rpctypes.ErrCompacted) {
+		return nil, 0, ErrCompacted
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if rev == 0 {
+		rev = resp.Header.Revision
+	}
+	return s.formatKVKeys(ctx, resp.Kvs), rev, nil
+}
+
+// Keys returns the keys under a prefix without fetching their values.
+func (s *Store) Keys(ctx context.Context, prefix string) ([]string, error) {
+	keys, _, err := s.KeysWithRevision(ctx, prefix)
+	return keys, err
+}
+
+// KeysWithRevision returns the keys under a prefix, without values, and the revision they were read at.
+func (s *Store) KeysWithRevision(ctx context.Context, prefix string) ([]string, int64, error) {
+	resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, 0, err
+	}
+	keys := make([]string, 0, len(resp.Kvs))
 	for _, kv := range resp.Kvs {
-		kvItem := s.formatKVKey(kv)
-		result = append(result, kvItem)
+		keys = append(keys, string(kv.Key))
 	}
-	return result, nil
+	return keys, resp.Header.Revision, nil
+}
+
+// FirstKey returns the first key in [from, end) without its value, and false if there is none.
+func (s *Store) FirstKey(ctx context.Context, from, end string) (string, bool, error) {
+	resp, err := s.client.Get(ctx, from, clientv3.WithRange(end), clientv3.WithLimit(1), clientv3.WithKeysOnly())
+	if err != nil || len(resp.Kvs) == 0 {
+		return "", false, err
+	}
+	return string(resp.Kvs[0].Key), true, nil
+}
+
+// Count returns the number of keys under a prefix without fetching them.
+func (s *Store) Count(ctx context.Context, prefix string) (int64, error) {
+	resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// Trim deletes the oldest keys under prefix, in key order, so that at most keep keys remain.
+// It returns the number of keys deleted.
+func (s *Store) Trim(ctx context.Context, prefix string, keep int64) (int64, error) {
+	count, err := s.Count(ctx, prefix)
+	if err != nil || count <= keep {
+		return 0, err
+	}
+	resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly(), clientv3.WithLimit(count-keep))
+	if err != nil {
+		return 0, err
+	}
+	ops := make([]clientv3.Op, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		ops = append(ops, clientv3.OpDelete(string(kv.Key)))
+	}
+	if _, err := s.client.Txn(ctx).Then(ops...).Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(ops)), nil
+}
+
+// Scan calls fn for every key-value pair under prefix in key order, fetching batchSize keys per request
+// so memory stays bounded regardless of how many keys match. Scanning stops at the first error from fn.
+func (s *Store) Scan(ctx context.Context, prefix string, batchSize int64, fn func(*KVItem) error) error {
+	end := clientv3.GetPrefixRangeEnd(prefix)
+	from := prefix
+	for {
+		resp, err := s.client.Get(ctx, from, clientv3.WithRange(end), clientv3.WithLimit(batchSize))
+		if err != nil {
+			return err
+		}
+		for _, kvItem := range s.formatKVKeys(ctx, resp.Kvs) {
+			if err := fn(kvItem); err != nil {
+				return err
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return nil
+		}
+		// Continue right after the last key of this batch
+		from = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
+// Page returns up to limit key-value pairs under prefix starting at fromKey (or the start of the
+// prefix if empty), and the key to continue from, empty when there are no more keys.
+func (s *Store) Page(ctx context.Context, prefix string, limit int64, fromKey string) ([]*KVItem, string, error) {
+	items, nextKey, _, err := s.PageAtRevision(ctx, prefix, limit, fromKey, 0)
+	return items, nextKey, err
+}
+
+// PageAtRevision returns up to limit key-value pairs under prefix starting at fromKey (or the start of
+// the prefix if empty), as of revision rev (or the current revision if 0). It returns the key to continue
+// from, empty when there are no more keys, and the revision the page was read at, so further pages can
+// be read at the same revision for a consistent listing. It returns ErrCompacted if rev has been
+// compacted away and ErrFutureRevision if etcd has not reached it yet.
+func (s *Store) PageAtRevision(ctx context.Context, prefix string, limit int64, fromKey string, rev int64) ([]*KVItem, string, int64, error) {
+	if fromKey == "" {
+		fromKey = prefix
+	}
+	opts := []clientv3.OpOption{
+		clientv3.WithRange(clientv3.GetPrefixRangeEnd(prefix)),
+		clientv3.WithLimit(limit),
+	}
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev))
+	}
+
+	resp, err := s.client.Get(ctx, fromKey, opts...)
+	switch {
+	case errors.Is(err, rpctypes.ErrCompacted):
+		return nil, "", 0, ErrCompacted
+	case errors.Is(err, rpctypes.ErrFutureRev):
+		return nil, "", 0, ErrFutureRevision
+	case err != nil:
+		return nil, "", 0, err
+	}
+	if rev == 0 {
+		rev = resp.Header.Revision
+	}
+
+	result := s.formatKVKeys(ctx, resp.Kvs)
+
+	nextKey := ""
+	if resp.More && len(resp.Kvs) > 0 {
+		nextKey = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+	return result, nextKey, rev, nil
 }
 
 // Close closes the etcd client connection and session.
 func (s *Store) Close() error {
+	s.sessionMu.Lock()
 	if s.session != nil {
 		s.session.Close()
 	}
+	s.sessionMu.Unlock()
 	return s.client.Close()
 }
 
@@ -184,25 +562,66 @@ func (s *Store) Client() *clientv3.Client {
 	return s.client
 }
 
-// Session returns the etcd session for distributed locking.
+// Session returns the current etcd session for distributed locking. It may have expired, in
+// which case the next write lock replaces it.
 func (s *Store) Session() *concurrency.Session {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
 	return s.session
 }
 
 // Formatting the KV
-func (s *Store) formatKVKey(kv *mvccpb.KeyValue) *KVItem {
-	formatted := &KVItem{
-		Key:   string(kv.Key),
-		Value: string(kv.Value),
-	}
+func (s *Store) formatKVKey(ctx context.Context, kv *mvccpb.KeyValue) *KVItem {
+	formatted := s.DecodeKVItem(string(kv.Key), kv.Value)
+	formatted.Revision = kv.ModRevision
+	formatted.Created = kv.CreateRevision
+	formatted.Version = kv.Version
 	if kv.Lease == 0 {
 		return formatted
 	}
+	formatted.LeaseID = kv.Lease
 	// Query lease TTL
-	leaseResp, err := s.client.TimeToLive(context.Background(), clientv3.LeaseID(kv.Lease))
+	leaseResp, err := s.client.TimeToLive(ctx, clientv3.LeaseID(kv.Lease))
 	if err != nil {
 		return formatted // Return value even if TTL lookup fails
 	}
-	formatted.TTL = &leaseResp.TTL
+	formatted.TTL = remainingTTL(leaseResp.TTL)
 	return formatted
 }
+
+// remainingTTL returns the TTL of a key from the TTL etcd reports for its lease, which is -1
+// once the lease has expired but before etcd has deleted the key. Such a key is reported as
+// expiring now, with a TTL of 0.
+func remainingTTL(leaseTTL int64) *int64 {
+	ttl := max(leaseTTL, 0)
+	return &ttl
+}
+
+// formatKVKeys formats several KVs, looking up the TTL of each distinct lease only once.
+// Keys written together usually share a lease, so this avoids one TimeToLive call per key.
+func (s *Store) formatKVKeys(ctx context.Context, kvs []*mvccpb.KeyValue) []*KVItem {
+	result := make([]*KVItem, 0, len(kvs))
+	leaseTTLs := make(map[int64]*int64)
+	for _, kv := range kvs {
+		formatted := s.DecodeKVItem(string(kv.Key), kv.Value)
+		formatted.Revision = kv.ModRevision
+		formatted.Created = kv.CreateRevision
+		formatted.Version = kv.Version
+		if kv.Lease != 0 {
+			formatted.LeaseID = kv.Lease
+			ttl, looked := leaseTTLs[kv.Lease]
+			if !looked {
+				if leaseResp, err := s.client.TimeToLive(ctx, clientv3.LeaseID(kv.Lease)); err == nil {
+					ttl = remainingTTL(leaseResp.TTL)
+				}
+				leaseTTLs[kv.Lease] = ttl
+			}
+			if ttl != nil {
+				value := *ttl
+				formatted.TTL = &value
+			}
+		}
+		result = append(result, formatted)
+	}
+	return result
+}
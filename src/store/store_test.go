@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrofi/simple-golang-kv/src/config"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// newTestStore returns a store on the etcd cluster listed in ETCD_TEST_ENDPOINTS, skipping the
+// test if it is not set, and the key prefix the test should write under, deleted afterwards.
+func newTestStore(t testing.TB) (*Store, string) {
+	t.Helper()
+	endpoints := os.Getenv("ETCD_TEST_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("ETCD_TEST_ENDPOINTS not set, skipping test against etcd")
+	}
+	cfg := config.NewConfig()
+	cfg.ETCDEndpoints = strings.Split(endpoints, ",")
+	cfg.BaseKeyPrefix = fmt.Sprintf("kvtest-%d", time.Now().UnixNano())
+
+	s, err := NewStoreWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("connecting to etcd: %v", err)
+	}
+	prefix := "/" + cfg.BaseKeyPrefix + "/"
+	t.Cleanup(func() {
+		s.client.Delete(context.Background(), prefix, clientv3.WithPrefix())
+		s.Close()
+	})
+	return s, prefix
+}
+
+func TestLockSessionRecreatedAfterExpiry(t *testing.T) {
+	s, prefix := newTestStore(t)
+	if !s.writeLocks {
+		t.Skip("write locks are disabled")
+	}
+	ctx := context.Background()
+	expired := s.Session()
+	// Closing the session revokes its lease, as happens when etcd expires it
+	expired.Close()
+
+	if err := s.Set(ctx, prefix+"key", "v", 0); err != nil {
+		t.Fatalf("Set after the session expired: %v", err)
+	}
+	if s.Session() == expired {
+		t.Error("the expired session was not replaced")
+	}
+	select {
+	case <-s.Session().Done():
+		t.Error("the new session is already done")
+	default:
+	}
+}
+
+// writeTestCA writes a self-signed CA certificate to dir and returns its path.
+func writeTestCA(t *testing.T, dir string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kvtest CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewStoreWithConfigBadCerts(t *testing.T) {
+	dir := t.TempDir()
+	ca := writeTestCA(t, dir)
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.pem")
+
+	tests := []struct {
+		name              string
+		caFile, cert, key string
+		wantErr           string
+	}{
+		{"missing CA", missing, garbage, garbage, "failed to read CA cert"},
+		{"invalid CA", garbage, garbage, garbage, "failed to append CA cert"},
+		{"missing client cert", ca, missing, missing, "failed to load client cert and key"},
+		{"invalid client cert", ca, garbage, garbage, "failed to load client cert and key"},
+	}
+	for _, tt := range tests {
+		cfg := config.NewConfig()
+		cfg.ETCDCAFile, cfg.ETCDCertFile, cfg.ETCDKeyFile = tt.caFile, tt.cert, tt.key
+		s, err := NewStoreWithConfig(cfg)
+		if err == nil {
+			s.Close()
+			t.Errorf("%s: NewStoreWithConfig succeeded, want an error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}